@@ -1,9 +1,11 @@
 package cli
 
 import (
+	"flag"
 	"fmt"
 	"os"
 
+	"github.com/angles-n-daemons/popsql/pkg/db"
 	"github.com/angles-n-daemons/popsql/pkg/server"
 )
 
@@ -15,6 +17,14 @@ var banner = `
 `
 
 func Main(args []string) {
+	config := db.NewConfig(os.Getenv)
+	flags := flag.NewFlagSet(args[0], flag.ExitOnError)
+	flags.StringVar(&config.DataDir, "data-dir", config.DataDir, "directory to persist data to, in memory if empty")
+	flags.StringVar(&config.StorageEngine, "storage-engine", config.StorageEngine, "how data is persisted to the data dir, lsm, btree or wal")
+	flags.Parse(args[1:])
+	db.Configure(config)
+	args = append([]string{args[0]}, flags.Args()...)
+
 	fmt.Println(banner)
 	fmt.Println("version 0.0")
 	if len(args) < 2 {
@@ -1,17 +1,36 @@
 package db
 
+import "strconv"
+
 type Config struct {
 	DebugScanner bool
 	DebugParser  bool
 	DebugStore   bool
 	DebugPlanner bool
+
+	// DataDir is the directory the database persists its data to.
+	// If it's empty, the database is kept entirely in memory.
+	DataDir string
+	// StorageEngine selects how data is persisted to DataDir, either
+	// "lsm", "btree" or "wal". It defaults to "lsm". The "wal" engine
+	// keeps everything in memory, and only logs writes to disk so
+	// that they can be replayed on startup.
+	StorageEngine string
+	// BufferPoolSize is the number of bytes of pages the storage
+	// engine caches in memory. If it's zero a default is used.
+	BufferPoolSize int64
 }
 
 func NewConfig(getEnv func(string) string) *Config {
-	return &Config{
-		DebugScanner: getEnv("DEBUG_SCANNER") == "true",
-		DebugParser:  getEnv("DEBUG_PARSER") == "true",
-		DebugStore:   getEnv("DEBUG_STORE") == "true",
-		DebugPlanner: getEnv("DEBUG_PLANNER") == "true",
+	config := &Config{
+		DebugScanner:  getEnv("DEBUG_SCANNER") == "true",
+		DebugParser:   getEnv("DEBUG_PARSER") == "true",
+		DebugStore:    getEnv("DEBUG_STORE") == "true",
+		DebugPlanner:  getEnv("DEBUG_PLANNER") == "true",
+		DataDir:       getEnv("DATA_DIR"),
+		StorageEngine: getEnv("STORAGE_ENGINE"),
 	}
+	// an unset or invalid size falls back to the default.
+	config.BufferPoolSize, _ = strconv.ParseInt(getEnv("BUFFER_POOL_SIZE"), 10, 64)
+	return config
 }
@@ -1,11 +1,14 @@
 package db
 
 import (
+	"fmt"
 	"os"
 	"sync"
 
 	"github.com/angles-n-daemons/popsql/pkg/db/kv"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/mvcc"
 	"github.com/angles-n-daemons/popsql/pkg/db/kv/store"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/buffer"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/desc"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/execution"
@@ -15,42 +18,85 @@ import (
 )
 
 type Engine struct {
-	Store   kv.Store
+	Store   *mvcc.Store
 	Catalog *catalog.Manager
+	// Pool caches the pages of a disk backed store, it's nil when
+	// the engine is in memory.
+	Pool *buffer.Pool
 }
 
+// Query runs a single statement in a session of its own, so that it
+// runs in its own transaction.
 func (e *Engine) Query(query string, parameters []any) (*execution.Result, error) {
-	stmt, err := parser.Parse(query)
-	if err != nil {
-		return nil, err
-	}
-
-	plan, err := plan.PlanQuery(e.Catalog.Schema, stmt)
-	if err != nil {
-		return nil, err
-	}
+	return e.NewSession().Query(query, parameters)
+}
 
-	return execution.Run(e.Store, e.Catalog, plan)
+// Close closes the engine's store. Once it's closed, an engine can be
+// reopened on the same data dir.
+func (e *Engine) Close() error {
+	return e.Store.Close()
 }
 
-func newEngine(debugStore bool) *Engine {
+func newEngine(config *Config) *Engine {
 	var st kv.Store = store.NewMemStore()
-	if debugStore {
+	var pool *buffer.Pool
+	if config.DataDir != "" {
+		size := config.BufferPoolSize
+		if size <= 0 {
+			size = buffer.DefaultBudget
+		}
+		pool = buffer.NewPool(size, buffer.LRU)
+
+		var err error
+		switch config.StorageEngine {
+		case "", "lsm":
+			st, err = store.NewLSMStore(config.DataDir, pool)
+		case "btree":
+			st, err = store.NewBTreeStore(config.DataDir, pool)
+		case "wal":
+			// the WAL store keeps all of its data in memory, so it
+			// has no pages to cache.
+			pool = nil
+			st, err = store.NewWALStore(config.DataDir)
+		default:
+			err = fmt.Errorf("unknown storage engine '%s'", config.StorageEngine)
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+	if config.DebugStore {
 		st = store.NewDebugStore(st)
 	}
-	manager, err := catalog.NewManager(st)
+	versioned, err := mvcc.NewStore(st, nil)
+	if err != nil {
+		panic(err)
+	}
+	// if the store already holds a schema, the manager loads it
+	// rather than bootstrapping a new one.
+	manager, err := catalog.NewManager(versioned)
 	if err != nil {
 		panic(err)
 	}
-	return &Engine{st, manager}
+	return &Engine{versioned, manager, pool}
 }
 
 var db *Engine
 var once sync.Once
+var config *Config
+
+// Configure sets the config used to create the engine. It must be
+// called before the first call to GetEngine, otherwise the config
+// is read from the environment.
+func Configure(c *Config) {
+	config = c
+}
 
 func GetEngine() *Engine {
 	once.Do(func() {
-		config := NewConfig(os.Getenv)
+		if config == nil {
+			config = NewConfig(os.Getenv)
+		}
 		if config.DebugScanner {
 			scanner.Debug = true
 		}
@@ -63,7 +109,7 @@ func GetEngine() *Engine {
 		if config.DebugStore {
 			desc.DebugTables = true
 		}
-		db = newEngine(config.DebugStore)
+		db = newEngine(config)
 	})
 	return db
 }
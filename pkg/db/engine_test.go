@@ -0,0 +1,50 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/desc"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/schema"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/execution"
+	"github.com/angles-n-daemons/popsql/pkg/test/assert"
+)
+
+func TestEngineReopen(t *testing.T) {
+	for _, storage := range []string{"lsm", "btree", "wal"} {
+		t.Run(storage, func(t *testing.T) {
+			config := &Config{DataDir: t.TempDir(), StorageEngine: storage}
+			e := newEngine(config)
+			s := e.NewSession()
+			query(t, s, `CREATE TABLE t (a NUMBER PRIMARY KEY, b STRING DEFAULT "x")`)
+			query(t, s, `INSERT INTO t (a, b) VALUES (1, "one"), (2, "two")`)
+			// enough tables that their IDs run past 10, so that the
+			// spans of tables like "1" and "10" have to be kept apart.
+			for i := 0; i < 10; i++ {
+				query(t, s, fmt.Sprintf("CREATE TABLE u%d (a NUMBER)", i))
+				query(t, s, fmt.Sprintf("INSERT INTO u%d (a) VALUES (%d)", i, i))
+			}
+			assert.NoError(t, e.Close())
+
+			e = newEngine(config)
+			defer e.Close()
+			s = e.NewSession()
+			table := schema.GetByName[*desc.Table](e.Catalog.Schema, "t")
+			assert.NotNil(t, table)
+			assert.Equal(t, []string{"a"}, table.PrimaryKey)
+			result := query(t, s, "SELECT * FROM t")
+			assert.Equal(t, []execution.Row{{1.0, "one"}, {2.0, "two"}}, result.Rows)
+			for i := 0; i < 10; i++ {
+				result := query(t, s, fmt.Sprintf("SELECT * FROM u%d", i))
+				assert.Equal(t, []execution.Row{{float64(i)}}, result.Rows)
+			}
+
+			// the sequences pick up where they left off.
+			query(t, s, "INSERT INTO t (a) VALUES (3)")
+			query(t, s, "INSERT INTO u0 (a) VALUES (10)")
+			assert.Equal(t, 2, count(t, s, "u0"))
+			result = query(t, s, "SELECT b FROM t WHERE a == 3")
+			assert.Equal(t, []execution.Row{{"x"}}, result.Rows)
+		})
+	}
+}
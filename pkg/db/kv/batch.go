@@ -0,0 +1,64 @@
+package kv
+
+// Writer is the write half of a Store. Code which only writes can
+// accept a Writer, so that it can be handed either a Store to write
+// to directly, or a WriteBatch to collect the writes into.
+type Writer interface {
+	Put(string, []byte) error
+	Delete(string) error
+}
+
+// BatchOp is a single write held in a WriteBatch.
+type BatchOp struct {
+	Key   string
+	Value []byte
+	// Delete is set if the op deletes the key, in which case Value
+	// is nil.
+	Delete bool
+}
+
+// WriteBatch collects puts and deletes so that they can be applied
+// to a Store together with Store.Write. Either every write in the
+// batch is applied or none of them are, and no other write is
+// interleaved with it. Writes to the same key are applied in the
+// order they were added, so the last one wins.
+//
+// Not every store hides a batch from readers until it's applied.
+// The LSMStore and BTreeStore apply a batch under the lock their
+// Gets take, so a Get sees all of it or none of it, but the
+// Memstore, and so the WALStore built on it, applies it one write at
+// a time, so even a Get may see part of it. No store's cursors hold
+// a lock between reads, so a Scan may see part of a batch in any of
+// them. Readers which need to see a batch whole should read through
+// an mvcc.Store, whose versions aren't visible until the clock moves
+// past the batch's timestamp.
+type WriteBatch struct {
+	Ops []BatchOp
+}
+
+func NewWriteBatch() *WriteBatch {
+	return &WriteBatch{}
+}
+
+// Put adds a put to the batch. It never fails, it returns an error
+// so that a batch satisfies Writer.
+func (b *WriteBatch) Put(key string, value []byte) error {
+	b.Ops = append(b.Ops, BatchOp{Key: key, Value: value})
+	return nil
+}
+
+// Delete adds a delete to the batch.
+func (b *WriteBatch) Delete(key string) error {
+	b.Ops = append(b.Ops, BatchOp{Key: key, Delete: true})
+	return nil
+}
+
+// Len returns the number of writes in the batch.
+func (b *WriteBatch) Len() int {
+	return len(b.Ops)
+}
+
+// Reset empties the batch so that it can be reused.
+func (b *WriteBatch) Reset() {
+	b.Ops = b.Ops[:0]
+}
@@ -0,0 +1,193 @@
+package keys
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Values are encoded into key IDs so that comparing the bytes of two
+// encoded keys orders them the same way as comparing their values,
+// one after the other. Each value starts with a tag naming its type,
+// which is what lets them be decoded back out of a key without
+// knowing the table's columns. The tags start from one, so that no
+// encoded ID is mistaken for END_ID.
+const (
+	tagNull byte = iota + 1
+	tagFalse
+	tagTrue
+	tagNumber
+	tagString
+)
+
+// strings are terminated by 0x00 0x01, with any 0x00 byte inside
+// them escaped as 0x00 0xff, so that a string sorts before any
+// longer string it's a prefix of.
+const (
+	escape     byte = 0x00
+	escaped00  byte = 0xff
+	terminator byte = 0x01
+)
+
+var errMalformedValue = errors.New("malformed key value")
+
+// AppendValue appends the order preserving encoding of a value to b.
+// Numbers of any Go type are encoded as float64, which is how the
+// NUMBER type is held.
+func AppendValue(b []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, tagNull), nil
+	case bool:
+		if v {
+			return append(b, tagTrue), nil
+		}
+		return append(b, tagFalse), nil
+	case float64:
+		return appendNumber(b, v)
+	case int:
+		return appendNumber(b, float64(v))
+	case int64:
+		return appendNumber(b, float64(v))
+	case uint64:
+		return appendNumber(b, float64(v))
+	case string:
+		b = append(b, tagString)
+		for i := 0; i < len(v); i++ {
+			if v[i] == escape {
+				b = append(b, escape, escaped00)
+			} else {
+				b = append(b, v[i])
+			}
+		}
+		return append(b, escape, terminator), nil
+	default:
+		return nil, fmt.Errorf("cannot encode value %v of type %T in a key", v, v)
+	}
+}
+
+// appendNumber encodes a float so that its bytes sort in numeric
+// order. Positive numbers have their sign bit set, so that they sort
+// after negative ones, whose bits are all flipped so that larger
+// magnitudes sort first.
+func appendNumber(b []byte, f float64) ([]byte, error) {
+	if math.IsNaN(f) {
+		return nil, errors.New("cannot encode NaN in a key")
+	}
+	if f == 0 {
+		// -0 and 0 are equal, so they need the same encoding.
+		f = 0
+	}
+	bits := math.Float64bits(f)
+	if f < 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	b = append(b, tagNumber)
+	return binary.BigEndian.AppendUint64(b, bits), nil
+}
+
+// DecodeValue decodes the value at the start of b, returning it along
+// with the rest of b.
+func DecodeValue(b []byte) (any, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, errMalformedValue
+	}
+	switch b[0] {
+	case tagNull:
+		return nil, b[1:], nil
+	case tagFalse:
+		return false, b[1:], nil
+	case tagTrue:
+		return true, b[1:], nil
+	case tagNumber:
+		if len(b) < 9 {
+			return nil, nil, errMalformedValue
+		}
+		bits := binary.BigEndian.Uint64(b[1:9])
+		if bits&(1<<63) != 0 {
+			bits &^= 1 << 63
+		} else {
+			bits = ^bits
+		}
+		return math.Float64frombits(bits), b[9:], nil
+	case tagString:
+		s := []byte{}
+		for i := 1; i+1 < len(b); i++ {
+			if b[i] != escape {
+				s = append(s, b[i])
+				continue
+			}
+			switch b[i+1] {
+			case terminator:
+				return string(s), b[i+2:], nil
+			case escaped00:
+				s = append(s, escape)
+				i++
+			default:
+				return nil, nil, errMalformedValue
+			}
+		}
+		return nil, nil, errMalformedValue
+	default:
+		return nil, nil, errMalformedValue
+	}
+}
+
+// EncodeValues encodes each of the values in turn.
+func EncodeValues(vals ...any) (string, error) {
+	b := []byte{}
+	for _, v := range vals {
+		var err error
+		b, err = AppendValue(b, v)
+		if err != nil {
+			return "", err
+		}
+	}
+	return string(b), nil
+}
+
+// DecodeValues decodes every value encoded in s.
+func DecodeValues(s string) ([]any, error) {
+	b := []byte(s)
+	vals := []any{}
+	for len(b) > 0 {
+		var (
+			v   any
+			err error
+		)
+		v, b, err = DecodeValue(b)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	return vals, nil
+}
+
+// WithValues returns a key whose ID is the encoding of the values,
+// such as those of a row's primary key columns.
+func (k *Key) WithValues(vals ...any) (*Key, error) {
+	id, err := EncodeValues(vals...)
+	if err != nil {
+		return nil, err
+	}
+	return newKey(k.Table, id), nil
+}
+
+// Values decodes the values encoded in the key's ID.
+func (k *Key) Values() ([]any, error) {
+	return DecodeValues(k.ID)
+}
+
+// Decode splits an encoded key back into its table and ID.
+func Decode(s string) (*Key, error) {
+	table, id, ok := strings.Cut(s, string(delimiter))
+	if !ok {
+		return nil, fmt.Errorf("malformed key %q, it has no delimiter", s)
+	}
+	return newKey(table, id), nil
+}
@@ -0,0 +1,102 @@
+package keys_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/keys"
+	"github.com/angles-n-daemons/popsql/pkg/test/assert"
+)
+
+func encode(t *testing.T, vals ...any) string {
+	t.Helper()
+	s, err := keys.EncodeValues(vals...)
+	assert.NoError(t, err)
+	return s
+}
+
+func TestEncodeValuesRoundTrip(t *testing.T) {
+	for _, vals := range [][]any{
+		{},
+		{nil},
+		{true, false},
+		{0.0, -1.5, 42.0, 1e21, math.Inf(1), math.Inf(-1)},
+		{"", "a.b/c", "nul\x00inside", "\x00\xff"},
+		{1.0, "mixed", true, nil},
+	} {
+		decoded, err := keys.DecodeValues(encode(t, vals...))
+		assert.NoError(t, err)
+		assert.Equal(t, vals, decoded)
+	}
+
+	// every number decodes as a float64, whatever it was encoded as.
+	decoded, err := keys.DecodeValues(encode(t, 7, int64(-3), uint64(9)))
+	assert.NoError(t, err)
+	assert.Equal(t, []any{7.0, -3.0, 9.0}, decoded)
+}
+
+func TestEncodeValuesOrder(t *testing.T) {
+	for _, ordered := range [][][]any{
+		{
+			{math.Inf(-1)}, {-1e10}, {-2.5}, {-1.0}, {0.0}, {0.5},
+			{1.0}, {9.0}, {10.0}, {100.0}, {1e21}, {math.Inf(1)},
+		},
+		{{""}, {"\x00"}, {"a"}, {"a\x00"}, {"a\x00b"}, {"ab"}, {"b"}},
+		{{false}, {true}},
+		// composite keys sort by their first value, then the next.
+		{{1.0, "b"}, {1.0, "c"}, {2.0, "a"}, {10.0, ""}},
+		{{"a", 2.0}, {"a", 10.0}, {"ab", 1.0}},
+	} {
+		for i := 1; i < len(ordered); i++ {
+			prev, next := encode(t, ordered[i-1]...), encode(t, ordered[i]...)
+			if prev >= next {
+				t.Errorf("expected %v to sort before %v", ordered[i-1], ordered[i])
+			}
+		}
+	}
+
+	// -0 and 0 are the same key.
+	assert.Equal(t, encode(t, 0.0), encode(t, math.Copysign(0, -1)))
+}
+
+func TestEncodeValuesInvalid(t *testing.T) {
+	_, err := keys.EncodeValues(math.NaN())
+	assert.IsError(t, err, "cannot encode NaN in a key")
+	_, err = keys.EncodeValues([]int{1})
+	assert.IsError(t, err, "cannot encode value [1] of type []int in a key")
+
+	for _, malformed := range []string{
+		"x",
+		encode(t, 1.0)[:5],
+		encode(t, "abc")[:3],
+		"\x05a\x00\x02",
+	} {
+		_, err := keys.DecodeValues(malformed)
+		assert.IsError(t, err, "malformed key value")
+	}
+}
+
+func TestKeyWithValues(t *testing.T) {
+	table := keys.New("3")
+	nine, err := table.WithValues(9)
+	assert.NoError(t, err)
+	ten, err := table.WithValues(10)
+	assert.NoError(t, err)
+
+	// both fall inside the table's span, in numeric order.
+	end := table.Next().Encode()
+	assert.True(t, table.Encode() <= nine.Encode() && nine.Encode() < ten.Encode() && ten.Encode() < end)
+
+	key, err := table.WithValues(4, "a/b")
+	assert.NoError(t, err)
+	assert.Equal(t, "3/4/a/b", key.String())
+	decoded, err := keys.Decode(key.Encode())
+	assert.NoError(t, err)
+	assert.Equal(t, key.Encode(), decoded.Encode())
+	vals, err := decoded.Values()
+	assert.NoError(t, err)
+	assert.Equal(t, []any{4.0, "a/b"}, vals)
+
+	_, err = keys.Decode(table.Next().Encode())
+	assert.IsError(t, err, `malformed key "30", it has no delimiter`)
+}
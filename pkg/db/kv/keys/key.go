@@ -1,6 +1,7 @@
 package keys
 
 import (
+	"fmt"
 	"strings"
 	"unicode/utf8"
 )
@@ -11,6 +12,9 @@ const END_ID = '\u0000'
 // MIN_RUNE skips the control characters
 const MIN_RUNE = '\u0020'
 
+// delimiter separates the table from the id in an encoded key.
+const delimiter = '/'
+
 // Key is the reference object for a key in the database's keyspace.
 // It contains a table, the set of records the key belongs to and an ID,
 // the identifier for the individual record.
@@ -44,20 +48,35 @@ func (k *Key) WithIDAddition(id string) *Key {
 	return newKey(k.Table, k.ID+"."+id)
 }
 
-func (k *Key) Encode() string {
-	return k.String()
+// String returns the key in a readable form. Keys whose IDs hold
+// encoded values have them written out, separated by the delimiter.
+func (k *Key) String() string {
+	if isEnd(k.ID) || k.ID == "" {
+		return k.Encode()
+	}
+	vals, err := k.Values()
+	if err != nil {
+		return k.Encode()
+	}
+	parts := make([]string, len(vals))
+	for i, v := range vals {
+		parts[i] = fmt.Sprintf("%v", v)
+	}
+	return k.Table + string(delimiter) + strings.Join(parts, string(delimiter))
 }
 
-func (k *Key) String() string {
+func (k *Key) Encode() string {
 	key := k.Table
 	id := k.ID
 	if isEnd(k.ID) {
-		// special case, use a delimiter greater than /
-		return key + "?"
+		// special case, use the character directly after the
+		// delimiter so that the end of table "1" sorts before
+		// the keys of table "10".
+		return key + string(delimiter+1)
 	}
 	// remove the delimiter from the string if it exists
 	strings.ReplaceAll(key, "/", "")
-	key += "/" + id
+	key += string(delimiter) + id
 	return key
 }
 
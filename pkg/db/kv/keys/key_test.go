@@ -65,8 +65,8 @@ func TestEncode(t *testing.T) {
 	}
 
 	// special case check for the end string
-	if key.WithID(string(keys.END_ID)).Encode() != "testTable?" {
-		t.Errorf("expected string %s, got %s", "testTable?", key.Encode())
+	if key.WithID(string(keys.END_ID)).Encode() != "testTable0" {
+		t.Errorf("expected string %s, got %s", "testTable0", key.Encode())
 	}
 }
 
@@ -114,3 +114,12 @@ func TestNextEncode(t *testing.T) {
 		}
 	}
 }
+
+func TestSpanExcludesLongerTables(t *testing.T) {
+	start := keys.New("1")
+	end := start.Next()
+	other := keys.New("10").WithID("1")
+	if start.Encode() <= other.Encode() && other.Encode() < end.Encode() {
+		t.Errorf("expected key %s to fall outside of span [%s, %s)", other.Encode(), start.Encode(), end.Encode())
+	}
+}
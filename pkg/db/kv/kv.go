@@ -9,6 +9,14 @@ type Register interface {
 	Value() ([]byte, error)
 }
 
+// Reader is the read half of a Store. Code which only reads can
+// accept a Reader, so that it can be handed either a Store or a
+// snapshot of one.
+type Reader interface {
+	Get(string) ([]byte, error)
+	Scan(start, end string) (Cursor, error)
+}
+
 // Store is the primary interface which will be exposed to the
 // rest of the database system. It defines a simple key-value
 // interface, which can be implemented in any chosen way; in
@@ -16,6 +24,12 @@ type Register interface {
 type Store interface {
 	Get(string) ([]byte, error)
 	Put(string, []byte) error
+	// Delete removes a key from the store. Deleting a key which
+	// doesn't exist is not an error.
+	Delete(string) error
+	// Write applies every put and delete in the batch, all or
+	// nothing. See WriteBatch for what concurrent readers may see.
+	Write(*WriteBatch) error
 	Scan(start, end string) (Cursor, error)
 }
 
@@ -26,4 +40,11 @@ type Cursor interface {
 	Read(num int) ([][]byte, error)
 	Next() ([]byte, error)
 	IsAtEnd() bool
+	// Key returns the key of the value which the next call to Next
+	// will return, or an empty string if the cursor is at its end.
+	Key() string
+	// Close releases whatever the cursor holds open. It must be
+	// called by readers which stop before the cursor reaches its
+	// end, and is safe to call more than once.
+	Close() error
 }
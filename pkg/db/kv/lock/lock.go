@@ -0,0 +1,276 @@
+package lock
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/keys"
+)
+
+// ErrDeadlock is returned to the transaction chosen to break a
+// deadlock. It should roll back, releasing its locks, so that the
+// rest of the transactions in the deadlock can continue.
+var ErrDeadlock = errors.New("deadlock detected")
+
+// Mode is the mode a lock is held in.
+type Mode int
+
+const (
+	// Shared locks can be held by any number of transactions at once.
+	Shared Mode = iota
+	// Exclusive locks can only be held by one transaction, and no
+	// one else can hold a shared lock on the key meanwhile.
+	Exclusive
+)
+
+func (m Mode) String() string {
+	if m == Exclusive {
+		return "exclusive"
+	}
+	return "shared"
+}
+
+func compatible(a, b Mode) bool {
+	return a == Shared && b == Shared
+}
+
+/*
+Manager locks keys on behalf of transactions, which are identified by
+a number unique to each of them. A transaction which asks for a lock
+that conflicts with one held by another transaction waits in a queue
+for the key until it can be granted, in the order it asked.
+
+Locks are held until the transaction releases them all at once, when
+it ends. So transactions waiting on each other in a cycle would wait
+forever. Before waiting, a transaction's request is checked against
+the waits-for graph, whose edges run from each waiting transaction to
+the transactions it's waiting on. If waiting would close a cycle, the
+youngest transaction in it, which has the highest number, is chosen
+as the victim and fails with ErrDeadlock.
+*/
+type Manager struct {
+	mu sync.Mutex
+	// locks holds the state of each key which is locked, or which
+	// has transactions waiting for it.
+	locks map[string]*lockState
+	// held holds the keys locked by each transaction.
+	held map[uint64][]string
+	// waiting holds the request each waiting transaction is blocked
+	// on. A transaction only waits for one lock at a time.
+	waiting map[uint64]*request
+}
+
+type lockState struct {
+	holders map[uint64]Mode
+	queue   []*request
+}
+
+type request struct {
+	txn  uint64
+	key  string
+	mode Mode
+	// ready receives the outcome of the request once it's granted,
+	// or chosen as the victim of a deadlock.
+	ready chan error
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		locks:   map[string]*lockState{},
+		held:    map[uint64][]string{},
+		waiting: map[uint64]*request{},
+	}
+}
+
+// Acquire locks the key for the transaction in the given mode,
+// waiting until any conflicting locks are released. A shared lock
+// held by the transaction is upgraded if it asks for an exclusive
+// one, while asking for a lock it already holds does nothing.
+func (m *Manager) Acquire(txn uint64, key *keys.Key, mode Mode) error {
+	k := key.Encode()
+
+	m.mu.Lock()
+	ls, ok := m.locks[k]
+	if !ok {
+		ls = &lockState{holders: map[uint64]Mode{}}
+		m.locks[k] = ls
+	}
+	held, holds := ls.holders[txn]
+	if holds && (held == Exclusive || mode == Shared) {
+		m.mu.Unlock()
+		return nil
+	}
+	req := &request{txn: txn, key: k, mode: mode, ready: make(chan error, 1)}
+	// a new request waits its turn behind the queue, but an upgrade
+	// needn't, since the queue is waiting on the lock it holds.
+	if (holds || len(ls.queue) == 0) && ls.grantable(req) {
+		m.grant(ls, req)
+		m.mu.Unlock()
+		return nil
+	}
+
+	if holds {
+		// the upgrade goes ahead of the queue, behind any others.
+		i := 0
+		for i < len(ls.queue) && ls.isUpgrade(ls.queue[i]) {
+			i++
+		}
+		ls.queue = append(ls.queue[:i], append([]*request{req}, ls.queue[i:]...)...)
+	} else {
+		ls.queue = append(ls.queue, req)
+	}
+	m.waiting[txn] = req
+
+	// any cycle the request closes runs through it, since the graph
+	// had none before. Breaking one may leave another, so victims are
+	// chosen until none are left or the request itself is chosen.
+	for {
+		cycle := m.cycle(txn)
+		if cycle == nil {
+			break
+		}
+		victim := cycle[0]
+		for _, t := range cycle {
+			victim = max(victim, t)
+		}
+		m.abort(m.waiting[victim])
+		if victim == txn {
+			break
+		}
+	}
+	m.mu.Unlock()
+	return <-req.ready
+}
+
+// Release releases every lock held by the transaction, granting
+// them to the transactions waiting for them.
+func (m *Manager) Release(txn uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range m.held[txn] {
+		ls := m.locks[k]
+		delete(ls.holders, txn)
+		m.promote(k, ls)
+	}
+	delete(m.held, txn)
+}
+
+// Holds returns the mode the transaction holds the key's lock in, and
+// whether it holds it at all.
+func (m *Manager) Holds(txn uint64, key *keys.Key) (Mode, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ls, ok := m.locks[key.Encode()]
+	if !ok {
+		return Shared, false
+	}
+	mode, ok := ls.holders[txn]
+	return mode, ok
+}
+
+// grantable returns whether the request is compatible with the
+// locks held by every other transaction.
+func (ls *lockState) grantable(req *request) bool {
+	for txn, mode := range ls.holders {
+		if txn != req.txn && !compatible(mode, req.mode) {
+			return false
+		}
+	}
+	return true
+}
+
+func (ls *lockState) isUpgrade(req *request) bool {
+	_, ok := ls.holders[req.txn]
+	return ok
+}
+
+func (m *Manager) grant(ls *lockState, req *request) {
+	if _, ok := ls.holders[req.txn]; !ok {
+		m.held[req.txn] = append(m.held[req.txn], req.key)
+	}
+	ls.holders[req.txn] = max(ls.holders[req.txn], req.mode)
+	delete(m.waiting, req.txn)
+	req.ready <- nil
+}
+
+// promote grants the requests at the front of the key's queue, for as
+// long as they're compatible with the locks held.
+func (m *Manager) promote(k string, ls *lockState) {
+	for len(ls.queue) > 0 && ls.grantable(ls.queue[0]) {
+		req := ls.queue[0]
+		ls.queue = ls.queue[1:]
+		m.grant(ls, req)
+	}
+	if len(ls.holders) == 0 && len(ls.queue) == 0 {
+		delete(m.locks, k)
+	}
+}
+
+// abort removes a waiting request from its queue, failing it with
+// ErrDeadlock. The requests behind it may no longer be blocked.
+func (m *Manager) abort(req *request) {
+	ls := m.locks[req.key]
+	for i, r := range ls.queue {
+		if r == req {
+			ls.queue = append(ls.queue[:i], ls.queue[i+1:]...)
+			break
+		}
+	}
+	delete(m.waiting, req.txn)
+	req.ready <- ErrDeadlock
+	m.promote(req.key, ls)
+}
+
+// blockers returns the transactions a waiting request is waiting on,
+// which are those holding a conflicting lock on its key, and those
+// ahead of it in the queue asking for one.
+func (m *Manager) blockers(req *request) []uint64 {
+	ls := m.locks[req.key]
+	txns := []uint64{}
+	for txn, mode := range ls.holders {
+		if txn != req.txn && !compatible(mode, req.mode) {
+			txns = append(txns, txn)
+		}
+	}
+	for _, r := range ls.queue {
+		if r == req {
+			break
+		}
+		if r.txn != req.txn && !compatible(r.mode, req.mode) {
+			txns = append(txns, r.txn)
+		}
+	}
+	return txns
+}
+
+// cycle returns the transactions on a cycle in the waits-for graph
+// through txn, or nil if there isn't one.
+func (m *Manager) cycle(txn uint64) []uint64 {
+	visited := map[uint64]bool{}
+	var path []uint64
+	var visit func(t uint64) bool
+	visit = func(t uint64) bool {
+		req, ok := m.waiting[t]
+		if !ok {
+			return false
+		}
+		path = append(path, t)
+		for _, b := range m.blockers(req) {
+			if b == txn {
+				return true
+			}
+			if !visited[b] {
+				visited[b] = true
+				if visit(b) {
+					return true
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	if visit(txn) {
+		return path
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package lock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/keys"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/lock"
+	"github.com/angles-n-daemons/popsql/pkg/test/assert"
+)
+
+var (
+	a = keys.New("t").WithID("a")
+	b = keys.New("t").WithID("b")
+)
+
+// acquire asks for the lock in the background, returning a channel
+// which receives the outcome.
+func acquire(m *lock.Manager, txn uint64, key *keys.Key, mode lock.Mode) <-chan error {
+	ch := make(chan error, 1)
+	go func() {
+		ch <- m.Acquire(txn, key, mode)
+	}()
+	return ch
+}
+
+func waitFor(t *testing.T, ch <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the lock")
+		return nil
+	}
+}
+
+func assertBlocked(t *testing.T, ch <-chan error) {
+	t.Helper()
+	select {
+	case err := <-ch:
+		t.Fatalf("expected the lock to be blocked, but it returned %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestLockShared(t *testing.T) {
+	m := lock.NewManager()
+	assert.NoError(t, m.Acquire(1, a, lock.Shared))
+	assert.NoError(t, m.Acquire(2, a, lock.Shared))
+	// locks on other keys don't interfere.
+	assert.NoError(t, m.Acquire(3, b, lock.Exclusive))
+
+	mode, ok := m.Holds(2, a)
+	assert.True(t, ok)
+	assert.Equal(t, lock.Shared, mode)
+	_, ok = m.Holds(3, a)
+	assert.False(t, ok)
+}
+
+func TestLockExclusive(t *testing.T) {
+	m := lock.NewManager()
+	assert.NoError(t, m.Acquire(1, a, lock.Exclusive))
+	// asking again for a lock already held does nothing.
+	assert.NoError(t, m.Acquire(1, a, lock.Shared))
+
+	second := acquire(m, 2, a, lock.Shared)
+	assertBlocked(t, second)
+	third := acquire(m, 3, a, lock.Exclusive)
+	assertBlocked(t, third)
+
+	// the queue is granted in order.
+	m.Release(1)
+	assert.NoError(t, waitFor(t, second))
+	assertBlocked(t, third)
+	m.Release(2)
+	assert.NoError(t, waitFor(t, third))
+	_, ok := m.Holds(1, a)
+	assert.False(t, ok)
+}
+
+func TestLockQueueIsFair(t *testing.T) {
+	m := lock.NewManager()
+	assert.NoError(t, m.Acquire(1, a, lock.Shared))
+	writer := acquire(m, 2, a, lock.Exclusive)
+	assertBlocked(t, writer)
+
+	// a shared lock is compatible with the held lock, but waits behind
+	// the exclusive request so that it isn't starved.
+	reader := acquire(m, 3, a, lock.Shared)
+	assertBlocked(t, reader)
+	m.Release(1)
+	assert.NoError(t, waitFor(t, writer))
+	assertBlocked(t, reader)
+	m.Release(2)
+	assert.NoError(t, waitFor(t, reader))
+}
+
+func TestLockUpgrade(t *testing.T) {
+	m := lock.NewManager()
+	assert.NoError(t, m.Acquire(1, a, lock.Shared))
+	assert.NoError(t, m.Acquire(1, a, lock.Exclusive))
+	mode, _ := m.Holds(1, a)
+	assert.Equal(t, lock.Exclusive, mode)
+	m.Release(1)
+
+	assert.NoError(t, m.Acquire(1, a, lock.Shared))
+	assert.NoError(t, m.Acquire(2, a, lock.Shared))
+	writer := acquire(m, 3, a, lock.Exclusive)
+	assertBlocked(t, writer)
+
+	// the upgrade waits for the other reader, but not for the queue.
+	upgrade := acquire(m, 1, a, lock.Exclusive)
+	assertBlocked(t, upgrade)
+	m.Release(2)
+	assert.NoError(t, waitFor(t, upgrade))
+	assertBlocked(t, writer)
+	m.Release(1)
+	assert.NoError(t, waitFor(t, writer))
+}
+
+func TestLockDeadlock(t *testing.T) {
+	m := lock.NewManager()
+	assert.NoError(t, m.Acquire(1, a, lock.Exclusive))
+	assert.NoError(t, m.Acquire(2, b, lock.Exclusive))
+
+	first := acquire(m, 1, b, lock.Exclusive)
+	assertBlocked(t, first)
+	// the youngest transaction in the cycle is the victim.
+	err := m.Acquire(2, a, lock.Exclusive)
+	assert.IsError(t, err, "deadlock detected")
+	assertBlocked(t, first)
+	m.Release(2)
+	assert.NoError(t, waitFor(t, first))
+}
+
+func TestLockDeadlockWaitingVictim(t *testing.T) {
+	m := lock.NewManager()
+	assert.NoError(t, m.Acquire(2, a, lock.Exclusive))
+	assert.NoError(t, m.Acquire(1, b, lock.Exclusive))
+
+	// the victim can be a transaction which was already waiting.
+	second := acquire(m, 2, b, lock.Exclusive)
+	assertBlocked(t, second)
+	first := acquire(m, 1, a, lock.Exclusive)
+	assert.IsError(t, waitFor(t, second), "deadlock detected")
+	assertBlocked(t, first)
+	m.Release(2)
+	assert.NoError(t, waitFor(t, first))
+}
+
+func TestLockUpgradeDeadlock(t *testing.T) {
+	m := lock.NewManager()
+	assert.NoError(t, m.Acquire(1, a, lock.Shared))
+	assert.NoError(t, m.Acquire(2, a, lock.Shared))
+
+	// two readers upgrading wait on each other.
+	first := acquire(m, 1, a, lock.Exclusive)
+	assertBlocked(t, first)
+	err := m.Acquire(2, a, lock.Exclusive)
+	assert.IsError(t, err, "deadlock detected")
+	m.Release(2)
+	assert.NoError(t, waitFor(t, first))
+}
+
+func TestLockThreeWayDeadlock(t *testing.T) {
+	m := lock.NewManager()
+	c := keys.New("t").WithID("c")
+	assert.NoError(t, m.Acquire(1, a, lock.Exclusive))
+	assert.NoError(t, m.Acquire(2, b, lock.Exclusive))
+	assert.NoError(t, m.Acquire(3, c, lock.Exclusive))
+
+	first := acquire(m, 1, b, lock.Exclusive)
+	assertBlocked(t, first)
+	second := acquire(m, 2, c, lock.Exclusive)
+	assertBlocked(t, second)
+	assert.IsError(t, m.Acquire(3, a, lock.Exclusive), "deadlock detected")
+	m.Release(3)
+	assert.NoError(t, waitFor(t, second))
+	m.Release(2)
+	assert.NoError(t, waitFor(t, first))
+}
@@ -0,0 +1,84 @@
+package mvcc
+
+import (
+	"math"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv"
+)
+
+// GC removes the versions which no snapshot can see any longer, and
+// returns how many it removed.
+//
+// The oldest open snapshot, or the latest commit if none are open,
+// is the watermark. No snapshot will read below it, so of each key's
+// versions at or below the watermark only the newest is needed, and
+// only if it holds a value. Everything older is removed, and so is
+// the newest if it's a tombstone.
+//
+// Commits carry on while the store is scanned, but they only write
+// versions above the watermark, which the collection leaves alone.
+func (s *Store) GC() (int, error) {
+	s.gcMu.Lock()
+	defer s.gcMu.Unlock()
+	return s.gc()
+}
+
+func (s *Store) gc() (int, error) {
+	s.mu.Lock()
+	watermark := s.clock
+	for ts := range s.snapshots {
+		watermark = min(watermark, ts)
+	}
+	// snapshots can no longer be opened below the watermark, since
+	// the versions they'd need are about to be removed.
+	s.horizon = max(s.horizon, watermark)
+	s.mu.Unlock()
+
+	// the deletes are written once the scan is done, so that the
+	// cursor doesn't read the store while it removes from it.
+	batch := kv.NewWriteBatch()
+	cur, err := s.st.Scan(EncodeKey("", math.MaxUint64), keysEnd)
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close()
+	var (
+		key string
+		// covered is set once the newest version of key at or below
+		// the watermark has been seen.
+		covered bool
+	)
+	for !cur.IsAtEnd() {
+		k := cur.Key()
+		b, err := cur.Next()
+		if err != nil {
+			return 0, err
+		}
+		vk, ts, err := DecodeKey(k)
+		if err != nil {
+			return 0, err
+		}
+		if vk != key {
+			key, covered = vk, false
+		}
+		if ts > watermark {
+			continue
+		}
+		if covered {
+			batch.Delete(k)
+			continue
+		}
+		covered = true
+		_, ok, err := decodeValue(b)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			batch.Delete(k)
+		}
+	}
+	if batch.Len() == 0 {
+		return 0, nil
+	}
+	return batch.Len(), s.st.Write(batch)
+}
@@ -0,0 +1,162 @@
+package mvcc
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv"
+)
+
+/*
+Each version of a key is stored under its own key in the underlying
+store, made up of the key followed by the timestamp it was written
+at:
+
+	escaped key | 0x00 0x01 | ^timestamp (8 bytes, big endian)
+
+The key is escaped so that it never contains the terminator, 0x00
+bytes are written as 0x00 0xff and 0xff bytes as 0xff 0x00. This
+keeps the versions of a key together, sorted in the same order as
+the keys themselves, with no key's versions mixed in with those of
+a key it's a prefix of. The timestamp is inverted so that a key's
+versions sort newest first, which lets a reader stop at the first
+version it's allowed to see.
+
+Since every escaped key is followed by 0x00 0x01, no versioned key
+starts with 0x00 0x00, which leaves room below them for the store's
+own metadata. Similarly none starts with 0xff 0xff, so keysEnd sorts
+after all of them.
+*/
+
+const (
+	escape     = 0x00
+	escaped00  = 0xff
+	escapeFF   = 0xff
+	escapedFF  = 0x00
+	terminator = "\x00\x01"
+	tsLen      = 8
+
+	// metaPrefix begins the keys of the store's own metadata.
+	metaPrefix = "\x00\x00"
+	// clockKey holds the timestamp of the last commit.
+	clockKey = metaPrefix + "clock"
+	// keysEnd sorts after every versioned key.
+	keysEnd = "\xff\xff"
+)
+
+var errMalformedKey = errors.New("malformed versioned key")
+
+// EncodeKey returns the key a version of key written at ts is stored
+// under.
+func EncodeKey(key string, ts uint64) string {
+	b := make([]byte, 0, len(key)+len(terminator)+tsLen)
+	b = appendEscaped(b, key)
+	b = append(b, terminator...)
+	b = binary.BigEndian.AppendUint64(b, ^ts)
+	return string(b)
+}
+
+// DecodeKey is the inverse of EncodeKey.
+func DecodeKey(k string) (string, uint64, error) {
+	var key strings.Builder
+	for i := 0; i < len(k); i++ {
+		c := k[i]
+		if c != escape && c != escapeFF {
+			key.WriteByte(c)
+			continue
+		}
+		if i+1 == len(k) {
+			return "", 0, errMalformedKey
+		}
+		i++
+		switch {
+		case c == escape && k[i] == escaped00:
+			key.WriteByte(0x00)
+		case c == escapeFF && k[i] == escapedFF:
+			key.WriteByte(0xff)
+		case c == escape && k[i] == terminator[1]:
+			if len(k)-i-1 != tsLen {
+				return "", 0, errMalformedKey
+			}
+			ts := ^binary.BigEndian.Uint64([]byte(k[i+1:]))
+			return key.String(), ts, nil
+		default:
+			return "", 0, errMalformedKey
+		}
+	}
+	return "", 0, errMalformedKey
+}
+
+// versionPrefix is the prefix shared by every version of key.
+func versionPrefix(key string) string {
+	b := make([]byte, 0, len(key)+len(terminator))
+	b = appendEscaped(b, key)
+	return string(append(b, terminator...))
+}
+
+// versionsEnd sorts after every version of key, and before the
+// versions of any other key.
+func versionsEnd(key string) string {
+	b := appendEscaped(nil, key)
+	return string(append(b, terminator[0], terminator[1]+1))
+}
+
+func appendEscaped(b []byte, key string) []byte {
+	for i := 0; i < len(key); i++ {
+		switch key[i] {
+		case 0x00:
+			b = append(b, escape, escaped00)
+		case 0xff:
+			b = append(b, escapeFF, escapedFF)
+		default:
+			b = append(b, key[i])
+		}
+	}
+	return b
+}
+
+// Versions are stored with a leading byte marking whether they hold
+// a value or record that the key was deleted.
+const (
+	kindValue byte = iota
+	kindTombstone
+)
+
+func encodeValue(op kv.BatchOp) []byte {
+	if op.Delete {
+		return []byte{kindTombstone}
+	}
+	b := make([]byte, 0, 1+len(op.Value))
+	b = append(b, kindValue)
+	return append(b, op.Value...)
+}
+
+var errMalformedValue = errors.New("malformed versioned value")
+
+// decodeValue returns the value held in a version, or nil if the
+// version is a tombstone.
+func decodeValue(b []byte) ([]byte, bool, error) {
+	if len(b) == 0 {
+		return nil, false, errMalformedValue
+	}
+	switch b[0] {
+	case kindValue:
+		return b[1:], true, nil
+	case kindTombstone:
+		return nil, false, nil
+	default:
+		return nil, false, errMalformedValue
+	}
+}
+
+func encodeTimestamp(ts uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, ts)
+}
+
+func decodeTimestamp(b []byte) (uint64, error) {
+	if len(b) != tsLen {
+		return 0, errMalformedValue
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
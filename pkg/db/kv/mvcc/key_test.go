@@ -0,0 +1,57 @@
+package mvcc_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/mvcc"
+	"github.com/angles-n-daemons/popsql/pkg/test/assert"
+)
+
+func TestEncodeKey(t *testing.T) {
+	for _, key := range []string{"", "a", "1/2", "a\x00b", "\xff", "\x00\x01", "a\xff\x00"} {
+		for _, ts := range []uint64{0, 1, 1 << 40, ^uint64(0)} {
+			k, decodedTS, err := mvcc.DecodeKey(mvcc.EncodeKey(key, ts))
+			assert.NoError(t, err)
+			assert.Equal(t, key, k)
+			assert.Equal(t, ts, decodedTS)
+		}
+	}
+}
+
+func TestEncodeKeyOrder(t *testing.T) {
+	// sorted by key, then newest first.
+	type version struct {
+		key string
+		ts  uint64
+	}
+	expected := []version{
+		{"", 2}, {"", 1},
+		{"\x00", 1},
+		{"\x00\x00", 1},
+		{"\x00\x01", 1},
+		{"a", 5}, {"a", 3}, {"a", 0},
+		{"a\x00", 9},
+		{"a\x00b", 1},
+		{"a\x01", 1},
+		{"ab", 1},
+		{"a\xff", 1},
+		{"a\xff\x00", 1},
+		{"b", 1},
+		{"\xff", 1},
+		{"\xff\xff", 1},
+	}
+	encoded := []string{}
+	for _, v := range expected {
+		encoded = append(encoded, mvcc.EncodeKey(v.key, v.ts))
+	}
+	assert.True(t, slices.IsSorted(encoded))
+}
+
+func TestDecodeKeyMalformed(t *testing.T) {
+	valid := mvcc.EncodeKey("a", 1)
+	for _, k := range []string{"", "a", valid[:len(valid)-1], valid + "x", "a\x00", "a\x00\x02", "a\xff\x01"} {
+		_, _, err := mvcc.DecodeKey(k)
+		assert.IsError(t, err, "malformed versioned key")
+	}
+}
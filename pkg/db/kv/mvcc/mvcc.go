@@ -0,0 +1,241 @@
+package mvcc
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/lock"
+)
+
+// Options are the tunable parameters of the Store.
+type Options struct {
+	// GCInterval is the number of commits between collections of
+	// old versions. If it's zero, old versions are only collected
+	// when GC is called.
+	GCInterval int
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		GCInterval: 1000,
+	}
+}
+
+/*
+Store keeps multiple versions of each key in an underlying kv.Store,
+each stamped with the timestamp of the commit which wrote it. Every
+call to Write is a commit, which advances the store's clock by one
+and writes its batch as new versions at that timestamp, leaving the
+older versions in place.
+
+Readers open a Snapshot at a timestamp, and see the newest version
+of each key written at or before it. Since a snapshot never sees
+writes committed after it was opened, it reads a consistent, point
+in time view of the store no matter what's written meanwhile.
+
+Versions which no open snapshot can see any longer are removed by
+GC, which runs every GCInterval commits.
+*/
+type Store struct {
+	st   kv.Store
+	opts *Options
+
+	// commitMu is held while committing, so that only one commit
+	// happens at a time.
+	commitMu sync.Mutex
+	commits  int
+	// gcMu is held while collecting. Collections don't hold commitMu,
+	// since the versions they remove are all older than any a commit
+	// writes, so commits carry on while the store is scanned.
+	gcMu sync.Mutex
+	// recent holds the keys written by each commit which a running
+	// transaction may need to be validated against.
+	recent []commitRecord
+
+	// locks holds the locks taken by transactions, which are numbered
+	// in the order they began by txns.
+	locks *lock.Manager
+	txns  atomic.Uint64
+
+	// mu guards the fields below it.
+	mu sync.Mutex
+	// clock is the timestamp of the last commit.
+	clock uint64
+	// snapshots counts the open snapshots at each timestamp.
+	snapshots map[uint64]int
+	// horizon is the oldest timestamp a snapshot can be opened at.
+	// Versions which only older snapshots could see may have been
+	// collected.
+	horizon uint64
+}
+
+// NewStore opens a Store over st, picking the clock up from where
+// it was left if st has been written to before.
+func NewStore(st kv.Store, opts *Options) (*Store, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	b, err := st.Get(clockKey)
+	if err != nil {
+		return nil, err
+	}
+	var clock uint64
+	if b != nil {
+		if clock, err = decodeTimestamp(b); err != nil {
+			return nil, fmt.Errorf("failed to read the clock: %w", err)
+		}
+	}
+	return &Store{
+		st:        st,
+		opts:      opts,
+		clock:     clock,
+		snapshots: map[uint64]int{},
+		locks:     lock.NewManager(),
+		// the history from before the store was opened may have been
+		// collected by a snapshot that's no longer open.
+		horizon: clock,
+	}, nil
+}
+
+// Now returns the timestamp of the last commit.
+func (s *Store) Now() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clock
+}
+
+// Snapshot opens a snapshot of the latest commit.
+func (s *Store) Snapshot() *Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.openSnapshot(s.clock)
+}
+
+// SnapshotAt opens a snapshot of the store as it was at ts. It fails
+// if ts is in the future, or if the versions it would read may have
+// been collected.
+func (s *Store) SnapshotAt(ts uint64) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ts > s.clock {
+		return nil, fmt.Errorf("cannot open a snapshot at %d, the latest commit is %d", ts, s.clock)
+	}
+	if ts < s.horizon {
+		return nil, fmt.Errorf("cannot open a snapshot at %d, versions before %d may have been collected", ts, s.horizon)
+	}
+	return s.openSnapshot(ts), nil
+}
+
+func (s *Store) openSnapshot(ts uint64) *Snapshot {
+	s.snapshots[ts]++
+	return &Snapshot{s: s, ts: ts}
+}
+
+func (s *Store) release(ts uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshots[ts]--
+	if s.snapshots[ts] == 0 {
+		delete(s.snapshots, ts)
+	}
+}
+
+// Get reads the latest version of a key.
+func (s *Store) Get(k string) ([]byte, error) {
+	snap := s.Snapshot()
+	defer snap.Close()
+	return snap.Get(k)
+}
+
+// Scan reads the latest version of each key in the range, from a
+// snapshot which stays open until the cursor reaches its end or is
+// closed.
+func (s *Store) Scan(start, end string) (kv.Cursor, error) {
+	snap := s.Snapshot()
+	c, err := snap.Scan(start, end)
+	if err != nil {
+		snap.Close()
+		return nil, err
+	}
+	c.(*Cursor).snap = snap
+	return c, nil
+}
+
+func (s *Store) Put(k string, v []byte) error {
+	batch := kv.NewWriteBatch()
+	batch.Put(k, v)
+	return s.Write(batch)
+}
+
+// Delete writes a tombstone as the newest version of the key, which
+// hides its older versions from snapshots opened after it.
+func (s *Store) Delete(k string) error {
+	batch := kv.NewWriteBatch()
+	batch.Delete(k)
+	return s.Write(batch)
+}
+
+func (s *Store) Write(batch *kv.WriteBatch) error {
+	_, err := s.Commit(batch)
+	return err
+}
+
+// Commit writes the batch as new versions of its keys, stamped with
+// the next timestamp on the clock, which it returns. The new clock
+// is written in the same batch, so it survives a restart along with
+// the versions.
+func (s *Store) Commit(batch *kv.WriteBatch) (uint64, error) {
+	s.commitMu.Lock()
+	ts, collect, err := s.commit(batch)
+	s.commitMu.Unlock()
+	if collect {
+		s.autoGC()
+	}
+	return ts, err
+}
+
+// commit writes the batch, returning its timestamp and whether a
+// collection is due. It must be called with commitMu held, and the
+// collection run once it's released.
+func (s *Store) commit(batch *kv.WriteBatch) (uint64, bool, error) {
+	ts := s.Now() + 1
+	versions := kv.NewWriteBatch()
+	for _, op := range batch.Ops {
+		versions.Put(EncodeKey(op.Key, ts), encodeValue(op))
+	}
+	versions.Put(clockKey, encodeTimestamp(ts))
+	if err := s.st.Write(versions); err != nil {
+		return 0, false, err
+	}
+
+	s.mu.Lock()
+	s.clock = ts
+	s.mu.Unlock()
+	s.record(ts, batch)
+
+	s.commits++
+	return ts, s.opts.GCInterval > 0 && s.commits%s.opts.GCInterval == 0, nil
+}
+
+// autoGC runs the collection due every GCInterval commits, unless
+// one is already running. A failed collection deletes nothing, since
+// its deletes are written in one batch, so the versions are left to
+// be collected next time.
+func (s *Store) autoGC() {
+	if !s.gcMu.TryLock() {
+		return
+	}
+	defer s.gcMu.Unlock()
+	_, _ = s.gc()
+}
+
+// Close closes the underlying store, if it needs closing.
+func (s *Store) Close() error {
+	if c, ok := s.st.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package mvcc_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/mvcc"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/lsm"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/memtable"
+	"github.com/angles-n-daemons/popsql/pkg/test/assert"
+)
+
+func key(i int) string {
+	return fmt.Sprintf("key%04d", i)
+}
+
+func newStore(t *testing.T) (*mvcc.Store, *memtable.Memstore) {
+	raw := memtable.NewStore()
+	st, err := mvcc.NewStore(raw, &mvcc.Options{})
+	assert.NoError(t, err)
+	return st, raw
+}
+
+// countVersions returns the number of versions held in the
+// underlying store.
+func countVersions(t *testing.T, raw kv.Store) int {
+	cur, err := raw.Scan(mvcc.EncodeKey("", ^uint64(0)), "\xff\xff")
+	assert.NoError(t, err)
+	vals, err := cur.ReadAll()
+	assert.NoError(t, err)
+	return len(vals)
+}
+
+func readAll(t *testing.T, r kv.Reader, start, end string) []string {
+	cur, err := r.Scan(start, end)
+	assert.NoError(t, err)
+	vals, err := cur.ReadAll()
+	assert.NoError(t, err)
+	actual := []string{}
+	for _, v := range vals {
+		actual = append(actual, string(v))
+	}
+	return actual
+}
+
+func TestStoreGetPut(t *testing.T) {
+	st, _ := newStore(t)
+	assert.NoError(t, st.Put("a", []byte("1")))
+	assert.NoError(t, st.Put("a", []byte("2")))
+	assert.NoError(t, st.Put("b", []byte("3")))
+	assert.Equal(t, uint64(3), st.Now())
+
+	val, err := st.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", string(val))
+	val, err = st.Get("missing")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+
+	assert.NoError(t, st.Delete("a"))
+	val, err = st.Get("a")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+	assert.Equal(t, []string{"3"}, readAll(t, st, "", "z"))
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	st, _ := newStore(t)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, st.Put(key(i), []byte("old")))
+	}
+	snap := st.Snapshot()
+	defer snap.Close()
+
+	batch := kv.NewWriteBatch()
+	batch.Put(key(0), []byte("new"))
+	batch.Delete(key(1))
+	batch.Put(key(10), []byte("new"))
+	assert.NoError(t, st.Write(batch))
+
+	// the snapshot doesn't see the batch.
+	val, err := snap.Get(key(0))
+	assert.NoError(t, err)
+	assert.Equal(t, "old", string(val))
+	val, err = snap.Get(key(1))
+	assert.NoError(t, err)
+	assert.Equal(t, "old", string(val))
+	val, err = snap.Get(key(10))
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+	assert.Equal(t, 10, len(readAll(t, snap, key(0), key(99))))
+
+	// but the store does.
+	val, err = st.Get(key(0))
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(val))
+	val, err = st.Get(key(1))
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+	assert.Equal(t, 10, len(readAll(t, st, key(0), key(99))))
+}
+
+func TestSnapshotScanWhileWriting(t *testing.T) {
+	st, _ := newStore(t)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, st.Put(key(i), []byte(key(i))))
+	}
+	snap := st.Snapshot()
+	defer snap.Close()
+	cur, err := snap.Scan(key(0), key(99))
+	assert.NoError(t, err)
+
+	// copying each row to a new key as it's read, which would never
+	// finish if the cursor saw the copies.
+	count := 0
+	for !cur.IsAtEnd() {
+		k := cur.Key()
+		val, err := cur.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, k, string(val))
+		assert.NoError(t, st.Put(key(count+10), []byte(key(count+10))))
+		// and overwriting one which is yet to be read.
+		assert.NoError(t, st.Put(key(9), []byte("changed")))
+		count++
+	}
+	assert.Equal(t, 10, count)
+	assert.Equal(t, 20, len(readAll(t, st, key(0), key(99))))
+}
+
+func TestSnapshotAt(t *testing.T) {
+	st, _ := newStore(t)
+	for i := 1; i <= 5; i++ {
+		assert.NoError(t, st.Put("a", []byte(fmt.Sprint(i))))
+	}
+	for ts := uint64(1); ts <= 5; ts++ {
+		snap, err := st.SnapshotAt(ts)
+		assert.NoError(t, err)
+		assert.Equal(t, ts, snap.Timestamp())
+		val, err := snap.Get("a")
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprint(ts), string(val))
+		snap.Close()
+	}
+
+	snap, err := st.SnapshotAt(0)
+	assert.NoError(t, err)
+	val, err := snap.Get("a")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+	snap.Close()
+
+	_, err = st.SnapshotAt(6)
+	assert.IsError(t, err, "cannot open a snapshot at 6, the latest commit is 5")
+}
+
+func TestGC(t *testing.T) {
+	st, raw := newStore(t)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 10; j++ {
+			assert.NoError(t, st.Put(key(j), []byte(fmt.Sprint(i))))
+		}
+	}
+	assert.NoError(t, st.Delete(key(0)))
+	assert.Equal(t, 31, countVersions(t, raw))
+
+	// an open snapshot keeps the versions it can see.
+	snap, err := st.SnapshotAt(10)
+	assert.NoError(t, err)
+	removed, err := st.GC()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	snap.Close()
+
+	// the snapshot at 20 keeps the second round of writes.
+	snap, err = st.SnapshotAt(20)
+	assert.NoError(t, err)
+	removed, err = st.GC()
+	assert.NoError(t, err)
+	assert.Equal(t, 10, removed)
+	assert.Equal(t, []string{"1", "1", "1"}, readAll(t, snap, key(0), key(3)))
+	snap.Close()
+
+	_, err = st.SnapshotAt(19)
+	assert.IsError(t, err, "cannot open a snapshot at 19, versions before 20 may have been collected")
+
+	// with no snapshots open only the latest versions are kept, and
+	// the deleted key is gone entirely.
+	removed, err = st.GC()
+	assert.NoError(t, err)
+	assert.Equal(t, 12, removed)
+	assert.Equal(t, 9, countVersions(t, raw))
+	val, err := st.Get(key(0))
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+	assert.Equal(t, []string{"2", "2"}, readAll(t, st, key(0), key(3)))
+}
+
+func TestAutomaticGC(t *testing.T) {
+	raw := memtable.NewStore()
+	st, err := mvcc.NewStore(raw, &mvcc.Options{GCInterval: 10})
+	assert.NoError(t, err)
+	for i := 0; i < 25; i++ {
+		assert.NoError(t, st.Put("a", []byte(fmt.Sprint(i))))
+	}
+	// collected after the 20th write, leaving it and the 5 after.
+	assert.Equal(t, 6, countVersions(t, raw))
+}
+
+func TestStoreScanReleasesSnapshot(t *testing.T) {
+	st, raw := newStore(t)
+	assert.NoError(t, st.Put("a", []byte("1")))
+	assert.NoError(t, st.Put("a", []byte("2")))
+
+	cur, err := st.Scan("a", "b")
+	assert.NoError(t, err)
+	assert.NoError(t, st.Put("a", []byte("3")))
+	_, err = st.GC()
+	assert.NoError(t, err)
+	// the cursor's snapshot keeps the version it reads.
+	assert.Equal(t, 2, countVersions(t, raw))
+	val, err := cur.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "2", string(val))
+
+	// once it's at its end, the snapshot is released.
+	assert.True(t, cur.IsAtEnd())
+	_, err = st.GC()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, countVersions(t, raw))
+}
+
+func TestStoreScanCloseReleasesSnapshot(t *testing.T) {
+	st, raw := newStore(t)
+	assert.NoError(t, st.Put("a", []byte("1")))
+	assert.NoError(t, st.Put("b", []byte("1")))
+
+	// a cursor which stops before its end holds its snapshot until
+	// it's closed.
+	cur, err := st.Scan("a", "c")
+	assert.NoError(t, err)
+	_, err = cur.Next()
+	assert.NoError(t, err)
+	assert.NoError(t, st.Put("a", []byte("2")))
+	_, err = st.GC()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, countVersions(t, raw))
+
+	assert.NoError(t, cur.Close())
+	assert.True(t, cur.IsAtEnd())
+	_, err = st.GC()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, countVersions(t, raw))
+	// closing it again does nothing.
+	assert.NoError(t, cur.Close())
+}
+
+func TestGCWhileCommitting(t *testing.T) {
+	st, raw := newStore(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			_, err := st.GC()
+			assert.NoError(t, err)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		for j := 0; j < 10; j++ {
+			assert.NoError(t, st.Put(key(j), []byte(fmt.Sprint(i))))
+		}
+	}
+	<-done
+	_, err := st.GC()
+	assert.NoError(t, err)
+	assert.Equal(t, 10, countVersions(t, raw))
+	for _, v := range readAll(t, st, key(0), key(10)) {
+		assert.Equal(t, "49", v)
+	}
+}
+
+func TestStoreReopen(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "lsm")
+	raw, err := lsm.NewStore(dir, nil)
+	assert.NoError(t, err)
+	st, err := mvcc.NewStore(raw, nil)
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, st.Put(key(i), []byte(key(i))))
+	}
+	assert.NoError(t, st.Close())
+
+	raw, err = lsm.NewStore(dir, nil)
+	assert.NoError(t, err)
+	st, err = mvcc.NewStore(raw, nil)
+	assert.NoError(t, err)
+	defer st.Close()
+	// the clock carries on from where it was left.
+	assert.Equal(t, uint64(10), st.Now())
+	assert.Equal(t, 10, len(readAll(t, st, key(0), key(99))))
+	assert.NoError(t, st.Put(key(0), []byte("new")))
+	assert.Equal(t, uint64(11), st.Now())
+	val, err := st.Get(key(0))
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(val))
+}
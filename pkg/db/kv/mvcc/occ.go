@@ -0,0 +1,71 @@
+package mvcc
+
+import (
+	"errors"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv"
+)
+
+// ErrConflict is returned when a transaction can't commit because a
+// transaction which committed after it began wrote something it
+// depended on. It can be retried from the start.
+var ErrConflict = errors.New("could not serialize access due to a concurrent update")
+
+// commitRecord is the set of keys written by a commit.
+type commitRecord struct {
+	ts   uint64
+	keys []string
+}
+
+type keyRange struct {
+	start, end string
+}
+
+func (r keyRange) contains(key string) bool {
+	return r.start <= key && key < r.end
+}
+
+// record keeps the keys written by a commit, for as long as there's
+// a transaction which began before it. It must be called with
+// commitMu held.
+func (s *Store) record(ts uint64, batch *kv.WriteBatch) {
+	s.mu.Lock()
+	oldest := s.clock
+	for snap := range s.snapshots {
+		oldest = min(oldest, snap)
+	}
+	s.mu.Unlock()
+
+	// transactions only validate against the commits made after their
+	// snapshot, so a commit at or below every open snapshot is no
+	// longer needed.
+	i := 0
+	for i < len(s.recent) && s.recent[i].ts <= oldest {
+		i++
+	}
+	s.recent = s.recent[i:]
+	if ts <= oldest {
+		return
+	}
+	keys := make([]string, len(batch.Ops))
+	for i, op := range batch.Ops {
+		keys[i] = op.Key
+	}
+	s.recent = append(s.recent, commitRecord{ts: ts, keys: keys})
+}
+
+// validate checks that no commit made since the transaction began
+// conflicts with it. It must be called with commitMu held.
+func (t *Txn) validate() error {
+	for _, c := range t.s.recent {
+		if c.ts <= t.Timestamp() {
+			continue
+		}
+		for _, key := range c.keys {
+			if t.conflicts(key) {
+				return ErrConflict
+			}
+		}
+	}
+	return nil
+}
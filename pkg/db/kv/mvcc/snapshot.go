@@ -0,0 +1,179 @@
+package mvcc
+
+import (
+	"math"
+	"strings"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv"
+)
+
+// Snapshot is a read only view of the store as of a timestamp. The
+// versions it reads are kept from being collected until it's closed.
+type Snapshot struct {
+	s      *Store
+	ts     uint64
+	closed bool
+}
+
+// Timestamp returns the timestamp the snapshot reads at.
+func (sn *Snapshot) Timestamp() uint64 {
+	return sn.ts
+}
+
+// Get returns the newest version of the key written at or before
+// the snapshot's timestamp, or nil if there isn't one or it's a
+// tombstone.
+func (sn *Snapshot) Get(k string) ([]byte, error) {
+	// every version of the key which the snapshot can see, newest
+	// first.
+	cur, err := sn.s.st.Scan(EncodeKey(k, sn.ts), versionsEnd(k))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close()
+	b, err := cur.Next()
+	if err != nil || b == nil {
+		return nil, err
+	}
+	v, _, err := decodeValue(b)
+	return v, err
+}
+
+// Scan returns a cursor over the newest version of each key in the
+// range which was written at or before the snapshot's timestamp.
+func (sn *Snapshot) Scan(start, end string) (kv.Cursor, error) {
+	cur, err := sn.s.st.Scan(EncodeKey(start, math.MaxUint64), EncodeKey(end, math.MaxUint64))
+	if err != nil {
+		return nil, err
+	}
+	return &Cursor{cur: cur, ts: sn.ts}, nil
+}
+
+// Close releases the snapshot, after which the versions only it
+// could see may be collected.
+func (sn *Snapshot) Close() {
+	if sn.closed {
+		return
+	}
+	sn.closed = true
+	sn.s.release(sn.ts)
+}
+
+// Cursor is the kv.Cursor returned by a scan of a snapshot. It
+// reads the versions of each key from newest to oldest, returning
+// the first one visible to the snapshot and skipping the rest.
+type Cursor struct {
+	cur kv.Cursor
+	ts  uint64
+	// snap is closed along with the cursor, if the cursor was opened
+	// with its own snapshot by Store.Scan.
+	snap *Snapshot
+
+	// key and val are the next visible entry, once found by fill.
+	key    string
+	val    []byte
+	filled bool
+	done   bool
+}
+
+func (c *Cursor) ReadAll() ([][]byte, error) {
+	return c.Read(math.MaxInt)
+}
+
+func (c *Cursor) Read(num int) ([][]byte, error) {
+	vals := [][]byte{}
+	for i := 0; i < num; i++ {
+		val, err := c.Next()
+		if err != nil {
+			return nil, err
+		}
+		if val == nil {
+			break
+		}
+		vals = append(vals, val)
+	}
+	return vals, nil
+}
+
+func (c *Cursor) Next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+	if c.done {
+		return nil, nil
+	}
+	c.filled = false
+	return c.val, nil
+}
+
+func (c *Cursor) IsAtEnd() bool {
+	if c.fill() != nil {
+		return true
+	}
+	return c.done
+}
+
+func (c *Cursor) Key() string {
+	if c.IsAtEnd() {
+		return ""
+	}
+	return c.key
+}
+
+// Close closes the underlying cursor and the cursor's own snapshot,
+// if it has one. It's called once the cursor reaches its end, so it
+// only has to be called by readers which stop before then.
+func (c *Cursor) Close() error {
+	if c.done {
+		return nil
+	}
+	c.done, c.filled = true, false
+	if c.snap != nil {
+		c.snap.Close()
+	}
+	return c.cur.Close()
+}
+
+// fill moves the underlying cursor on to the next key with a value
+// visible to the snapshot, skipping newer versions, older versions
+// and tombstones.
+func (c *Cursor) fill() error {
+	for !c.filled && !c.done {
+		if c.cur.IsAtEnd() {
+			return c.Close()
+		}
+		key, ts, err := DecodeKey(c.cur.Key())
+		if err != nil {
+			return err
+		}
+		b, err := c.cur.Next()
+		if err != nil {
+			return err
+		}
+		if ts > c.ts {
+			continue
+		}
+		if err = c.skipVersions(key); err != nil {
+			return err
+		}
+		val, ok, err := decodeValue(b)
+		if err != nil {
+			return err
+		}
+		if ok {
+			c.key, c.val, c.filled = key, val, true
+		}
+	}
+	return nil
+}
+
+// skipVersions moves past the remaining, older versions of key.
+func (c *Cursor) skipVersions(key string) error {
+	prefix := versionPrefix(key)
+	for !c.cur.IsAtEnd() && strings.HasPrefix(c.cur.Key(), prefix) {
+		if _, err := c.cur.Next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package mvcc
+
+import (
+	"errors"
+	"math"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/keys"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/lock"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/memtable"
+)
+
+var errTxnDone = errors.New("transaction has already been committed or rolled back")
+
+/*
+Txn is a transaction over the store. It reads from a snapshot taken
+when it begins, and buffers its writes until it's committed, when
+they're written together as a single commit. Until then they're only
+visible to the transaction itself, whose reads see its own writes
+over the top of its snapshot.
+
+A transaction can also lock keys, which it holds until it ends. Where
+many transactions contend for the same rows, locking them up front
+makes the transactions queue for them, rather than failing to commit
+and retrying over and over.
+*/
+type Txn struct {
+	s    *Store
+	id   uint64
+	snap *Snapshot
+	// writes holds the latest write to each key, in key order so that
+	// it can be merged into scans.
+	writes *memtable.Skiplist[string, kv.BatchOp]
+	// reads holds the keys the transaction has read, and ranges the
+	// spans it has scanned, which are validated when it commits.
+	reads  map[string]struct{}
+	ranges []keyRange
+	locked bool
+	done   bool
+	// onCommit is run once the transaction commits.
+	onCommit []func()
+}
+
+// Begin starts a transaction reading from the latest commit.
+func (s *Store) Begin() *Txn {
+	return &Txn{
+		s:      s,
+		id:     s.txns.Add(1),
+		snap:   s.Snapshot(),
+		writes: memtable.NewSkiplist[string, kv.BatchOp](),
+		reads:  map[string]struct{}{},
+	}
+}
+
+// Timestamp returns the timestamp of the snapshot the transaction
+// reads from.
+func (t *Txn) Timestamp() uint64 {
+	return t.snap.Timestamp()
+}
+
+// ID returns the number identifying the transaction, which is higher
+// for transactions which began later.
+func (t *Txn) ID() uint64 {
+	return t.id
+}
+
+// Store returns the store the transaction runs over.
+func (t *Txn) Store() *Store {
+	return t.s
+}
+
+// Len returns the number of keys the transaction has written.
+func (t *Txn) Len() int {
+	return int(t.writes.Size())
+}
+
+func (t *Txn) Get(k string) ([]byte, error) {
+	if t.done {
+		return nil, errTxnDone
+	}
+	if node := t.writes.Get(k); node != nil {
+		return node.Val().Value, nil
+	}
+	t.reads[k] = struct{}{}
+	return t.snap.Get(k)
+}
+
+// Scan returns a cursor over the transaction's snapshot, with its
+// own writes merged in. Writes made after the cursor is opened may
+// or may not be seen by it.
+func (t *Txn) Scan(start, end string) (kv.Cursor, error) {
+	if t.done {
+		return nil, errTxnDone
+	}
+	cur, err := t.snap.Scan(start, end)
+	if err != nil {
+		return nil, err
+	}
+	t.ranges = append(t.ranges, keyRange{start, end})
+	return &txnCursor{cur: cur, node: t.writes.Seek(start), end: end}, nil
+}
+
+func (t *Txn) Put(k string, v []byte) error {
+	return t.write(kv.BatchOp{Key: k, Value: v})
+}
+
+func (t *Txn) Delete(k string) error {
+	return t.write(kv.BatchOp{Key: k, Delete: true})
+}
+
+// Write adds every write in the batch to the transaction.
+func (t *Txn) Write(batch *kv.WriteBatch) error {
+	for _, op := range batch.Ops {
+		if err := t.write(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Txn) write(op kv.BatchOp) error {
+	if t.done {
+		return errTxnDone
+	}
+	_, err := t.writes.Put(op.Key, op)
+	return err
+}
+
+// Commit writes the transaction's writes to the store as a single
+// commit, returning its timestamp. The transaction is over once
+// Commit returns, whether or not it succeeded.
+//
+// Transactions are serializable. Before committing, the transaction
+// is validated against every commit made since its snapshot was
+// taken. If any of them wrote a key the transaction read, scanned
+// over or wrote itself, the transaction would have seen a different
+// store had it run after them, so it fails with ErrConflict instead.
+// A transaction which wrote nothing has nothing to validate, since
+// its snapshot is a consistent view of the store.
+func (t *Txn) Commit() (uint64, error) {
+	if t.done {
+		return 0, errTxnDone
+	}
+	defer t.Rollback()
+	if t.Len() == 0 {
+		t.committed()
+		return t.Timestamp(), nil
+	}
+	batch := kv.NewWriteBatch()
+	for node := t.writes.Head(); node != nil; node = node.Next() {
+		batch.Ops = append(batch.Ops, node.Val())
+	}
+
+	t.s.commitMu.Lock()
+	if err := t.validate(); err != nil {
+		t.s.commitMu.Unlock()
+		return 0, err
+	}
+	ts, collect, err := t.s.commit(batch)
+	t.s.commitMu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	t.committed()
+	if collect {
+		// the transaction's snapshot and locks are released first,
+		// so that neither is held while the store is collected.
+		t.Rollback()
+		t.s.autoGC()
+	}
+	return ts, nil
+}
+
+// OnCommit adds a function to be run once the transaction commits,
+// before its locks are released. It isn't run if the transaction
+// fails to commit or is rolled back.
+func (t *Txn) OnCommit(f func()) {
+	t.onCommit = append(t.onCommit, f)
+}
+
+func (t *Txn) committed() {
+	for _, f := range t.onCommit {
+		f()
+	}
+}
+
+// Lock locks the key in the given mode until the transaction ends,
+// waiting for any conflicting locks held by other transactions to be
+// released. If waiting would deadlock, the transaction may be chosen
+// to fail with lock.ErrDeadlock, and should then be rolled back.
+func (t *Txn) Lock(key *keys.Key, mode lock.Mode) error {
+	if t.done {
+		return errTxnDone
+	}
+	t.locked = true
+	return t.s.locks.Acquire(t.id, key, mode)
+}
+
+// Refresh moves the transaction's snapshot up to the latest commit,
+// so that it reads the rows it has just locked as they are now. It's
+// validated first, as it would be on commit, since the move is only
+// safe if nothing the transaction has done would have differed had
+// it begun at the latest commit. If something would, Refresh fails
+// with ErrConflict.
+func (t *Txn) Refresh() error {
+	if t.done {
+		return errTxnDone
+	}
+	t.s.commitMu.Lock()
+	defer t.s.commitMu.Unlock()
+	if err := t.validate(); err != nil {
+		return err
+	}
+	old := t.snap
+	t.snap = t.s.Snapshot()
+	old.Close()
+	return nil
+}
+
+// conflicts returns whether a key written by another transaction
+// would have been seen by this one.
+func (t *Txn) conflicts(key string) bool {
+	if _, ok := t.reads[key]; ok {
+		return true
+	}
+	if t.writes.Get(key) != nil {
+		return true
+	}
+	for _, r := range t.ranges {
+		if r.contains(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rollback discards the transaction's writes and releases its
+// snapshot and locks. Rolling back a transaction which is already
+// over does nothing.
+func (t *Txn) Rollback() {
+	if t.done {
+		return
+	}
+	t.done = true
+	t.snap.Close()
+	if t.locked {
+		t.s.locks.Release(t.id)
+	}
+}
+
+// txnCursor merges a transaction's writes into a cursor over its
+// snapshot. Where both have a key, the transaction's write wins.
+type txnCursor struct {
+	cur  kv.Cursor
+	node *memtable.SkiplistNode[string, kv.BatchOp]
+	end  string
+
+	// key and val are the next entry, once found by fill.
+	key    string
+	val    []byte
+	filled bool
+	done   bool
+}
+
+func (c *txnCursor) ReadAll() ([][]byte, error) {
+	return c.Read(math.MaxInt)
+}
+
+func (c *txnCursor) Read(num int) ([][]byte, error) {
+	vals := [][]byte{}
+	for i := 0; i < num; i++ {
+		val, err := c.Next()
+		if err != nil {
+			return nil, err
+		}
+		if val == nil {
+			break
+		}
+		vals = append(vals, val)
+	}
+	return vals, nil
+}
+
+func (c *txnCursor) Next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+	if c.done {
+		return nil, nil
+	}
+	c.filled = false
+	return c.val, nil
+}
+
+func (c *txnCursor) IsAtEnd() bool {
+	if c.fill() != nil {
+		return true
+	}
+	return c.done
+}
+
+func (c *txnCursor) Key() string {
+	if c.IsAtEnd() {
+		return ""
+	}
+	return c.key
+}
+
+// Close closes the cursor over the snapshot.
+func (c *txnCursor) Close() error {
+	c.done, c.filled = true, false
+	return c.cur.Close()
+}
+
+func (c *txnCursor) fill() error {
+	for !c.filled && !c.done {
+		writesDone := c.node == nil || c.end <= c.node.Key
+		if writesDone && c.cur.IsAtEnd() {
+			c.done = true
+			return nil
+		}
+		// take the snapshot's entry if it comes first.
+		if writesDone || !c.cur.IsAtEnd() && c.cur.Key() < c.node.Key {
+			c.key = c.cur.Key()
+			val, err := c.cur.Next()
+			if err != nil {
+				return err
+			}
+			c.val, c.filled = val, true
+			continue
+		}
+		// otherwise the write shadows the snapshot's entry for the
+		// same key, if there is one.
+		op := c.node.Val()
+		c.node = c.node.Next()
+		if !c.cur.IsAtEnd() && c.cur.Key() == op.Key {
+			if _, err := c.cur.Next(); err != nil {
+				return err
+			}
+		}
+		if !op.Delete {
+			c.key, c.val, c.filled = op.Key, op.Value, true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package mvcc_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/keys"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/lock"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/mvcc"
+	"github.com/angles-n-daemons/popsql/pkg/test/assert"
+)
+
+func TestTxnReadsOwnWrites(t *testing.T) {
+	st, _ := newStore(t)
+	for i := 0; i < 10; i += 2 {
+		assert.NoError(t, st.Put(key(i), []byte("old")))
+	}
+
+	txn := st.Begin()
+	assert.NoError(t, txn.Put(key(1), []byte("new")))
+	assert.NoError(t, txn.Put(key(2), []byte("new")))
+	assert.NoError(t, txn.Delete(key(4)))
+	assert.NoError(t, txn.Put(key(9), []byte("new")))
+	assert.NoError(t, txn.Put(key(10), []byte("new")))
+	assert.Equal(t, 5, txn.Len())
+
+	val, err := txn.Get(key(2))
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(val))
+	val, err = txn.Get(key(4))
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+	val, err = txn.Get(key(6))
+	assert.NoError(t, err)
+	assert.Equal(t, "old", string(val))
+
+	// the writes are merged into scans, but the end of the range
+	// still applies to them.
+	cur, err := txn.Scan(key(0), key(10))
+	assert.NoError(t, err)
+	keys := []string{}
+	for !cur.IsAtEnd() {
+		keys = append(keys, cur.Key())
+		_, err := cur.Next()
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{key(0), key(1), key(2), key(6), key(8), key(9)}, keys)
+	assert.Equal(t, []string{"old", "new", "new", "old", "old", "new"}, readAll(t, txn, key(0), key(10)))
+
+	// no one else sees the writes until they're committed.
+	assert.Equal(t, 5, len(readAll(t, st, key(0), key(99))))
+	ts, err := txn.Commit()
+	assert.NoError(t, err)
+	assert.Equal(t, st.Now(), ts)
+	assert.Equal(t, []string{"old", "new", "new", "old", "old", "new", "new"}, readAll(t, st, key(0), key(99)))
+}
+
+func TestTxnRollback(t *testing.T) {
+	st, _ := newStore(t)
+	assert.NoError(t, st.Put("a", []byte("1")))
+	txn := st.Begin()
+	assert.NoError(t, txn.Put("a", []byte("2")))
+	txn.Rollback()
+
+	val, err := st.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", string(val))
+
+	// the transaction can't be used once it's over.
+	_, err = txn.Get("a")
+	assert.IsError(t, err, "transaction has already been committed or rolled back")
+	assert.IsError(t, txn.Put("a", nil), "transaction has already been committed or rolled back")
+	_, err = txn.Commit()
+	assert.IsError(t, err, "transaction has already been committed or rolled back")
+}
+
+func TestTxnSnapshot(t *testing.T) {
+	st, _ := newStore(t)
+	assert.NoError(t, st.Put("a", []byte("1")))
+	txn := st.Begin()
+	assert.NoError(t, st.Put("a", []byte("2")))
+	assert.NoError(t, st.Put("b", []byte("2")))
+
+	// the transaction reads from the commit it began at.
+	assert.Equal(t, []string{"1"}, readAll(t, txn, "a", "z"))
+	txn.Rollback()
+}
+
+func TestTxnWriteConflict(t *testing.T) {
+	st, _ := newStore(t)
+	first, second := st.Begin(), st.Begin()
+	assert.NoError(t, first.Put("a", []byte("1")))
+	assert.NoError(t, second.Put("a", []byte("2")))
+	_, err := first.Commit()
+	assert.NoError(t, err)
+	_, err = second.Commit()
+	assert.True(t, errors.Is(err, mvcc.ErrConflict))
+
+	val, err := st.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", string(val))
+}
+
+func TestTxnOnCommit(t *testing.T) {
+	st, _ := newStore(t)
+	key := keys.New("t").WithID("a")
+	first, second, third := st.Begin(), st.Begin(), st.Begin()
+	assert.NoError(t, first.Lock(key, lock.Exclusive))
+	locked := make(chan struct{})
+	go func() {
+		waiter := st.Begin()
+		assert.NoError(t, waiter.Lock(key, lock.Exclusive))
+		waiter.Rollback()
+		close(locked)
+	}()
+
+	committed := []string{}
+	first.OnCommit(func() {
+		// the transaction still holds its locks.
+		select {
+		case <-locked:
+			t.Fatal("expected the lock to be held")
+		default:
+		}
+		committed = append(committed, "first")
+	})
+	second.OnCommit(func() { committed = append(committed, "second") })
+	third.OnCommit(func() { committed = append(committed, "third") })
+
+	assert.NoError(t, first.Put("a", []byte("1")))
+	assert.NoError(t, second.Put("a", []byte("2")))
+	_, err := first.Commit()
+	assert.NoError(t, err)
+	<-locked
+	// neither a conflict nor a rollback runs it.
+	_, err = second.Commit()
+	assert.True(t, errors.Is(err, mvcc.ErrConflict))
+	third.Rollback()
+	assert.Equal(t, []string{"first"}, committed)
+}
+
+func TestTxnReadConflict(t *testing.T) {
+	st, _ := newStore(t)
+	assert.NoError(t, st.Put(key(1), []byte("old")))
+
+	// a key which was read is written by a later commit.
+	txn := st.Begin()
+	_, err := txn.Get(key(1))
+	assert.NoError(t, err)
+	assert.NoError(t, txn.Put(key(2), []byte("new")))
+	assert.NoError(t, st.Put(key(1), []byte("new")))
+	_, err = txn.Commit()
+	assert.True(t, errors.Is(err, mvcc.ErrConflict))
+
+	// a key is written into a range which was scanned, even though
+	// it wasn't there to be read.
+	txn = st.Begin()
+	readAll(t, txn, key(0), key(5))
+	assert.NoError(t, txn.Put(key(9), []byte("new")))
+	assert.NoError(t, st.Put(key(3), []byte("new")))
+	_, err = txn.Commit()
+	assert.True(t, errors.Is(err, mvcc.ErrConflict))
+}
+
+func TestTxnNoConflict(t *testing.T) {
+	st, _ := newStore(t)
+	first, second, reader := st.Begin(), st.Begin(), st.Begin()
+
+	// transactions which touch different keys both commit.
+	readAll(t, first, key(0), key(5))
+	assert.NoError(t, first.Put(key(1), []byte("first")))
+	_, err := second.Get(key(7))
+	assert.NoError(t, err)
+	assert.NoError(t, second.Put(key(6), []byte("second")))
+	readAll(t, reader, key(0), key(9))
+
+	_, err = first.Commit()
+	assert.NoError(t, err)
+	_, err = second.Commit()
+	assert.NoError(t, err)
+	// and a transaction which only read can always commit, since it
+	// saw a consistent snapshot.
+	_, err = reader.Commit()
+	assert.NoError(t, err)
+
+	// commits from before a transaction began don't conflict with it.
+	txn := st.Begin()
+	assert.NoError(t, txn.Put(key(1), []byte("third")))
+	_, err = txn.Commit()
+	assert.NoError(t, err)
+}
+
+func TestTxnLock(t *testing.T) {
+	st, _ := newStore(t)
+	row := keys.New("t").WithID("1")
+	assert.NoError(t, st.Put(row.Encode(), []byte("0")))
+
+	first, second := st.Begin(), st.Begin()
+	assert.NoError(t, first.Lock(row, lock.Exclusive))
+	locked := make(chan error, 1)
+	go func() {
+		locked <- second.Lock(row, lock.Exclusive)
+	}()
+
+	// the second transaction queues for the row until the first ends.
+	assert.NoError(t, first.Put(row.Encode(), []byte("1")))
+	_, err := first.Commit()
+	assert.NoError(t, err)
+	assert.NoError(t, <-locked)
+
+	// once refreshed, it reads the row as the first left it, and can
+	// write it without conflicting.
+	assert.NoError(t, second.Refresh())
+	val, err := second.Get(row.Encode())
+	assert.NoError(t, err)
+	assert.Equal(t, "1", string(val))
+	assert.NoError(t, second.Put(row.Encode(), []byte("2")))
+	_, err = second.Commit()
+	assert.NoError(t, err)
+}
+
+func TestTxnRefreshConflict(t *testing.T) {
+	st, _ := newStore(t)
+	txn := st.Begin()
+	_, err := txn.Get("a")
+	assert.NoError(t, err)
+	assert.NoError(t, st.Put("a", []byte("1")))
+
+	// the transaction read a key which has changed since.
+	assert.True(t, errors.Is(txn.Refresh(), mvcc.ErrConflict))
+}
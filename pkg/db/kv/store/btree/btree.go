@@ -0,0 +1,376 @@
+package btree
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/buffer"
+)
+
+// Options are the tunable parameters of the BTreeStore.
+type Options struct {
+	// CheckpointSize is the number of bytes the log grows to before
+	// the file is synced and the log is cleared.
+	CheckpointSize int64
+	// Pool caches the pages read from the file. It may be shared
+	// with other stores. If it's nil the store creates its own.
+	Pool *buffer.Pool
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		CheckpointSize: 4 << 20,
+	}
+}
+
+// BTreeStore is a B+tree kept in a single file of fixed size pages.
+// Values are stored in the leaves, which are linked together so
+// that a scan can walk from one to the next. Internal nodes hold
+// only keys and the pages of their children.
+type BTreeStore struct {
+	mu    sync.RWMutex
+	pager *pager
+}
+
+// NewStore opens the BTreeStore in the given directory, creating an
+// empty tree if there isn't one there already.
+func NewStore(dir string, opts *Options) (*BTreeStore, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	pool := opts.Pool
+	if pool == nil {
+		pool = buffer.NewPool(buffer.DefaultBudget, buffer.LRU)
+	}
+	p, err := openPager(dir, opts.CheckpointSize, pool)
+	if err != nil {
+		return nil, err
+	}
+	return &BTreeStore{pager: p}, nil
+}
+
+func (s *BTreeStore) node(id uint32) (*node, error) {
+	var n *node
+	err := s.pager.view(id, func(b []byte) error {
+		var err error
+		n, err = decodeNode(id, b)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read page %d: %w", id, err)
+	}
+	return n, nil
+}
+
+func (s *BTreeStore) writeNode(n *node) {
+	s.pager.write(n.id, n.encode())
+}
+
+// findLeaf descends from the root to the leaf which could hold key.
+func (s *BTreeStore) findLeaf(key string) (*node, error) {
+	n, err := s.node(s.pager.meta.root)
+	if err != nil {
+		return nil, err
+	}
+	for !n.leaf {
+		n, err = s.node(n.children[n.childIndex(key)])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+func (s *BTreeStore) Get(k string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n, err := s.findLeaf(k)
+	if err != nil {
+		return nil, err
+	}
+	i := n.search(k)
+	if i == len(n.keys) || n.keys[i] != k {
+		return nil, nil
+	}
+	return s.readValue(n.vals[i])
+}
+
+func (s *BTreeStore) Put(k string, v []byte) error {
+	if len(k) > maxKeySize {
+		return fmt.Errorf("key of %d bytes is larger than the maximum of %d", len(k), maxKeySize)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.put(k, v)
+	if err != nil {
+		s.pager.rollback()
+		return err
+	}
+	return s.pager.commit()
+}
+
+// Delete removes the key from its leaf, freeing any overflow pages
+// its value used. Nodes aren't merged when they become sparse, a
+// leaf left empty stays in place to be filled by later inserts.
+func (s *BTreeStore) Delete(k string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.delete(k)
+	if err != nil {
+		s.pager.rollback()
+		return err
+	}
+	return s.pager.commit()
+}
+
+// Write applies every write in the batch, then commits the pages
+// they changed together, so that the batch is made durable in one
+// log record.
+func (s *BTreeStore) Write(batch *kv.WriteBatch) error {
+	for _, op := range batch.Ops {
+		if len(op.Key) > maxKeySize {
+			return fmt.Errorf("key of %d bytes is larger than the maximum of %d", len(op.Key), maxKeySize)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, op := range batch.Ops {
+		var err error
+		if op.Delete {
+			err = s.delete(op.Key)
+		} else {
+			err = s.put(op.Key, op.Value)
+		}
+		if err != nil {
+			s.pager.rollback()
+			return err
+		}
+	}
+	return s.pager.commit()
+}
+
+func (s *BTreeStore) delete(k string) error {
+	n, err := s.findLeaf(k)
+	if err != nil {
+		return err
+	}
+	i := n.search(k)
+	if i == len(n.keys) || n.keys[i] != k {
+		return nil
+	}
+	if err = s.freeValue(n.vals[i]); err != nil {
+		return err
+	}
+	n.keys = slices.Delete(n.keys, i, i+1)
+	n.vals = slices.Delete(n.vals, i, i+1)
+	s.writeNode(n)
+	return nil
+}
+
+func (s *BTreeStore) put(k string, v []byte) error {
+	val, err := s.writeValue(v)
+	if err != nil {
+		return err
+	}
+	sep, right, err := s.insert(s.pager.meta.root, k, val)
+	if err != nil || right == 0 {
+		return err
+	}
+
+	// the root split, so the tree grows a level.
+	id, err := s.pager.allocate()
+	if err != nil {
+		return err
+	}
+	s.writeNode(&node{
+		id:       id,
+		keys:     []string{sep},
+		children: []uint32{s.pager.meta.root, right},
+	})
+	s.pager.meta.root = id
+	return nil
+}
+
+// insert puts the key into the subtree rooted at id. If the node
+// had to split to make room, the separator key and the id of the
+// new node to its right are returned, to be added to its parent.
+func (s *BTreeStore) insert(id uint32, k string, v value) (string, uint32, error) {
+	n, err := s.node(id)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if n.leaf {
+		i := n.search(k)
+		if i < len(n.keys) && n.keys[i] == k {
+			if err = s.freeValue(n.vals[i]); err != nil {
+				return "", 0, err
+			}
+			n.vals[i] = v
+		} else {
+			n.keys = slices.Insert(n.keys, i, k)
+			n.vals = slices.Insert(n.vals, i, v)
+		}
+		return s.writeOrSplit(n)
+	}
+
+	i := n.childIndex(k)
+	sep, right, err := s.insert(n.children[i], k, v)
+	if err != nil || right == 0 {
+		return "", 0, err
+	}
+	n.keys = slices.Insert(n.keys, i, sep)
+	n.children = slices.Insert(n.children, i+1, right)
+	return s.writeOrSplit(n)
+}
+
+// writeOrSplit writes the node back to its page. If it no longer
+// fits, the upper half of it is moved to a new page first.
+func (s *BTreeStore) writeOrSplit(n *node) (string, uint32, error) {
+	if n.size() <= pageSize {
+		s.writeNode(n)
+		return "", 0, nil
+	}
+
+	id, err := s.pager.allocate()
+	if err != nil {
+		return "", 0, err
+	}
+	m := s.splitPoint(n)
+	right := &node{id: id, leaf: n.leaf}
+	var sep string
+	if n.leaf {
+		// the first key of the right leaf is copied up to the parent.
+		right.keys = slices.Clone(n.keys[m:])
+		right.vals = slices.Clone(n.vals[m:])
+		right.next = n.next
+		n.keys, n.vals, n.next = n.keys[:m], n.vals[:m], id
+		sep = right.keys[0]
+	} else {
+		// the middle key of an internal node moves up to the parent.
+		right.keys = slices.Clone(n.keys[m+1:])
+		right.children = slices.Clone(n.children[m+1:])
+		sep = n.keys[m]
+		n.keys, n.children = n.keys[:m], n.children[:m+1]
+	}
+	s.writeNode(n)
+	s.writeNode(right)
+	return sep, id, nil
+}
+
+// splitPoint returns the index of the first key to move to the right
+// node, so that the two halves are roughly even in size.
+func (s *BTreeStore) splitPoint(n *node) int {
+	half := n.size() / 2
+	size := headerSize
+	for i, key := range n.keys {
+		size += uvarintLen(len(key)) + len(key)
+		if n.leaf {
+			size += 1 + n.vals[i].size()
+		} else {
+			size += 4
+		}
+		if size >= half {
+			return max(i, 1)
+		}
+	}
+	return len(n.keys) - 1
+}
+
+// writeValue prepares a value to be stored in a leaf, writing it to
+// overflow pages if it's too large to store inline.
+func (s *BTreeStore) writeValue(v []byte) (value, error) {
+	if len(v) <= maxInlineValue {
+		return value{inline: slices.Clone(v)}, nil
+	}
+	// the chain is written back to front, so that each page can
+	// point to the one after it.
+	chunk := pageSize - overflowHeaderSize
+	var next uint32
+	for end := len(v); end > 0; {
+		start := (end - 1) / chunk * chunk
+		id, err := s.pager.allocate()
+		if err != nil {
+			return value{}, err
+		}
+		b := make([]byte, 1, pageSize)
+		b[0] = byte(pageOverflow)
+		b = binary.BigEndian.AppendUint32(b, next)
+		b = binary.BigEndian.AppendUint16(b, uint16(end-start))
+		b = append(b, v[start:end]...)
+		s.pager.write(id, b[:pageSize])
+		next = id
+		end = start
+	}
+	return value{overflow: next, length: len(v)}, nil
+}
+
+// readValue returns a value from a leaf, reading it back from its
+// overflow pages if needed.
+func (s *BTreeStore) readValue(v value) ([]byte, error) {
+	if v.overflow == 0 {
+		return v.inline, nil
+	}
+	result := make([]byte, 0, v.length)
+	for id := v.overflow; id != 0; {
+		var err error
+		id, err = s.readOverflow(id, func(chunk []byte) {
+			result = append(result, chunk...)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(result) != v.length {
+		return nil, errCorruptPage
+	}
+	return result, nil
+}
+
+// freeValue returns the overflow pages of a value to the free list.
+func (s *BTreeStore) freeValue(v value) error {
+	for id := v.overflow; id != 0; {
+		next, err := s.readOverflow(id, func([]byte) {})
+		if err != nil {
+			return err
+		}
+		s.pager.free(id)
+		id = next
+	}
+	return nil
+}
+
+// readOverflow passes the part of a value held in an overflow page
+// to fn, and returns the id of the next page in the chain.
+func (s *BTreeStore) readOverflow(id uint32, fn func(chunk []byte)) (uint32, error) {
+	var next uint32
+	err := s.pager.view(id, func(b []byte) error {
+		l := int(binary.BigEndian.Uint16(b[5:7]))
+		if pageType(b[0]) != pageOverflow || l > pageSize-overflowHeaderSize {
+			return errCorruptPage
+		}
+		fn(b[overflowHeaderSize : overflowHeaderSize+l])
+		next = binary.BigEndian.Uint32(b[1:5])
+		return nil
+	})
+	return next, err
+}
+
+func (s *BTreeStore) Scan(start, end string) (kv.Cursor, error) {
+	return &Cursor{s: s, start: start, end: end}, nil
+}
+
+// Close checkpoints the tree and closes its file.
+func (s *BTreeStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pager.close()
+}
@@ -0,0 +1,342 @@
+package btree_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/btree"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/buffer"
+	"github.com/angles-n-daemons/popsql/pkg/test/assert"
+)
+
+func key(i int) string {
+	return fmt.Sprintf("key%05d", i)
+}
+
+func fileSize(t *testing.T, dir string) int64 {
+	info, err := os.Stat(filepath.Join(dir, "btree.db"))
+	assert.NoError(t, err)
+	return info.Size()
+}
+
+func TestBTreeStoreGetPut(t *testing.T) {
+	st, err := btree.NewStore(t.TempDir(), nil)
+	assert.NoError(t, err)
+	defer st.Close()
+
+	// insert out of order, enough to split the root several times.
+	for i := 0; i < 5000; i++ {
+		j := (i * 7919) % 5000
+		assert.NoError(t, st.Put(key(j), []byte(fmt.Sprintf("val%d", j))))
+	}
+	for i := 0; i < 5000; i++ {
+		val, err := st.Get(key(i))
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("val%d", i), string(val))
+	}
+	val, err := st.Get("missing")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+
+	assert.NoError(t, st.Put(key(10), []byte("updated")))
+	val, err = st.Get(key(10))
+	assert.NoError(t, err)
+	assert.Equal(t, "updated", string(val))
+}
+
+func TestBTreeStoreLargeValues(t *testing.T) {
+	dir := t.TempDir()
+	st, err := btree.NewStore(dir, nil)
+	assert.NoError(t, err)
+	defer st.Close()
+
+	large := func(i int) []byte {
+		return bytes.Repeat([]byte{byte('a' + i%26)}, 10000+i)
+	}
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, st.Put(key(i), large(i)))
+	}
+	size := fileSize(t, dir)
+
+	// overwriting the values frees their overflow pages to be reused.
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 20; i++ {
+			assert.NoError(t, st.Put(key(i), large(i+round)))
+		}
+	}
+	if fileSize(t, dir) > size+4*4096 {
+		t.Fatalf("expected freed pages to be reused, file grew from %d to %d", size, fileSize(t, dir))
+	}
+	for i := 0; i < 20; i++ {
+		val, err := st.Get(key(i))
+		assert.NoError(t, err)
+		assert.Equal(t, large(i+4), val)
+	}
+
+	err = st.Put(string(bytes.Repeat([]byte("k"), 1000)), []byte("v"))
+	if err == nil {
+		t.Fatalf("expected an error putting an oversized key")
+	}
+}
+
+func TestBTreeStoreScan(t *testing.T) {
+	st, err := btree.NewStore(t.TempDir(), nil)
+	assert.NoError(t, err)
+	defer st.Close()
+
+	for i := 0; i < 2000; i += 2 {
+		assert.NoError(t, st.Put(key(i), []byte(key(i))))
+	}
+
+	for _, test := range []struct {
+		start, end string
+		expected   int
+		first      string
+	}{
+		{"", "zzz", 1000, key(0)},
+		{key(10), key(20), 5, key(10)},
+		{key(11), key(20), 4, key(12)},
+		{key(1990), "zzz", 5, key(1990)},
+		{"zzz", "zzzz", 0, ""},
+		{key(20), key(20), 0, ""},
+	} {
+		t.Run(fmt.Sprintf("start=%s, end=%s", test.start, test.end), func(t *testing.T) {
+			cur, err := st.Scan(test.start, test.end)
+			assert.NoError(t, err)
+			vals, err := cur.ReadAll()
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, len(vals))
+			if test.expected > 0 {
+				assert.Equal(t, test.first, string(vals[0]))
+			}
+			for i := 1; i < len(vals); i++ {
+				if string(vals[i-1]) >= string(vals[i]) {
+					t.Fatalf("scan out of order, %s before %s", vals[i-1], vals[i])
+				}
+			}
+			assert.True(t, cur.IsAtEnd())
+		})
+	}
+}
+
+func TestBTreeStoreScanWhileWriting(t *testing.T) {
+	st, err := btree.NewStore(t.TempDir(), nil)
+	assert.NoError(t, err)
+	defer st.Close()
+
+	for i := 0; i < 1000; i += 2 {
+		assert.NoError(t, st.Put(key(i), []byte(key(i))))
+	}
+	cur, err := st.Scan("", "zzz")
+	assert.NoError(t, err)
+	vals, err := cur.Read(100)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, len(vals))
+
+	// splitting the leaves the cursor is reading doesn't cause it to
+	// skip or repeat keys.
+	for i := 1; i < 1000; i += 2 {
+		assert.NoError(t, st.Put(key(i), []byte(key(i))))
+	}
+	rest, err := cur.ReadAll()
+	assert.NoError(t, err)
+	vals = append(vals, rest...)
+	for i := 1; i < len(vals); i++ {
+		if string(vals[i-1]) >= string(vals[i]) {
+			t.Fatalf("scan out of order, %s before %s", vals[i-1], vals[i])
+		}
+	}
+	assert.Equal(t, key(999), string(vals[len(vals)-1]))
+}
+
+func TestBTreeStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	st, err := btree.NewStore(dir, nil)
+	assert.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, st.Put(key(i), []byte(fmt.Sprintf("val%d", i))))
+	}
+	assert.NoError(t, st.Close())
+
+	st, err = btree.NewStore(dir, nil)
+	assert.NoError(t, err)
+	defer st.Close()
+	for i := 0; i < 1000; i++ {
+		val, err := st.Get(key(i))
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("val%d", i), string(val))
+	}
+}
+
+func TestBTreeStoreRecoverFromLog(t *testing.T) {
+	dir := t.TempDir()
+	// never checkpoint, so that every change is still in the log.
+	opts := &btree.Options{CheckpointSize: 1 << 40}
+	st, err := btree.NewStore(dir, opts)
+	assert.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, st.Put(key(i), []byte(fmt.Sprintf("val%d", i))))
+	}
+
+	// simulate a crash where none of the page writes reached the
+	// file, only the log.
+	err = os.WriteFile(filepath.Join(dir, "btree.db"), nil, 0644)
+	assert.NoError(t, err)
+
+	st, err = btree.NewStore(dir, opts)
+	assert.NoError(t, err)
+	defer st.Close()
+	for i := 0; i < 1000; i++ {
+		val, err := st.Get(key(i))
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("val%d", i), string(val))
+	}
+}
+
+func TestBTreeStoreBufferPool(t *testing.T) {
+	pool := buffer.NewPool(1<<20, buffer.LRU)
+	st, err := btree.NewStore(t.TempDir(), &btree.Options{CheckpointSize: 1 << 20, Pool: pool})
+	assert.NoError(t, err)
+	defer st.Close()
+
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, st.Put(key(i), []byte(fmt.Sprintf("val%d", i))))
+	}
+	scan := func() {
+		cur, err := st.Scan("", "zzz")
+		assert.NoError(t, err)
+		vals, err := cur.ReadAll()
+		assert.NoError(t, err)
+		assert.Equal(t, 1000, len(vals))
+	}
+	scan()
+	misses := pool.Stats().Misses
+
+	// every page the scan reads is already in the pool.
+	scan()
+	stats := pool.Stats()
+	assert.Equal(t, misses, stats.Misses)
+	assert.Equal(t, 0, stats.Pinned)
+
+	// a small pool stays within its budget by evicting pages.
+	small := buffer.NewPool(4*4096, buffer.Clock)
+	st2, err := btree.NewStore(t.TempDir(), &btree.Options{CheckpointSize: 1 << 20, Pool: small})
+	assert.NoError(t, err)
+	defer st2.Close()
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, st2.Put(key(i), []byte(fmt.Sprintf("val%d", i))))
+	}
+	for i := 0; i < 1000; i++ {
+		val, err := st2.Get(key(i))
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("val%d", i), string(val))
+	}
+	stats = small.Stats()
+	if stats.Evictions == 0 || stats.Bytes > 4*4096 {
+		t.Fatalf("expected the pool to evict pages to stay in budget, %+v", stats)
+	}
+}
+
+func TestBTreeStoreDelete(t *testing.T) {
+	dir := t.TempDir()
+	st, err := btree.NewStore(dir, nil)
+	assert.NoError(t, err)
+
+	for i := 0; i < 2000; i++ {
+		assert.NoError(t, st.Put(key(i), []byte(key(i))))
+	}
+	// delete everything but every tenth key, emptying whole leaves.
+	for i := 0; i < 2000; i++ {
+		if i%10 != 0 {
+			assert.NoError(t, st.Delete(key(i)))
+		}
+	}
+	assert.NoError(t, st.Delete("missing"))
+
+	check := func() {
+		for i := 0; i < 2000; i++ {
+			val, err := st.Get(key(i))
+			assert.NoError(t, err)
+			if i%10 == 0 {
+				assert.Equal(t, key(i), string(val))
+			} else {
+				assert.Nil(t, val)
+			}
+		}
+		cur, err := st.Scan("", "zzz")
+		assert.NoError(t, err)
+		vals, err := cur.ReadAll()
+		assert.NoError(t, err)
+		assert.Equal(t, 200, len(vals))
+		assert.Equal(t, key(0), string(vals[0]))
+		assert.Equal(t, key(1990), string(vals[199]))
+	}
+	check()
+	assert.NoError(t, st.Close())
+
+	st, err = btree.NewStore(dir, nil)
+	assert.NoError(t, err)
+	defer st.Close()
+	check()
+
+	// the pages of deleted overflow values are reused.
+	large := bytes.Repeat([]byte("v"), 50000)
+	assert.NoError(t, st.Put("large", large))
+	size := fileSize(t, dir)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, st.Delete("large"))
+		assert.NoError(t, st.Put("large", large))
+	}
+	assert.Equal(t, size, fileSize(t, dir))
+}
+
+func TestBTreeStoreWriteBatch(t *testing.T) {
+	dir := t.TempDir()
+	st, err := btree.NewStore(dir, nil)
+	assert.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, st.Put(key(i), []byte(key(i))))
+	}
+
+	batch := kv.NewWriteBatch()
+	for i := 0; i < 100; i += 2 {
+		assert.NoError(t, batch.Delete(key(i)))
+	}
+	for i := 100; i < 1000; i++ {
+		assert.NoError(t, batch.Put(key(i), []byte(key(i))))
+	}
+	assert.NoError(t, st.Write(batch))
+
+	check := func() {
+		for i := 0; i < 1000; i++ {
+			val, err := st.Get(key(i))
+			assert.NoError(t, err)
+			if i < 100 && i%2 == 0 {
+				assert.Nil(t, val)
+			} else {
+				assert.Equal(t, key(i), string(val))
+			}
+		}
+	}
+	check()
+
+	// a batch with a key which is too large fails without applying
+	// any of its writes.
+	batch.Reset()
+	assert.NoError(t, batch.Put("a", []byte("a")))
+	assert.NoError(t, batch.Put(string(bytes.Repeat([]byte("k"), 1000)), []byte("v")))
+	assert.IsError(t, st.Write(batch), "key of 1000 bytes is larger than the maximum of 512")
+	val, err := st.Get("a")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+
+	assert.NoError(t, st.Close())
+	st, err = btree.NewStore(dir, nil)
+	assert.NoError(t, err)
+	defer st.Close()
+	check()
+}
@@ -0,0 +1,131 @@
+package btree
+
+import (
+	"math"
+)
+
+// Cursor is the kv.Cursor returned by a scan of the BTreeStore. It
+// reads a leaf at a time, taking the store's lock only while it
+// does. Since the tree may change between reads, the cursor finds
+// its next leaf by searching from the root for the key after the
+// last one it returned, rather than following a sibling pointer
+// which may have gone stale.
+type Cursor struct {
+	s     *BTreeStore
+	start string
+	end   string
+	// started is set once the first leaf has been read, after which
+	// start is the last key returned.
+	started bool
+	keys    []string
+	vals    [][]byte
+	pos     int
+	done    bool
+}
+
+func (c *Cursor) ReadAll() ([][]byte, error) {
+	return c.Read(math.MaxInt)
+}
+
+func (c *Cursor) Read(num int) ([][]byte, error) {
+	vals := [][]byte{}
+	for i := 0; i < num; i++ {
+		if err := c.fill(); err != nil {
+			return nil, err
+		}
+		if c.IsAtEnd() {
+			break
+		}
+		val, err := c.Next()
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, val)
+	}
+	return vals, nil
+}
+
+func (c *Cursor) Next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+	if c.IsAtEnd() {
+		return nil, nil
+	}
+	val := c.vals[c.pos]
+	c.start = c.keys[c.pos]
+	c.pos++
+	return val, nil
+}
+
+func (c *Cursor) IsAtEnd() bool {
+	if c.fill() != nil {
+		return true
+	}
+	return c.done
+}
+
+// Close moves the cursor to its end. The cursor only holds the
+// store's lock while it reads a leaf, so there's nothing to release.
+func (c *Cursor) Close() error {
+	c.keys, c.vals, c.pos, c.done = nil, nil, 0, true
+	return nil
+}
+
+func (c *Cursor) Key() string {
+	if c.IsAtEnd() {
+		return ""
+	}
+	return c.keys[c.pos]
+}
+
+// fill reads in the next leaf once the current one is used up,
+// skipping past any empty leaves.
+func (c *Cursor) fill() error {
+	for !c.done && c.pos == len(c.keys) {
+		if err := c.readLeaf(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLeaf loads the entries of the leaf holding the keys after the
+// last one returned. The leaf's values are read while the lock is
+// held, so that they can't be freed out from under the cursor.
+func (c *Cursor) readLeaf() error {
+	c.s.mu.RLock()
+	defer c.s.mu.RUnlock()
+	n, err := c.s.findLeaf(c.start)
+	if err != nil {
+		return err
+	}
+	i := n.search(c.start)
+	if c.started && i < len(n.keys) && n.keys[i] == c.start {
+		i++
+	}
+	// the key after the last one returned may be in the next leaf.
+	for i == len(n.keys) && n.next != 0 {
+		if n, err = c.s.node(n.next); err != nil {
+			return err
+		}
+		i = 0
+	}
+	c.started = true
+	c.keys, c.vals, c.pos = nil, nil, 0
+	for ; i < len(n.keys); i++ {
+		if n.keys[i] >= c.end {
+			break
+		}
+		val, err := c.s.readValue(n.vals[i])
+		if err != nil {
+			return err
+		}
+		c.keys = append(c.keys, n.keys[i])
+		c.vals = append(c.vals, val)
+	}
+	if len(c.keys) == 0 {
+		c.done = true
+	}
+	return nil
+}
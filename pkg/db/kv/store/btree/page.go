@@ -0,0 +1,239 @@
+package btree
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+/*
+The tree is stored in a single file divided into fixed size pages.
+Page 0 holds the meta page, which records the root of the tree, the
+head of the free page list and the number of pages in the file.
+
+Every other page is one of:
+
+  - a leaf node, holding keys and their values, plus a pointer to
+    the leaf to its right so that scans can walk the leaves in order.
+  - an internal node, holding keys and the children between them.
+  - an overflow page, holding part of a value too large to store in
+    its leaf.
+  - a free page, which holds a pointer to the next free page.
+
+Nodes start with a header of:
+
+	page type byte | uint16 count | uint32 next
+
+Leaf cells follow, each encoded as:
+
+	uvarint key length | key | value flag | value
+
+where the value is either a uvarint length followed by the value, or
+for an overflowed value, its uvarint length followed by the uint32 id
+of its first overflow page.
+
+Internal nodes store their leftmost child as a uint32 after the
+header, then cells of:
+
+	uvarint key length | key | uint32 child
+
+All keys in a child are greater than or equal to the key before it,
+and less than the key after it.
+*/
+
+const (
+	pageSize   = 4096
+	headerSize = 7
+
+	// maxKeySize bounds the size of keys, so that a node always has
+	// room for several of them.
+	maxKeySize = pageSize / 8
+	// maxInlineValue is the largest value stored directly in a leaf.
+	// Anything larger is moved out to overflow pages.
+	maxInlineValue = pageSize / 8
+
+	overflowHeaderSize = 7
+)
+
+type pageType byte
+
+const (
+	pageMeta pageType = iota + 1
+	pageLeaf
+	pageInternal
+	pageOverflow
+	pageFree
+)
+
+var errCorruptPage = errors.New("corrupt btree page")
+
+// value is a value held in a leaf. Large values are stored in a
+// chain of overflow pages, and only read when they're needed.
+type value struct {
+	inline   []byte
+	overflow uint32
+	length   int
+}
+
+// node is the decoded form of a leaf or internal page.
+type node struct {
+	id   uint32
+	leaf bool
+	keys []string
+	// vals are set for leaves, children for internal nodes.
+	vals     []value
+	children []uint32
+	// next is the id of the leaf to the right, or 0 for the last
+	// leaf.
+	next uint32
+}
+
+// search returns the position of the first key at or after key.
+func (n *node) search(key string) int {
+	return sort.SearchStrings(n.keys, key)
+}
+
+// childIndex returns the index of the child which could hold key.
+func (n *node) childIndex(key string) int {
+	return sort.Search(len(n.keys), func(i int) bool {
+		return n.keys[i] > key
+	})
+}
+
+// size returns the number of bytes the node takes when encoded.
+func (n *node) size() int {
+	size := headerSize
+	if !n.leaf {
+		size += 4
+	}
+	for i, key := range n.keys {
+		size += uvarintLen(len(key)) + len(key)
+		if n.leaf {
+			size += 1 + n.vals[i].size()
+		} else {
+			size += 4
+		}
+	}
+	return size
+}
+
+func (v value) size() int {
+	if v.overflow != 0 {
+		return uvarintLen(v.length) + 4
+	}
+	return uvarintLen(len(v.inline)) + len(v.inline)
+}
+
+func (n *node) encode() []byte {
+	b := make([]byte, headerSize, pageSize)
+	b[0] = byte(pageInternal)
+	if n.leaf {
+		b[0] = byte(pageLeaf)
+	}
+	binary.BigEndian.PutUint16(b[1:3], uint16(len(n.keys)))
+	binary.BigEndian.PutUint32(b[3:7], n.next)
+	if !n.leaf {
+		b = binary.BigEndian.AppendUint32(b, n.children[0])
+	}
+	for i, key := range n.keys {
+		b = binary.AppendUvarint(b, uint64(len(key)))
+		b = append(b, key...)
+		if !n.leaf {
+			b = binary.BigEndian.AppendUint32(b, n.children[i+1])
+			continue
+		}
+		v := n.vals[i]
+		if v.overflow != 0 {
+			b = append(b, 1)
+			b = binary.AppendUvarint(b, uint64(v.length))
+			b = binary.BigEndian.AppendUint32(b, v.overflow)
+		} else {
+			b = append(b, 0)
+			b = binary.AppendUvarint(b, uint64(len(v.inline)))
+			b = append(b, v.inline...)
+		}
+	}
+	return b[:pageSize]
+}
+
+func decodeNode(id uint32, b []byte) (*node, error) {
+	t := pageType(b[0])
+	if t != pageLeaf && t != pageInternal {
+		return nil, errCorruptPage
+	}
+	count := int(binary.BigEndian.Uint16(b[1:3]))
+	n := &node{
+		id:   id,
+		leaf: t == pageLeaf,
+		keys: make([]string, count),
+		next: binary.BigEndian.Uint32(b[3:7]),
+	}
+	b = b[headerSize:]
+	if n.leaf {
+		n.vals = make([]value, count)
+	} else {
+		if len(b) < 4 {
+			return nil, errCorruptPage
+		}
+		n.children = make([]uint32, 0, count+1)
+		n.children = append(n.children, binary.BigEndian.Uint32(b))
+		b = b[4:]
+	}
+	var err error
+	for i := range n.keys {
+		n.keys[i], b, err = readBytes(b)
+		if err != nil {
+			return nil, err
+		}
+		if !n.leaf {
+			if len(b) < 4 {
+				return nil, errCorruptPage
+			}
+			n.children = append(n.children, binary.BigEndian.Uint32(b))
+			b = b[4:]
+			continue
+		}
+		if len(b) < 1 {
+			return nil, errCorruptPage
+		}
+		overflowed := b[0] == 1
+		b = b[1:]
+		if !overflowed {
+			var v string
+			v, b, err = readBytes(b)
+			if err != nil {
+				return nil, err
+			}
+			n.vals[i] = value{inline: []byte(v)}
+			continue
+		}
+		l, m := binary.Uvarint(b)
+		if m <= 0 || len(b)-m < 4 {
+			return nil, errCorruptPage
+		}
+		n.vals[i] = value{
+			length:   int(l),
+			overflow: binary.BigEndian.Uint32(b[m:]),
+		}
+		b = b[m+4:]
+	}
+	return n, nil
+}
+
+func readBytes(b []byte) (string, []byte, error) {
+	l, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < l {
+		return "", nil, errCorruptPage
+	}
+	b = b[n:]
+	return string(b[:l]), b[l:], nil
+}
+
+func uvarintLen(x int) int {
+	n := 1
+	for x >= 0x80 {
+		x >>= 7
+		n++
+	}
+	return n
+}
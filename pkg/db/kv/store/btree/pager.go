@@ -0,0 +1,264 @@
+package btree
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/buffer"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/wal"
+)
+
+const (
+	dataName = "btree.db"
+	logName  = "btree.log"
+
+	metaMagic uint64 = 0x706f7073716c6274 // "popsqlbt"
+)
+
+var errCorruptLog = errors.New("corrupt btree log record")
+
+// meta is the contents of the meta page.
+type meta struct {
+	root      uint32
+	freeHead  uint32
+	pageCount uint32
+}
+
+func (m meta) encode() []byte {
+	b := make([]byte, 1, pageSize)
+	b[0] = byte(pageMeta)
+	b = binary.BigEndian.AppendUint64(b, metaMagic)
+	b = binary.BigEndian.AppendUint32(b, m.root)
+	b = binary.BigEndian.AppendUint32(b, m.freeHead)
+	b = binary.BigEndian.AppendUint32(b, m.pageCount)
+	return b[:pageSize]
+}
+
+func decodeMeta(b []byte) (meta, error) {
+	if pageType(b[0]) != pageMeta || binary.BigEndian.Uint64(b[1:9]) != metaMagic {
+		return meta{}, errCorruptPage
+	}
+	return meta{
+		root:      binary.BigEndian.Uint32(b[9:13]),
+		freeHead:  binary.BigEndian.Uint32(b[13:17]),
+		pageCount: binary.BigEndian.Uint32(b[17:21]),
+	}, nil
+}
+
+/*
+pager reads and writes the pages of the tree's file. Changes made by
+an operation are buffered as dirty pages, and made durable together
+by commit, which appends an image of every dirty page to a log as a
+single record before writing them to the file. If the process dies
+part way through writing the pages, the log is replayed when the file
+is next opened, so an operation is never half applied.
+
+Once the log grows past a threshold, the file is synced and the log
+is cleared, which is called a checkpoint.
+*/
+type pager struct {
+	f              *os.File
+	log            *wal.Log
+	checkpointSize int64
+	pool           *buffer.Pool
+	// file is the id the file's pages are cached under in the pool.
+	file uint64
+
+	meta meta
+	// committed is the meta page as of the last commit, which is
+	// restored if an operation is rolled back.
+	committed meta
+	dirty     map[uint32][]byte
+}
+
+func openPager(dir string, checkpointSize int64, pool *buffer.Pool) (*pager, error) {
+	f, err := os.OpenFile(filepath.Join(dir, dataName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	log, err := wal.OpenLog(filepath.Join(dir, logName))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	p := &pager{
+		f:              f,
+		log:            log,
+		checkpointSize: checkpointSize,
+		pool:           pool,
+		file:           pool.NewFile(),
+		dirty:          map[uint32][]byte{},
+	}
+	if err = p.recover(); err != nil {
+		p.close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// recover replays the log into the file, then loads the meta page,
+// initializing the file with an empty tree if it's new.
+func (p *pager) recover() error {
+	err := p.log.Replay(func(record []byte) error {
+		if len(record)%(4+pageSize) != 0 {
+			return errCorruptLog
+		}
+		for ; len(record) > 0; record = record[4+pageSize:] {
+			id := binary.BigEndian.Uint32(record)
+			if _, err := p.f.WriteAt(record[4:4+pageSize], int64(id)*pageSize); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = p.checkpoint(); err != nil {
+		return err
+	}
+
+	info, err := p.f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		p.meta = meta{root: 1, pageCount: 2}
+		p.write(1, (&node{leaf: true}).encode())
+		return p.commit()
+	}
+	b, err := p.readFile(0)
+	if err != nil {
+		return err
+	}
+	if p.meta, err = decodeMeta(b); err != nil {
+		return fmt.Errorf("failed to open btree file: %w", err)
+	}
+	p.committed = p.meta
+	return nil
+}
+
+// view passes the contents of a page to fn, including any changes
+// not yet committed. Committed pages are read through the buffer
+// pool, and stay pinned until fn returns. fn must not modify the
+// page or hold onto it afterwards.
+func (p *pager) view(id uint32, fn func(b []byte) error) error {
+	if b, ok := p.dirty[id]; ok {
+		return fn(b)
+	}
+	f, err := p.pool.Get(p.pageID(id), func() ([]byte, error) {
+		return p.readFile(id)
+	})
+	if err != nil {
+		return err
+	}
+	defer p.pool.Unpin(f)
+	return fn(f.Data())
+}
+
+func (p *pager) pageID(id uint32) buffer.PageID {
+	return buffer.PageID{File: p.file, Offset: uint64(id) * pageSize}
+}
+
+func (p *pager) readFile(id uint32) ([]byte, error) {
+	if id >= p.meta.pageCount && id != 0 {
+		return nil, fmt.Errorf("page %d is out of range", id)
+	}
+	b := make([]byte, pageSize)
+	if _, err := p.f.ReadAt(b, int64(id)*pageSize); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// write buffers the new contents of a page until the next commit.
+func (p *pager) write(id uint32, b []byte) {
+	p.dirty[id] = b
+}
+
+// allocate returns a page to write to, reusing a free page if there
+// is one.
+func (p *pager) allocate() (uint32, error) {
+	if p.meta.freeHead == 0 {
+		id := p.meta.pageCount
+		p.meta.pageCount++
+		return id, nil
+	}
+	id := p.meta.freeHead
+	err := p.view(id, func(b []byte) error {
+		if pageType(b[0]) != pageFree {
+			return errCorruptPage
+		}
+		p.meta.freeHead = binary.BigEndian.Uint32(b[1:5])
+		return nil
+	})
+	return id, err
+}
+
+// free adds a page to the free list.
+func (p *pager) free(id uint32) {
+	b := make([]byte, 1, pageSize)
+	b[0] = byte(pageFree)
+	b = binary.BigEndian.AppendUint32(b, p.meta.freeHead)
+	p.write(id, b[:pageSize])
+	p.meta.freeHead = id
+}
+
+// commit makes the dirty pages durable.
+func (p *pager) commit() error {
+	if len(p.dirty) == 0 {
+		return nil
+	}
+	p.write(0, p.meta.encode())
+	record := make([]byte, 0, len(p.dirty)*(4+pageSize))
+	for id, b := range p.dirty {
+		record = binary.BigEndian.AppendUint32(record, id)
+		record = append(record, b...)
+	}
+	if err := p.log.Append(record); err != nil {
+		p.rollback()
+		return err
+	}
+	for id, b := range p.dirty {
+		if _, err := p.f.WriteAt(b, int64(id)*pageSize); err != nil {
+			return err
+		}
+		p.pool.Put(p.pageID(id), b)
+	}
+	p.dirty = map[uint32][]byte{}
+	p.committed = p.meta
+	if p.log.Size() >= p.checkpointSize {
+		return p.checkpoint()
+	}
+	return nil
+}
+
+// rollback discards the dirty pages.
+func (p *pager) rollback() {
+	p.dirty = map[uint32][]byte{}
+	p.meta = p.committed
+}
+
+// checkpoint syncs the file, after which the log is no longer
+// needed.
+func (p *pager) checkpoint() error {
+	if err := p.f.Sync(); err != nil {
+		return err
+	}
+	return p.log.Truncate()
+}
+
+func (p *pager) close() error {
+	p.pool.DropFile(p.file)
+	err := p.checkpoint()
+	if cerr := p.log.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := p.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,99 @@
+package buffer
+
+import (
+	"container/list"
+)
+
+// policy decides which page to evict from the pool. It's only
+// called with the pool's lock held.
+type policy interface {
+	// add starts tracking a page which has just been loaded.
+	add(f *Frame)
+	// touch records that a page was used.
+	touch(f *Frame)
+	remove(f *Frame)
+	// victim returns the next unpinned page to evict, or nil if every
+	// page is pinned.
+	victim() *Frame
+}
+
+// lru keeps the pages in order of use, with the most recently used
+// at the front.
+type lru struct {
+	order *list.List
+}
+
+func newLRU() *lru {
+	return &lru{order: list.New()}
+}
+
+func (l *lru) add(f *Frame) {
+	f.elem = l.order.PushFront(f)
+}
+
+func (l *lru) touch(f *Frame) {
+	// frames which are still loading haven't been added yet.
+	if f.elem != nil {
+		l.order.MoveToFront(f.elem)
+	}
+}
+
+func (l *lru) remove(f *Frame) {
+	l.order.Remove(f.elem)
+	f.elem = nil
+}
+
+func (l *lru) victim() *Frame {
+	for e := l.order.Back(); e != nil; e = e.Prev() {
+		if f := e.Value.(*Frame); f.pins == 0 {
+			return f
+		}
+	}
+	return nil
+}
+
+// clock keeps the pages in a circle, with a hand pointing at the
+// next one to consider. Using a page sets its reference bit. When a
+// victim is needed the hand sweeps around, clearing reference bits,
+// until it finds an unpinned page whose bit is already clear.
+type clock struct {
+	frames []*Frame
+	hand   int
+}
+
+func (c *clock) add(f *Frame) {
+	f.pos = len(c.frames)
+	f.ref = true
+	c.frames = append(c.frames, f)
+}
+
+func (c *clock) touch(f *Frame) {
+	f.ref = true
+}
+
+func (c *clock) remove(f *Frame) {
+	// move the last frame into the removed frame's place.
+	last := c.frames[len(c.frames)-1]
+	c.frames[f.pos] = last
+	last.pos = f.pos
+	c.frames = c.frames[:len(c.frames)-1]
+	if c.hand >= len(c.frames) {
+		c.hand = 0
+	}
+}
+
+func (c *clock) victim() *Frame {
+	// two sweeps are enough to clear every bit and come back around.
+	for i := 0; i < 2*len(c.frames); i++ {
+		f := c.frames[c.hand]
+		c.hand = (c.hand + 1) % len(c.frames)
+		if f.pins > 0 {
+			continue
+		}
+		if !f.ref {
+			return f
+		}
+		f.ref = false
+	}
+	return nil
+}
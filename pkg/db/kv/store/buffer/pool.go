@@ -0,0 +1,246 @@
+package buffer
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultBudget is the memory budget of a pool when none is given.
+const DefaultBudget = 64 << 20
+
+// PageID identifies a page held in the pool. Each file caching its
+// pages in the pool is given its own id by NewFile, and its pages
+// are told apart by their offset within it.
+type PageID struct {
+	File   uint64
+	Offset uint64
+}
+
+// Stats are counters describing how well the pool is working.
+type Stats struct {
+	// Hits counts the pages found in the pool.
+	Hits uint64
+	// Misses counts the pages which had to be loaded.
+	Misses uint64
+	// Evictions counts the pages dropped to stay within the budget.
+	Evictions uint64
+	// Bytes is the size of the pages currently held.
+	Bytes int64
+	// Pinned is the number of pages currently pinned.
+	Pinned int
+}
+
+// Frame is a page held in the pool. A frame is pinned while it's
+// being used, and can't be evicted until it's unpinned.
+type Frame struct {
+	id   PageID
+	data []byte
+	pins int
+	// ready is closed once the page has been loaded, err is set if
+	// loading it failed.
+	ready chan struct{}
+	err   error
+	// loaded is set once the page is in the pool and counted against
+	// its budget.
+	loaded bool
+
+	// the state used by the eviction policy.
+	elem *list.Element
+	pos  int
+	ref  bool
+}
+
+// Data returns the contents of the page. It must not be modified.
+func (f *Frame) Data() []byte {
+	return f.data
+}
+
+/*
+Pool is a bounded cache of pages read from disk, shared by every
+store and cursor which reads through it. Callers pin the pages they
+read and unpin them when they're done. Once the pool holds more bytes
+than its budget, unpinned pages are evicted according to its policy.
+If every page is pinned the pool may go over its budget until some
+are unpinned.
+
+Pages are never reused once evicted, so a caller may keep slices of a
+page's data after unpinning it.
+*/
+type Pool struct {
+	mu       sync.Mutex
+	budget   int64
+	frames   map[PageID]*Frame
+	policy   policy
+	nextFile uint64
+	stats    Stats
+}
+
+// Policy selects the eviction algorithm used by the pool.
+type Policy int
+
+const (
+	// LRU evicts the page which was used least recently.
+	LRU Policy = iota
+	// Clock approximates LRU by sweeping over the pages in a circle,
+	// evicting the first one which hasn't been used since it was
+	// last swept past.
+	Clock
+)
+
+// NewPool creates a pool which holds up to budget bytes of pages.
+func NewPool(budget int64, p Policy) *Pool {
+	pool := &Pool{
+		budget: budget,
+		frames: map[PageID]*Frame{},
+	}
+	switch p {
+	case Clock:
+		pool.policy = &clock{}
+	default:
+		pool.policy = newLRU()
+	}
+	return pool
+}
+
+// NewFile returns an id for a file to use for its pages.
+func (p *Pool) NewFile() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nextFile++
+	return p.nextFile
+}
+
+// Get returns the page, pinned. If it isn't in the pool, it's read
+// with load. Concurrent calls for a page which is being loaded wait
+// for the first one to finish rather than loading it again.
+func (p *Pool) Get(id PageID, load func() ([]byte, error)) (*Frame, error) {
+	p.mu.Lock()
+	if f, ok := p.frames[id]; ok {
+		f.pins++
+		if f.pins == 1 {
+			p.stats.Pinned++
+		}
+		p.stats.Hits++
+		p.policy.touch(f)
+		p.mu.Unlock()
+		<-f.ready
+		if f.err != nil {
+			p.Unpin(f)
+			return nil, f.err
+		}
+		return f, nil
+	}
+
+	f := &Frame{id: id, pins: 1, ready: make(chan struct{})}
+	p.frames[id] = f
+	p.stats.Misses++
+	p.stats.Pinned++
+	p.mu.Unlock()
+
+	f.data, f.err = load()
+	close(f.ready)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if f.err != nil {
+		if p.frames[id] == f {
+			delete(p.frames, id)
+		}
+		p.unpin(f)
+		return nil, f.err
+	}
+	if p.frames[id] != f {
+		// the page was dropped while it was loading, so it's handed
+		// to the caller but not kept.
+		return f, nil
+	}
+	p.stats.Bytes += int64(len(f.data))
+	f.loaded = true
+	p.policy.add(f)
+	p.evict()
+	return f, nil
+}
+
+// Unpin releases a frame returned by Get.
+func (p *Pool) Unpin(f *Frame) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.unpin(f)
+	p.evict()
+}
+
+func (p *Pool) unpin(f *Frame) {
+	f.pins--
+	if f.pins == 0 {
+		p.stats.Pinned--
+	}
+}
+
+// Put replaces the contents of a page held in the pool, after it's
+// been written back to disk. Pages which aren't in the pool are
+// left to be read when they're next needed. Anyone with the old
+// page pinned keeps seeing its old contents.
+func (p *Pool) Put(id PageID, data []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	old, ok := p.frames[id]
+	if !ok {
+		return
+	}
+	p.remove(old)
+	if !old.loaded {
+		// the page is still loading, and may load the old contents,
+		// so it's left out of the pool.
+		return
+	}
+	f := &Frame{id: id, data: data, ready: make(chan struct{}), loaded: true}
+	close(f.ready)
+	p.frames[id] = f
+	p.stats.Bytes += int64(len(data))
+	p.policy.add(f)
+	p.evict()
+}
+
+// DropFile removes all of a file's pages from the pool, once the
+// file is closed or deleted.
+func (p *Pool) DropFile(file uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, f := range p.frames {
+		if id.File == file {
+			p.remove(f)
+		}
+	}
+}
+
+// remove takes a frame out of the pool. If it's pinned, it stays
+// valid for its users, it just won't be returned by Get again.
+func (p *Pool) remove(f *Frame) {
+	if p.frames[f.id] != f {
+		return
+	}
+	delete(p.frames, f.id)
+	if f.loaded {
+		p.policy.remove(f)
+		p.stats.Bytes -= int64(len(f.data))
+	}
+}
+
+// evict drops unpinned pages until the pool is within its budget.
+func (p *Pool) evict() {
+	for p.stats.Bytes > p.budget {
+		f := p.policy.victim()
+		if f == nil {
+			return
+		}
+		p.remove(f)
+		p.stats.Evictions++
+	}
+}
+
+// Stats returns a snapshot of the pool's counters.
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
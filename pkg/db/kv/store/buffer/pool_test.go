@@ -0,0 +1,176 @@
+package buffer_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/buffer"
+	"github.com/angles-n-daemons/popsql/pkg/test/assert"
+)
+
+func page(offset uint64) buffer.PageID {
+	return buffer.PageID{File: 1, Offset: offset}
+}
+
+// get reads a 10 byte page and unpins it straight away, returning
+// whether it had to be loaded.
+func get(t *testing.T, p *buffer.Pool, offset uint64) bool {
+	loaded := false
+	f, err := p.Get(page(offset), func() ([]byte, error) {
+		loaded = true
+		return []byte(fmt.Sprintf("page%06d", offset)), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("page%06d", offset), string(f.Data()))
+	p.Unpin(f)
+	return loaded
+}
+
+func TestPoolHitsAndMisses(t *testing.T) {
+	p := buffer.NewPool(100, buffer.LRU)
+	assert.True(t, get(t, p, 1))
+	assert.True(t, get(t, p, 2))
+	assert.False(t, get(t, p, 1))
+	assert.Equal(t, buffer.Stats{Hits: 1, Misses: 2, Bytes: 20}, p.Stats())
+}
+
+func TestPoolEviction(t *testing.T) {
+	for _, policy := range []buffer.Policy{buffer.LRU, buffer.Clock} {
+		t.Run(fmt.Sprintf("policy=%d", policy), func(t *testing.T) {
+			// room for three pages.
+			p := buffer.NewPool(30, policy)
+			for i := uint64(0); i < 10; i++ {
+				get(t, p, i)
+			}
+			stats := p.Stats()
+			assert.Equal(t, uint64(7), stats.Evictions)
+			assert.Equal(t, int64(30), stats.Bytes)
+
+			// the most recent pages are still held.
+			assert.False(t, get(t, p, 9))
+		})
+	}
+}
+
+func TestPoolEvictsLeastRecentlyUsed(t *testing.T) {
+	p := buffer.NewPool(30, buffer.LRU)
+	get(t, p, 1)
+	get(t, p, 2)
+	get(t, p, 3)
+	get(t, p, 1)
+	// 2 is the least recently used, so it makes room for 4.
+	get(t, p, 4)
+	assert.False(t, get(t, p, 1))
+	assert.False(t, get(t, p, 3))
+	assert.True(t, get(t, p, 2))
+}
+
+func TestPoolClockSecondChance(t *testing.T) {
+	p := buffer.NewPool(30, buffer.Clock)
+	get(t, p, 1)
+	get(t, p, 2)
+	get(t, p, 3)
+	// the first sweep clears every reference bit, then evicts 1.
+	get(t, p, 4)
+	// using 2 again sets its bit, so 3 is evicted in its place.
+	get(t, p, 2)
+	get(t, p, 5)
+	assert.False(t, get(t, p, 2))
+	assert.True(t, get(t, p, 3))
+}
+
+func TestPoolPinnedPagesAreNotEvicted(t *testing.T) {
+	p := buffer.NewPool(20, buffer.LRU)
+	pinned, err := p.Get(page(1), func() ([]byte, error) {
+		return []byte("page000001"), nil
+	})
+	assert.NoError(t, err)
+	for i := uint64(2); i < 10; i++ {
+		get(t, p, i)
+	}
+	assert.Equal(t, 1, p.Stats().Pinned)
+	assert.False(t, get(t, p, 1))
+
+	// with every page pinned, the pool goes over budget.
+	frames := []*buffer.Frame{}
+	for i := uint64(10); i < 13; i++ {
+		f, err := p.Get(page(i), func() ([]byte, error) {
+			return []byte("0123456789"), nil
+		})
+		assert.NoError(t, err)
+		frames = append(frames, f)
+	}
+	assert.Equal(t, int64(40), p.Stats().Bytes)
+	p.Unpin(pinned)
+	for _, f := range frames {
+		p.Unpin(f)
+	}
+	stats := p.Stats()
+	assert.Equal(t, int64(20), stats.Bytes)
+	assert.Equal(t, 0, stats.Pinned)
+}
+
+func TestPoolPutAndDropFile(t *testing.T) {
+	p := buffer.NewPool(100, buffer.LRU)
+	get(t, p, 1)
+	f, err := p.Get(page(1), nil)
+	assert.NoError(t, err)
+
+	p.Put(page(1), []byte("new"))
+	// the pinned frame keeps its old contents.
+	assert.Equal(t, "page000001", string(f.Data()))
+	p.Unpin(f)
+	f, err = p.Get(page(1), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(f.Data()))
+	p.Unpin(f)
+
+	p.DropFile(1)
+	assert.True(t, get(t, p, 1))
+	assert.Equal(t, int64(10), p.Stats().Bytes)
+}
+
+func TestPoolLoadError(t *testing.T) {
+	p := buffer.NewPool(100, buffer.LRU)
+	_, err := p.Get(page(1), func() ([]byte, error) {
+		return nil, errors.New("disk on fire")
+	})
+	assert.IsError(t, err, "disk on fire")
+	assert.True(t, get(t, p, 1))
+	assert.Equal(t, 0, p.Stats().Pinned)
+}
+
+func TestPoolConcurrentGets(t *testing.T) {
+	p := buffer.NewPool(50, buffer.Clock)
+	var loads atomic.Int64
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				offset := uint64(i % 10)
+				f, err := p.Get(page(offset), func() ([]byte, error) {
+					loads.Add(1)
+					return []byte(fmt.Sprintf("page%06d", offset)), nil
+				})
+				if err != nil || string(f.Data()) != fmt.Sprintf("page%06d", offset) {
+					t.Errorf("unexpected page %q, %v", f.Data(), err)
+					return
+				}
+				p.Unpin(f)
+			}
+		}()
+	}
+	wg.Wait()
+	stats := p.Stats()
+	assert.Equal(t, uint64(loads.Load()), stats.Misses)
+	assert.Equal(t, uint64(8000), stats.Hits+stats.Misses)
+	assert.Equal(t, 0, stats.Pinned)
+	if stats.Bytes > 50 {
+		t.Fatalf("pool is over budget, holding %d bytes", stats.Bytes)
+	}
+}
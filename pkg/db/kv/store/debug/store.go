@@ -38,6 +38,32 @@ func (d *DebugStore) Put(key string, value []byte) error {
 	return nil
 }
 
+func (d *DebugStore) Delete(key string) error {
+	err := d.store.Delete(key)
+	if err != nil {
+		fmt.Println("DELETE ERROR", key, err)
+		return err
+	}
+	fmt.Println("DELETE", key)
+	return nil
+}
+
+func (d *DebugStore) Write(batch *kv.WriteBatch) error {
+	err := d.store.Write(batch)
+	if err != nil {
+		fmt.Println("WRITE ERROR", err)
+		return err
+	}
+	for _, op := range batch.Ops {
+		if op.Delete {
+			fmt.Println("WRITE DELETE", op.Key)
+		} else {
+			fmt.Println("WRITE PUT", op.Key, string(op.Value))
+		}
+	}
+	return nil
+}
+
 func (d *DebugStore) Scan(start, end string) (kv.Cursor, error) {
 	c, err := d.store.Scan(start, end)
 	if err != nil {
@@ -89,3 +115,11 @@ func (d *DebugCursor) Next() ([]byte, error) {
 func (d *DebugCursor) IsAtEnd() bool {
 	return d.cursor.IsAtEnd()
 }
+
+func (d *DebugCursor) Close() error {
+	return d.cursor.Close()
+}
+
+func (d *DebugCursor) Key() string {
+	return d.cursor.Key()
+}
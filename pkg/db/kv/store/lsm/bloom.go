@@ -0,0 +1,103 @@
+package lsm
+
+import (
+	"math"
+)
+
+/*
+A bloom filter is a compact, probabilistic set. It can say for
+certain that a key is absent, but may report that a key is present
+when it isn't. Each sstable carries one over all of its keys, so that
+a point lookup can skip the table without reading any data blocks.
+
+The filter is a bit array followed by a single byte holding the
+number of hash functions, k. Rather than computing k independent
+hashes, each key is hashed once and the k probes are derived from it
+by double hashing.
+*/
+
+// maxProbes caps the number of hash functions used by a filter.
+const maxProbes = 30
+
+// bitsPerKeyFor returns the number of bits per key a filter needs to
+// achieve the false positive rate p.
+func bitsPerKeyFor(p float64) int {
+	return int(math.Ceil(-math.Log(p) / (math.Ln2 * math.Ln2)))
+}
+
+// filterWriter collects the hashes of the keys added to a table, and
+// builds the table's filter once all of them have been added.
+type filterWriter struct {
+	bitsPerKey int
+	hashes     []uint32
+}
+
+func (f *filterWriter) add(key string) {
+	f.hashes = append(f.hashes, bloomHash(key))
+}
+
+func (f *filterWriter) build() []byte {
+	k := int(math.Round(float64(f.bitsPerKey) * math.Ln2))
+	k = min(max(k, 1), maxProbes)
+
+	// very small filters have a high false positive rate, so a
+	// minimum size is enforced.
+	bits := max(len(f.hashes)*f.bitsPerKey, 64)
+	bytes := (bits + 7) / 8
+	bits = bytes * 8
+
+	b := make([]byte, bytes, bytes+1)
+	for _, h := range f.hashes {
+		delta := h>>17 | h<<15
+		for i := 0; i < k; i++ {
+			pos := h % uint32(bits)
+			b[pos/8] |= 1 << (pos % 8)
+			h += delta
+		}
+	}
+	return append(b, byte(k))
+}
+
+// filter is a bloom filter read back from an sstable.
+type filter []byte
+
+// mayContain returns false if the key is definitely not in the
+// filter.
+func (f filter) mayContain(key string) bool {
+	if len(f) < 2 {
+		return true
+	}
+	k := int(f[len(f)-1])
+	if k > maxProbes {
+		// reserved for filter formats this version doesn't know.
+		return true
+	}
+	b := f[:len(f)-1]
+	bits := uint32(len(b) * 8)
+	h := bloomHash(key)
+	delta := h>>17 | h<<15
+	for i := 0; i < k; i++ {
+		pos := h % bits
+		if b[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+		h += delta
+	}
+	return true
+}
+
+// bloomHash is a 32 bit FNV-1a hash, finished with a final mix of
+// the bits so that the probes are spread evenly for similar keys.
+func bloomHash(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
@@ -0,0 +1,304 @@
+package lsm
+
+import (
+	"os"
+	"slices"
+	"sort"
+)
+
+// numLevels is the number of levels in the tree, including level 0.
+const numLevels = 7
+
+// compaction describes a merge of tables from one level into the
+// level below it.
+type compaction struct {
+	level int
+	// inputs[0] are the tables from level, inputs[1] are the tables
+	// they overlap in level+1.
+	inputs [2][]*table
+	// below are the levels under the one being compacted into.
+	below [][]*table
+}
+
+// isBaseLevel returns whether none of the levels below the
+// compaction's output could hold the key. If so, a tombstone for the
+// key has nothing left to hide and can be dropped.
+func (c *compaction) isBaseLevel(key string) bool {
+	for _, tables := range c.below {
+		i := findTable(tables, key)
+		if i < len(tables) && tables[i].covers(key) {
+			return false
+		}
+	}
+	return true
+}
+
+// maybeScheduleCompaction wakes up the compaction goroutine. It
+// never blocks, if a compaction is already scheduled it does nothing.
+func (s *LSMStore) maybeScheduleCompaction() {
+	select {
+	case s.compactCh <- struct{}{}:
+	default:
+	}
+}
+
+// compactLoop runs in the background, compacting the tree each time
+// it's woken up until there's no more work to do.
+func (s *LSMStore) compactLoop() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.closing:
+			return
+		case <-s.compactCh:
+		}
+		for {
+			select {
+			case <-s.closing:
+				return
+			default:
+			}
+			done, err := s.compactOnce()
+			if err != nil {
+				s.mu.Lock()
+				s.bgErr = err
+				s.mu.Unlock()
+				return
+			}
+			if done {
+				break
+			}
+		}
+	}
+}
+
+// Compact runs compactions until every level is within its limits.
+func (s *LSMStore) Compact() error {
+	for {
+		done, err := s.compactOnce()
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// compactOnce picks and runs a single compaction. It returns true if
+// there was nothing to compact.
+func (s *LSMStore) compactOnce() (bool, error) {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	s.mu.RLock()
+	c := s.pickCompaction()
+	s.mu.RUnlock()
+	if c == nil {
+		return true, nil
+	}
+	return false, s.runCompaction(c)
+}
+
+// pickCompaction decides which tables should be compacted next. Level
+// 0 takes priority since every read has to check each of its tables.
+// It must be called with the lock held.
+func (s *LSMStore) pickCompaction() *compaction {
+	if len(s.levels[0]) > 0 && len(s.levels[0]) >= s.opts.L0CompactionTrigger {
+		c := &compaction{level: 0}
+		c.inputs[0] = append([]*table{}, s.levels[0]...)
+		smallest, largest := keyRange(c.inputs[0])
+		c.inputs[1] = overlapping(s.levels[1], smallest, largest)
+		c.below = slices.Clone(s.levels[2:])
+		return c
+	}
+
+	limit := s.opts.LevelSize
+	for level := 1; level < numLevels-1; level++ {
+		if levelSize(s.levels[level]) > limit {
+			// rotate through the level's tables, so that every part
+			// of the key space is eventually compacted.
+			tables := s.levels[level]
+			i := sort.Search(len(tables), func(i int) bool {
+				return tables[i].smallest > s.compactPointer[level]
+			})
+			if i == len(tables) {
+				i = 0
+			}
+			c := &compaction{level: level}
+			c.inputs[0] = []*table{tables[i]}
+			c.inputs[1] = overlapping(s.levels[level+1], tables[i].smallest, tables[i].largest)
+			c.below = slices.Clone(s.levels[level+2:])
+			return c
+		}
+		limit *= 10
+	}
+	return nil
+}
+
+// runCompaction merges the input tables, writing the result out as
+// new tables in the level below. Only the newest value for each key
+// is kept, and tombstones are dropped once there's nothing below
+// for them to hide. The merge happens without holding the lock, since the
+// input tables are immutable, and the new tables are installed once
+// they're written.
+func (s *LSMStore) runCompaction(c *compaction) error {
+	iters := []iterator{}
+	for _, t := range c.inputs[0] {
+		it, err := newTableIterator(t, "")
+		if err != nil {
+			return err
+		}
+		iters = append(iters, it)
+	}
+	if len(c.inputs[1]) > 0 {
+		it, err := newLevelIterator(c.inputs[1], "")
+		if err != nil {
+			return err
+		}
+		iters = append(iters, it)
+	}
+
+	outputs := []*table{}
+	abort := func() {
+		for _, t := range outputs {
+			t.unref()
+			os.Remove(s.tablePath(t.num))
+		}
+	}
+	var w *tableWriter
+	var err error
+	it := newMergeIterator(iters)
+	for ; it.valid(); err = it.next() {
+		if err != nil {
+			break
+		}
+		e := it.entry()
+		if e.kind == kindDelete && c.isBaseLevel(e.key) {
+			continue
+		}
+		if w == nil {
+			s.mu.Lock()
+			w, err = s.newTableWriter()
+			s.mu.Unlock()
+			if err != nil {
+				break
+			}
+		}
+		if err = w.add(e); err != nil {
+			break
+		}
+		if w.size() >= s.opts.TableSize {
+			t, err := s.finishTable(w)
+			if err != nil {
+				abort()
+				return err
+			}
+			outputs = append(outputs, t)
+			w = nil
+		}
+	}
+	if err != nil {
+		if w != nil {
+			w.abort()
+		}
+		abort()
+		return err
+	}
+	if w != nil {
+		t, err := s.finishTable(w)
+		if err != nil {
+			abort()
+			return err
+		}
+		outputs = append(outputs, t)
+	}
+
+	if err = s.install(c, outputs); err != nil {
+		abort()
+		return err
+	}
+	return nil
+}
+
+// install swaps the inputs of a compaction for its outputs and
+// records the change in the manifest. Input tables are then removed
+// from disk, and the store's references to them released. Any cursor
+// still reading one holds a reference of its own, and the table is
+// closed once the last of them is released.
+func (s *LSMStore) install(c *compaction, outputs []*table) error {
+	s.mu.Lock()
+	removed := map[*table]bool{}
+	for _, inputs := range c.inputs {
+		for _, t := range inputs {
+			removed[t] = true
+		}
+	}
+	for _, level := range []int{c.level, c.level + 1} {
+		kept := []*table{}
+		for _, t := range s.levels[level] {
+			if !removed[t] {
+				kept = append(kept, t)
+			}
+		}
+		s.levels[level] = kept
+	}
+	s.levels[c.level+1] = append(s.levels[c.level+1], outputs...)
+	sortByKey(s.levels[c.level+1])
+	if c.level > 0 {
+		s.compactPointer[c.level] = c.inputs[0][len(c.inputs[0])-1].largest
+	}
+	err := s.writeManifest()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for t := range removed {
+		os.Remove(s.tablePath(t.num))
+		t.unref()
+	}
+	return nil
+}
+
+// findTable returns the index of the first table in a sorted level
+// whose largest key is at or after the key.
+func findTable(tables []*table, key string) int {
+	return sort.Search(len(tables), func(i int) bool {
+		return tables[i].largest >= key
+	})
+}
+
+// overlapping returns the tables in a sorted level which hold keys
+// within the range [smallest, largest].
+func overlapping(tables []*table, smallest, largest string) []*table {
+	result := []*table{}
+	for _, t := range tables[findTable(tables, smallest):] {
+		if t.smallest > largest {
+			break
+		}
+		result = append(result, t)
+	}
+	return result
+}
+
+// keyRange returns the smallest and largest keys across the tables.
+func keyRange(tables []*table) (string, string) {
+	smallest, largest := tables[0].smallest, tables[0].largest
+	for _, t := range tables[1:] {
+		smallest = min(smallest, t.smallest)
+		largest = max(largest, t.largest)
+	}
+	return smallest, largest
+}
+
+func levelSize(tables []*table) int64 {
+	var size int64
+	for _, t := range tables {
+		size += t.size
+	}
+	return size
+}
+
+func sortByKey(tables []*table) {
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].smallest < tables[j].smallest
+	})
+}
@@ -0,0 +1,276 @@
+package lsm
+
+import (
+	"math"
+	"sort"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/memtable"
+)
+
+// iterator walks the entries of a memtable or sstable in key order.
+type iterator interface {
+	valid() bool
+	entry() entry
+	next() error
+}
+
+// memIterator iterates over a memtable, starting from the node it's
+// created with.
+type memIterator struct {
+	node *memtable.SkiplistNode[string, entry]
+}
+
+func newMemIterator(list *memtable.Skiplist[string, entry], start string) *memIterator {
+	return &memIterator{node: list.Seek(start)}
+}
+
+func (m *memIterator) valid() bool {
+	return m.node != nil
+}
+
+func (m *memIterator) entry() entry {
+	return m.node.Val()
+}
+
+func (m *memIterator) next() error {
+	m.node = m.node.Next()
+	return nil
+}
+
+// tableIterator iterates over an sstable, reading in a block at a
+// time.
+type tableIterator struct {
+	t       *table
+	block   int
+	entries []entry
+	pos     int
+}
+
+func newTableIterator(t *table, start string) (*tableIterator, error) {
+	it := &tableIterator{t: t, block: t.findBlock(start)}
+	if err := it.load(); err != nil {
+		return nil, err
+	}
+	it.pos = sort.Search(len(it.entries), func(i int) bool {
+		return it.entries[i].key >= start
+	})
+	return it, nil
+}
+
+// load reads in the block the iterator is currently positioned at.
+func (it *tableIterator) load() error {
+	it.pos = 0
+	it.entries = nil
+	if it.block >= len(it.t.index) {
+		return nil
+	}
+	entries, err := it.t.readBlock(it.block)
+	if err != nil {
+		return err
+	}
+	it.entries = entries
+	return nil
+}
+
+func (it *tableIterator) valid() bool {
+	return it.pos < len(it.entries)
+}
+
+func (it *tableIterator) entry() entry {
+	return it.entries[it.pos]
+}
+
+func (it *tableIterator) next() error {
+	it.pos++
+	if it.pos < len(it.entries) {
+		return nil
+	}
+	it.block++
+	return it.load()
+}
+
+// levelIterator iterates over the tables of a level below level 0.
+// Because those tables are sorted and don't overlap, it can read
+// them one after another, only opening a table once it's reached.
+type levelIterator struct {
+	tables []*table
+	i      int
+	it     *tableIterator
+}
+
+func newLevelIterator(tables []*table, start string) (*levelIterator, error) {
+	l := &levelIterator{tables: tables, i: findTable(tables, start)}
+	if l.i == len(tables) {
+		return l, nil
+	}
+	it, err := newTableIterator(tables[l.i], start)
+	if err != nil {
+		return nil, err
+	}
+	l.it = it
+	return l, l.skipEmpty()
+}
+
+// skipEmpty moves on to the next table whenever the current one
+// has been read to the end.
+func (l *levelIterator) skipEmpty() error {
+	for l.it != nil && !l.it.valid() {
+		l.i++
+		l.it = nil
+		if l.i == len(l.tables) {
+			return nil
+		}
+		it, err := newTableIterator(l.tables[l.i], "")
+		if err != nil {
+			return err
+		}
+		l.it = it
+	}
+	return nil
+}
+
+func (l *levelIterator) valid() bool {
+	return l.it != nil && l.it.valid()
+}
+
+func (l *levelIterator) entry() entry {
+	return l.it.entry()
+}
+
+func (l *levelIterator) next() error {
+	if err := l.it.next(); err != nil {
+		return err
+	}
+	return l.skipEmpty()
+}
+
+// mergeIterator combines several iterators into one. The iterators
+// are ordered from newest to oldest, so that when more than one has
+// the same key, the value from the newest one is used.
+type mergeIterator struct {
+	iters []iterator
+	cur   int
+}
+
+func newMergeIterator(iters []iterator) *mergeIterator {
+	m := &mergeIterator{iters: iters}
+	m.find()
+	return m
+}
+
+// find positions the merge iterator at the iterator with the
+// smallest key, preferring the newest on ties.
+func (m *mergeIterator) find() {
+	m.cur = -1
+	for i, it := range m.iters {
+		if !it.valid() {
+			continue
+		}
+		if m.cur == -1 || it.entry().key < m.iters[m.cur].entry().key {
+			m.cur = i
+		}
+	}
+}
+
+func (m *mergeIterator) valid() bool {
+	return m.cur != -1
+}
+
+func (m *mergeIterator) entry() entry {
+	return m.iters[m.cur].entry()
+}
+
+// next moves every iterator positioned on the current key forward,
+// skipping over the older versions of it.
+func (m *mergeIterator) next() error {
+	key := m.entry().key
+	for _, it := range m.iters {
+		if it.valid() && it.entry().key == key {
+			if err := it.next(); err != nil {
+				return err
+			}
+		}
+	}
+	m.find()
+	return nil
+}
+
+// Cursor is the kv.Cursor returned by a scan of the LSMStore. It
+// reads from an iterator until it reaches the end key, skipping over
+// deleted keys.
+type Cursor struct {
+	it  iterator
+	end string
+	// release releases the cursor's tables, it's nil once called.
+	release func()
+}
+
+// newCursor creates a cursor over the iterator, which calls release
+// once it reaches its end or is closed.
+func newCursor(it iterator, end string, release func()) (*Cursor, error) {
+	c := &Cursor{it: it, end: end, release: release}
+	return c, c.skipDeleted()
+}
+
+// skipDeleted moves the iterator past any tombstones, so that it's
+// positioned on a live key.
+func (c *Cursor) skipDeleted() error {
+	for !c.IsAtEnd() && c.it.entry().kind == kindDelete {
+		if err := c.it.next(); err != nil {
+			return err
+		}
+	}
+	if c.IsAtEnd() {
+		c.Close()
+	}
+	return nil
+}
+
+// Close releases the tables the cursor reads from. It's called once
+// the cursor reaches its end, so it only has to be called by readers
+// which stop before then.
+func (c *Cursor) Close() error {
+	if c.release != nil {
+		c.release()
+		c.release = nil
+	}
+	return nil
+}
+
+func (c *Cursor) ReadAll() ([][]byte, error) {
+	return c.Read(math.MaxInt)
+}
+
+func (c *Cursor) Read(num int) ([][]byte, error) {
+	vals := [][]byte{}
+	for i := 0; i < num && !c.IsAtEnd(); i++ {
+		val, err := c.Next()
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, val)
+	}
+	return vals, nil
+}
+
+func (c *Cursor) Next() ([]byte, error) {
+	if c.IsAtEnd() {
+		return nil, nil
+	}
+	val := c.it.entry().value
+	if err := c.it.next(); err != nil {
+		return nil, err
+	}
+	return val, c.skipDeleted()
+}
+
+func (c *Cursor) IsAtEnd() bool {
+	return !c.it.valid() || c.end <= c.it.entry().key
+}
+
+func (c *Cursor) Key() string {
+	if c.IsAtEnd() {
+		return ""
+	}
+	return c.it.entry().key
+}
@@ -0,0 +1,579 @@
+package lsm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/buffer"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/memtable"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/wal"
+)
+
+const (
+	logName     = "memtable.log"
+	tableSuffix = ".sst"
+	tmpSuffix   = ".tmp"
+)
+
+// Options are the tunable parameters of the LSMStore.
+type Options struct {
+	// MemtableSize is the approximate number of bytes the memtable
+	// holds before it's flushed to an sstable.
+	MemtableSize int
+	// BlockSize is the target size of a data block in an sstable.
+	BlockSize int
+	// TableSize is the target size of an sstable written by a
+	// compaction.
+	TableSize int
+	// L0CompactionTrigger is the number of tables in level 0 which
+	// causes them to be compacted into level 1.
+	L0CompactionTrigger int
+	// LevelSize is the number of bytes level 1 can hold before it's
+	// compacted into level 2. Each level after holds ten times more
+	// than the one before it.
+	LevelSize int64
+	// FalsePositiveRate is the target rate at which the bloom filter
+	// of an sstable reports that it may hold a key it doesn't.
+	FalsePositiveRate float64
+	// BitsPerKey sizes the bloom filters directly, overriding
+	// FalsePositiveRate. Ten bits per key gives a false positive rate
+	// of about one percent.
+	BitsPerKey int
+	// Pool caches the data blocks read from sstables. It may be
+	// shared with other stores. If it's nil the store creates its
+	// own.
+	Pool *buffer.Pool
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		MemtableSize:        4 << 20,
+		BlockSize:           4 << 10,
+		TableSize:           2 << 20,
+		L0CompactionTrigger: 4,
+		LevelSize:           10 << 20,
+		FalsePositiveRate:   0.01,
+	}
+}
+
+// withDefaults fills in any options which weren't set.
+func withDefaults(opts *Options) *Options {
+	defaults := DefaultOptions()
+	if opts == nil {
+		return defaults
+	}
+	o := *opts
+	if o.MemtableSize <= 0 {
+		o.MemtableSize = defaults.MemtableSize
+	}
+	if o.BlockSize <= 0 {
+		o.BlockSize = defaults.BlockSize
+	}
+	if o.TableSize <= 0 {
+		o.TableSize = defaults.TableSize
+	}
+	if o.L0CompactionTrigger <= 0 {
+		o.L0CompactionTrigger = defaults.L0CompactionTrigger
+	}
+	if o.LevelSize <= 0 {
+		o.LevelSize = defaults.LevelSize
+	}
+	if o.FalsePositiveRate <= 0 || o.FalsePositiveRate >= 1 {
+		o.FalsePositiveRate = defaults.FalsePositiveRate
+	}
+	if o.BitsPerKey <= 0 {
+		o.BitsPerKey = bitsPerKeyFor(o.FalsePositiveRate)
+	}
+	if o.Pool == nil {
+		o.Pool = buffer.NewPool(buffer.DefaultBudget, buffer.LRU)
+	}
+	return &o
+}
+
+// LSMStore is a log structured merge tree. Writes go to a mutable
+// memtable, backed by a write ahead log. When the memtable crosses
+// a size threshold it's frozen and flushed to disk as an immutable
+// sstable. Reads merge the memtable with the sstables, preferring
+// the newest value for each key.
+//
+// The sstables are arranged into levels. Flushed tables land in
+// level 0, where they may overlap one another. A background
+// goroutine compacts them down into the levels below, each of which
+// is made up of tables that don't overlap.
+type LSMStore struct {
+	mu      sync.RWMutex
+	dir     string
+	opts    *Options
+	log     *wal.Log
+	mem     *memtable.Skiplist[string, entry]
+	memSize int
+	// levels[0] is ordered from newest to oldest, the other levels
+	// are ordered by key.
+	levels  [][]*table
+	nextNum uint64
+
+	// compactMu ensures only one compaction runs at a time.
+	compactMu      sync.Mutex
+	compactPointer []string
+	compactCh      chan struct{}
+	closing        chan struct{}
+	wg             sync.WaitGroup
+	// bgErr holds an error hit during a background compaction, it's
+	// returned on subsequent writes.
+	bgErr error
+
+	filterHits           atomic.Uint64
+	filterMisses         atomic.Uint64
+	filterFalsePositives atomic.Uint64
+	openTables           atomic.Int64
+}
+
+// Stats are counters describing how the store has been used.
+type Stats struct {
+	// FilterHits counts the lookups where a bloom filter ruled out a
+	// table, so that none of its blocks had to be read.
+	FilterHits uint64
+	// FilterMisses counts the lookups where a bloom filter reported
+	// that a table may hold the key, and the table had to be read.
+	FilterMisses uint64
+	// FilterFalsePositives counts the filter misses where the key
+	// turned out not to be in the table.
+	FilterFalsePositives uint64
+	// OpenTables is the number of sstables open, including those which
+	// have been compacted away but are still being read by a cursor.
+	OpenTables int64
+}
+
+// NewStore opens the LSMStore in the given directory, loading any
+// sstables and replaying the log of writes which hadn't yet been
+// flushed when the store was last closed.
+func NewStore(dir string, opts *Options) (*LSMStore, error) {
+	opts = withDefaults(opts)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	s := &LSMStore{
+		dir:            dir,
+		opts:           opts,
+		mem:            memtable.NewSkiplist[string, entry](),
+		levels:         make([][]*table, numLevels),
+		nextNum:        1,
+		compactPointer: make([]string, numLevels),
+		compactCh:      make(chan struct{}, 1),
+		closing:        make(chan struct{}),
+	}
+	if err = s.loadTables(); err != nil {
+		s.closeTables()
+		return nil, err
+	}
+
+	s.log, err = wal.OpenLog(filepath.Join(dir, logName))
+	if err != nil {
+		s.closeTables()
+		return nil, err
+	}
+	if err = s.log.Replay(s.replay); err != nil {
+		s.log.Close()
+		s.closeTables()
+		return nil, err
+	}
+
+	s.wg.Add(1)
+	go s.compactLoop()
+	s.maybeScheduleCompaction()
+	return s, nil
+}
+
+// loadTables opens the sstables listed in the manifest. Any other
+// sstables in the directory were left behind by a flush or
+// compaction which didn't complete, and are removed. A directory
+// without a manifest must be a new store, and so have no sstables.
+func (s *LSMStore) loadTables() error {
+	m, err := readManifest(s.dir)
+	if err != nil {
+		return err
+	}
+	onDisk, err := s.listTables()
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		if len(onDisk) > 0 {
+			return fmt.Errorf("sstables in '%s' have no manifest", s.dir)
+		}
+		m = &manifest{}
+	}
+
+	live := map[uint64]bool{}
+	for level, nums := range m.Levels {
+		for _, num := range nums {
+			t, err := openTable(s.tablePath(num), num, s.opts.Pool, &s.openTables)
+			if err != nil {
+				return err
+			}
+			s.levels[level] = append(s.levels[level], t)
+			live[num] = true
+		}
+	}
+	for _, num := range onDisk {
+		if !live[num] {
+			if err = os.Remove(s.tablePath(num)); err != nil {
+				return err
+			}
+		}
+	}
+	sort.Slice(s.levels[0], func(i, j int) bool {
+		return s.levels[0][i].num > s.levels[0][j].num
+	})
+	for level := 1; level < numLevels; level++ {
+		sortByKey(s.levels[level])
+	}
+	s.nextNum = max(s.nextNum, m.NextTable)
+	return s.writeManifest()
+}
+
+// listTables returns the numbers of the sstables in the store's
+// directory, and removes any temporary files.
+func (s *LSMStore) listTables() ([]uint64, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	nums := []uint64{}
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasSuffix(name, tmpSuffix) {
+			if err = os.Remove(filepath.Join(s.dir, name)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !strings.HasSuffix(name, tableSuffix) {
+			continue
+		}
+		num, err := strconv.ParseUint(strings.TrimSuffix(name, tableSuffix), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected sstable name '%s'", name)
+		}
+		nums = append(nums, num)
+	}
+	return nums, nil
+}
+
+// writeManifest persists the current set of tables. It must be
+// called with the write lock held.
+func (s *LSMStore) writeManifest() error {
+	m := &manifest{NextTable: s.nextNum, Levels: make([][]uint64, numLevels)}
+	for level, tables := range s.levels {
+		m.Levels[level] = []uint64{}
+		for _, t := range tables {
+			m.Levels[level] = append(m.Levels[level], t.num)
+		}
+	}
+	return writeManifest(s.dir, m)
+}
+
+func (s *LSMStore) replay(record []byte) error {
+	return wal.DecodeBatch(record, func(o wal.Op, k string, v []byte) error {
+		switch o {
+		case wal.OpPut:
+			return s.apply(entry{key: k, kind: kindPut, value: v})
+		case wal.OpDelete:
+			return s.apply(entry{key: k, kind: kindDelete})
+		default:
+			return fmt.Errorf("unknown log operation %d", o)
+		}
+	})
+}
+
+// apply writes to the memtable, keeping track of its size.
+func (s *LSMStore) apply(e entry) error {
+	_, err := s.mem.Put(e.key, e)
+	if err != nil {
+		return err
+	}
+	s.memSize += len(e.key) + len(e.value)
+	return nil
+}
+
+func (s *LSMStore) Put(k string, v []byte) error {
+	return s.write(wal.EncodeEntry(wal.OpPut, k, v), entry{key: k, kind: kindPut, value: v})
+}
+
+// Delete writes a tombstone for the key. The tombstone hides any
+// older values of the key until a compaction into the bottommost
+// level holding the key drops them both.
+func (s *LSMStore) Delete(k string) error {
+	return s.write(wal.EncodeEntry(wal.OpDelete, k, nil), entry{key: k, kind: kindDelete})
+}
+
+// Write logs the whole batch as one record, so that it's replayed
+// all or nothing, then applies it to the memtable under the same
+// lock, so that readers see all of it or none of it.
+func (s *LSMStore) Write(batch *kv.WriteBatch) error {
+	if batch.Len() == 0 {
+		return nil
+	}
+	entries := make([]entry, 0, batch.Len())
+	for _, op := range batch.Ops {
+		if op.Delete {
+			entries = append(entries, entry{key: op.Key, kind: kindDelete})
+		} else {
+			entries = append(entries, entry{key: op.Key, kind: kindPut, value: op.Value})
+		}
+	}
+	return s.write(wal.EncodeBatch(batch), entries...)
+}
+
+// write logs a record, then applies its entries to the memtable,
+// flushing the memtable if it's full.
+func (s *LSMStore) write(record []byte, entries ...entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bgErr != nil {
+		return s.bgErr
+	}
+	err := s.log.Append(record)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err = s.apply(e); err != nil {
+			return err
+		}
+	}
+	if s.memSize >= s.opts.MemtableSize {
+		return s.flush()
+	}
+	return nil
+}
+
+func (s *LSMStore) Get(k string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if node := s.mem.Get(k); node != nil {
+		return node.Val().visible()
+	}
+	for level, tables := range s.levels {
+		if level > 0 {
+			// tables in the lower levels don't overlap, so only
+			// one of them can hold the key.
+			i := findTable(tables, k)
+			if i == len(tables) {
+				continue
+			}
+			tables = tables[i : i+1]
+		}
+		for _, t := range tables {
+			e, ok, err := s.getFromTable(t, k)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				return e.visible()
+			}
+		}
+	}
+	return nil, nil
+}
+
+// getFromTable looks up a key in a table, checking its bloom filter
+// first so that the table's blocks are only read when the key may be
+// there.
+func (s *LSMStore) getFromTable(t *table, k string) (entry, bool, error) {
+	if !t.covers(k) {
+		return entry{}, false, nil
+	}
+	if !t.filter.mayContain(k) {
+		s.filterHits.Add(1)
+		return entry{}, false, nil
+	}
+	s.filterMisses.Add(1)
+	e, ok, err := t.get(k)
+	if err == nil && !ok {
+		s.filterFalsePositives.Add(1)
+	}
+	return e, ok, err
+}
+
+// Stats returns a snapshot of the store's counters.
+func (s *LSMStore) Stats() Stats {
+	return Stats{
+		FilterHits:           s.filterHits.Load(),
+		FilterMisses:         s.filterMisses.Load(),
+		FilterFalsePositives: s.filterFalsePositives.Load(),
+		OpenTables:           s.openTables.Load(),
+	}
+}
+
+// Scan returns a cursor over the range. The cursor holds a reference
+// to each of the tables it reads, so that they stay open if they're
+// compacted away, until it reaches its end or is closed.
+func (s *LSMStore) Scan(start, end string) (kv.Cursor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tables := []*table{}
+	for _, level := range s.levels {
+		for _, t := range level {
+			t.ref()
+			tables = append(tables, t)
+		}
+	}
+	release := func() {
+		for _, t := range tables {
+			t.unref()
+		}
+	}
+
+	iters := []iterator{newMemIterator(s.mem, start)}
+	for _, t := range s.levels[0] {
+		it, err := newTableIterator(t, start)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		iters = append(iters, it)
+	}
+	for _, tables := range s.levels[1:] {
+		if len(tables) == 0 {
+			continue
+		}
+		it, err := newLevelIterator(tables, start)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		iters = append(iters, it)
+	}
+	c, err := newCursor(newMergeIterator(iters), end, release)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Flush writes the contents of the memtable out to an sstable.
+func (s *LSMStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flush()
+}
+
+// flush freezes the current memtable, replacing it with an empty
+// one, and writes the frozen memtable to a new level 0 sstable.
+// Once the sstable is recorded in the manifest the log is cleared.
+// It must be called with the write lock held.
+func (s *LSMStore) flush() error {
+	if s.mem.Size() == 0 {
+		return nil
+	}
+	frozen := s.mem
+	w, err := s.newTableWriter()
+	if err != nil {
+		return err
+	}
+	it := newMemIterator(frozen, "")
+	for it.valid() {
+		if err = w.add(it.entry()); err == nil {
+			err = it.next()
+		}
+		if err != nil {
+			w.abort()
+			return err
+		}
+	}
+	t, err := s.finishTable(w)
+	if err != nil {
+		return err
+	}
+	s.levels[0] = append([]*table{t}, s.levels[0]...)
+	if err = s.writeManifest(); err != nil {
+		return err
+	}
+	s.mem = memtable.NewSkiplist[string, entry]()
+	s.memSize = 0
+	if err = s.log.Truncate(); err != nil {
+		return err
+	}
+	s.maybeScheduleCompaction()
+	return nil
+}
+
+// newTableWriter creates a writer for a new sstable. The table is
+// written to a temporary file which is renamed in finishTable, so
+// that a partially written table is never loaded.
+func (s *LSMStore) newTableWriter() (*tableWriter, error) {
+	num := s.nextNum
+	s.nextNum++
+	return newTableWriter(s.tablePath(num)+tmpSuffix, num, s.opts.BlockSize, s.opts.BitsPerKey)
+}
+
+// finishTable completes a table started with newTableWriter, moves
+// it into place and opens it for reading.
+func (s *LSMStore) finishTable(w *tableWriter) (*table, error) {
+	if err := w.finish(); err != nil {
+		w.abort()
+		return nil, err
+	}
+	path := s.tablePath(w.num)
+	if err := os.Rename(path+tmpSuffix, path); err != nil {
+		return nil, err
+	}
+	if err := syncDir(s.dir); err != nil {
+		return nil, err
+	}
+	return openTable(path, w.num, s.opts.Pool, &s.openTables)
+}
+
+func (s *LSMStore) tablePath(num uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%06d%s", num, tableSuffix))
+}
+
+// Close stops background compaction, then closes the log and every
+// sstable. Anything left in the memtable is recovered from the log
+// when the store is reopened.
+func (s *LSMStore) Close() error {
+	close(s.closing)
+	s.wg.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.log.Close()
+	if cerr := s.closeTables(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// closeTables releases the store's references to its tables. Tables
+// still being read by a cursor are closed once it's done with them.
+func (s *LSMStore) closeTables() error {
+	var err error
+	for _, tables := range s.levels {
+		for _, t := range tables {
+			if cerr := t.unref(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
+
+// syncDir syncs a directory so that renames and new files in it
+// are durable.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
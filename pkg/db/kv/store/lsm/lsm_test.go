@@ -0,0 +1,537 @@
+package lsm_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/buffer"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/lsm"
+	"github.com/angles-n-daemons/popsql/pkg/test/assert"
+)
+
+// smallOptions makes the memtable flush every few writes, so that
+// tests exercise reads across several sstables.
+func smallOptions() *lsm.Options {
+	return &lsm.Options{MemtableSize: 64, BlockSize: 32}
+}
+
+func key(i int) string {
+	return fmt.Sprintf("key%04d", i)
+}
+
+func countTables(t *testing.T, dir string) int {
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	count := 0
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".sst") {
+			count++
+		}
+	}
+	return count
+}
+
+func TestLSMStoreGet(t *testing.T) {
+	dir := t.TempDir()
+	st, err := lsm.NewStore(dir, smallOptions())
+	assert.NoError(t, err)
+	defer st.Close()
+
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, st.Put(key(i), []byte(fmt.Sprintf("val%d", i))))
+	}
+	if countTables(t, dir) < 2 {
+		t.Fatalf("expected the memtable to be flushed to multiple sstables")
+	}
+
+	for i := 0; i < 100; i++ {
+		val, err := st.Get(key(i))
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("val%d", i), string(val))
+	}
+	val, err := st.Get("missing")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+}
+
+func TestLSMStoreNewestWins(t *testing.T) {
+	st, err := lsm.NewStore(t.TempDir(), smallOptions())
+	assert.NoError(t, err)
+	defer st.Close()
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 20; i++ {
+			assert.NoError(t, st.Put(key(i), []byte(fmt.Sprintf("round%d", round))))
+		}
+		assert.NoError(t, st.Flush())
+	}
+	// leave the newest version of a few keys in the memtable.
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, st.Put(key(i), []byte("mem")))
+	}
+
+	for i := 0; i < 20; i++ {
+		expected := "round2"
+		if i < 5 {
+			expected = "mem"
+		}
+		val, err := st.Get(key(i))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(val))
+	}
+
+	cur, err := st.Scan(key(3), key(7))
+	assert.NoError(t, err)
+	vals, err := cur.ReadAll()
+	assert.NoError(t, err)
+	actual := []string{}
+	for _, v := range vals {
+		actual = append(actual, string(v))
+	}
+	assert.Equal(t, []string{"mem", "mem", "round2", "round2"}, actual)
+	assert.True(t, cur.IsAtEnd())
+}
+
+func TestLSMStoreScan(t *testing.T) {
+	st, err := lsm.NewStore(t.TempDir(), smallOptions())
+	assert.NoError(t, err)
+	defer st.Close()
+
+	// interleave the keys across tables and the memtable.
+	for i := 0; i < 50; i += 2 {
+		assert.NoError(t, st.Put(key(i), []byte(key(i))))
+	}
+	assert.NoError(t, st.Flush())
+	for i := 1; i < 50; i += 2 {
+		assert.NoError(t, st.Put(key(i), []byte(key(i))))
+	}
+
+	for _, test := range []struct {
+		start, end string
+		expected   []string
+	}{
+		{"", "zzz", nil},
+		{key(10), key(15), []string{key(10), key(11), key(12), key(13), key(14)}},
+		{key(48), "zzz", []string{key(48), key(49)}},
+		{"zzz", "zzzz", []string{}},
+		{key(20), key(20), []string{}},
+	} {
+		t.Run(fmt.Sprintf("start=%s, end=%s", test.start, test.end), func(t *testing.T) {
+			cur, err := st.Scan(test.start, test.end)
+			assert.NoError(t, err)
+			vals, err := cur.ReadAll()
+			assert.NoError(t, err)
+			if test.expected == nil {
+				assert.Equal(t, 50, len(vals))
+				return
+			}
+			actual := []string{}
+			for _, v := range vals {
+				actual = append(actual, string(v))
+			}
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestLSMStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	st, err := lsm.NewStore(dir, smallOptions())
+	assert.NoError(t, err)
+	for i := 0; i < 30; i++ {
+		assert.NoError(t, st.Put(key(i), []byte(fmt.Sprintf("val%d", i))))
+	}
+	// this write is only in the log when the store is closed.
+	assert.NoError(t, st.Put(key(0), []byte("latest")))
+	assert.NoError(t, st.Close())
+
+	// a temp file from an interrupted flush should be ignored.
+	err = os.WriteFile(filepath.Join(dir, "999999.sst.tmp"), []byte("junk"), 0644)
+	assert.NoError(t, err)
+
+	st, err = lsm.NewStore(dir, smallOptions())
+	assert.NoError(t, err)
+	defer st.Close()
+	for i := 0; i < 30; i++ {
+		expected := fmt.Sprintf("val%d", i)
+		if i == 0 {
+			expected = "latest"
+		}
+		val, err := st.Get(key(i))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(val))
+	}
+	_, err = os.Stat(filepath.Join(dir, "999999.sst.tmp"))
+	assert.True(t, os.IsNotExist(err))
+
+	// new tables shouldn't collide with the ones already on disk.
+	before := countTables(t, dir)
+	assert.NoError(t, st.Put("another", []byte("value")))
+	assert.NoError(t, st.Flush())
+	assert.Equal(t, before+1, countTables(t, dir))
+}
+
+func TestLSMStoreMissingManifest(t *testing.T) {
+	dir := t.TempDir()
+	st, err := lsm.NewStore(dir, smallOptions())
+	assert.NoError(t, err)
+	for i := 0; i < 30; i++ {
+		assert.NoError(t, st.Put(key(i), []byte(fmt.Sprintf("val%d", i))))
+	}
+	assert.NoError(t, st.Close())
+
+	// without the manifest there's no telling which level each of
+	// the tables belongs to.
+	assert.NoError(t, os.Remove(filepath.Join(dir, "MANIFEST")))
+	_, err = lsm.NewStore(dir, smallOptions())
+	assert.IsError(t, err, fmt.Sprintf("sstables in '%s' have no manifest", dir))
+}
+
+func TestLSMStoreBloomFilter(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		opts    *lsm.Options
+		maxRate float64
+	}{
+		{"default", &lsm.Options{}, 0.03},
+		{"false positive rate", &lsm.Options{FalsePositiveRate: 0.1}, 0.2},
+		{"bits per key", &lsm.Options{BitsPerKey: 16}, 0.01},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			st, err := lsm.NewStore(t.TempDir(), test.opts)
+			assert.NoError(t, err)
+			defer st.Close()
+
+			for i := 0; i < 2000; i += 2 {
+				assert.NoError(t, st.Put(key(i), []byte("val")))
+			}
+			assert.NoError(t, st.Flush())
+
+			for i := 0; i < 2000; i += 2 {
+				val, err := st.Get(key(i))
+				assert.NoError(t, err)
+				assert.Equal(t, "val", string(val))
+			}
+			stats := st.Stats()
+			assert.Equal(t, uint64(0), stats.FilterHits)
+			assert.Equal(t, uint64(1000), stats.FilterMisses)
+			assert.Equal(t, uint64(0), stats.FilterFalsePositives)
+
+			// the odd keys fall within the table's range, but were never
+			// written.
+			for i := 1; i < 1999; i += 2 {
+				val, err := st.Get(key(i))
+				assert.NoError(t, err)
+				assert.Nil(t, val)
+			}
+			stats = st.Stats()
+			assert.Equal(t, uint64(1999), stats.FilterHits+stats.FilterMisses)
+			assert.Equal(t, stats.FilterMisses-1000, stats.FilterFalsePositives)
+			rate := float64(stats.FilterFalsePositives) / 999
+			if rate > test.maxRate {
+				t.Fatalf("false positive rate %f is above %f", rate, test.maxRate)
+			}
+		})
+	}
+}
+
+func TestLSMStoreBufferPool(t *testing.T) {
+	pool := buffer.NewPool(1<<20, buffer.Clock)
+	opts := smallOptions()
+	opts.Pool = pool
+	// keep compaction from reading blocks in the background.
+	opts.L0CompactionTrigger = 1000
+	st, err := lsm.NewStore(t.TempDir(), opts)
+	assert.NoError(t, err)
+	defer st.Close()
+
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, st.Put(key(i), []byte(fmt.Sprintf("val%d", i))))
+	}
+	assert.NoError(t, st.Flush())
+
+	scan := func() {
+		cur, err := st.Scan("", "zzz")
+		assert.NoError(t, err)
+		vals, err := cur.ReadAll()
+		assert.NoError(t, err)
+		assert.Equal(t, 100, len(vals))
+	}
+	scan()
+	first := pool.Stats()
+	if first.Misses == 0 {
+		t.Fatalf("expected the first scan to read blocks from disk")
+	}
+
+	// the second scan is served from the pool.
+	scan()
+	second := pool.Stats()
+	assert.Equal(t, first.Misses, second.Misses)
+	assert.Equal(t, first.Hits+first.Misses, second.Hits-first.Hits)
+	assert.Equal(t, 0, second.Pinned)
+}
+
+func compactionOptions() *lsm.Options {
+	return &lsm.Options{
+		MemtableSize:        64,
+		BlockSize:           32,
+		TableSize:           256,
+		L0CompactionTrigger: 2,
+		LevelSize:           512,
+	}
+}
+
+func TestLSMStoreCompact(t *testing.T) {
+	dir := t.TempDir()
+	st, err := lsm.NewStore(dir, compactionOptions())
+	assert.NoError(t, err)
+
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 100; i++ {
+			assert.NoError(t, st.Put(key(i), []byte(fmt.Sprintf("round%d-%d", round, i))))
+		}
+		assert.NoError(t, st.Flush())
+	}
+
+	// a cursor opened before compaction keeps reading from the tables
+	// it started with, even once they've been replaced.
+	cur, err := st.Scan("", "zzz")
+	assert.NoError(t, err)
+	assert.NoError(t, st.Compact())
+	vals, err := cur.ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, 100, len(vals))
+
+	check := func() {
+		for i := 0; i < 100; i++ {
+			val, err := st.Get(key(i))
+			assert.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("round4-%d", i), string(val))
+		}
+		cur, err := st.Scan(key(10), key(20))
+		assert.NoError(t, err)
+		vals, err := cur.ReadAll()
+		assert.NoError(t, err)
+		assert.Equal(t, 10, len(vals))
+		assert.Equal(t, "round4-10", string(vals[0]))
+	}
+	check()
+
+	// overwritten versions are dropped, so the compacted tables hold
+	// little more than one round of writes.
+	var size int64
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".sst") {
+			info, err := file.Info()
+			assert.NoError(t, err)
+			size += info.Size()
+		}
+	}
+	if size > 4*1024 {
+		t.Fatalf("expected overwritten values to be compacted away, tables hold %d bytes", size)
+	}
+
+	// the compacted tables are loaded from the manifest on reopen.
+	assert.NoError(t, st.Close())
+	tables := countTables(t, dir)
+	st, err = lsm.NewStore(dir, compactionOptions())
+	assert.NoError(t, err)
+	defer st.Close()
+	check()
+	assert.Equal(t, tables, countTables(t, dir))
+}
+
+func TestLSMStoreBackgroundCompaction(t *testing.T) {
+	dir := t.TempDir()
+	st, err := lsm.NewStore(dir, compactionOptions())
+	assert.NoError(t, err)
+	defer st.Close()
+
+	for i := 0; i < 2000; i++ {
+		assert.NoError(t, st.Put(key(i%200), []byte(fmt.Sprintf("val%d", i))))
+	}
+	for i := 1800; i < 2000; i++ {
+		val, err := st.Get(key(i % 200))
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("val%d", i), string(val))
+	}
+	cur, err := st.Scan("", "zzz")
+	assert.NoError(t, err)
+	vals, err := cur.ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, 200, len(vals))
+}
+
+func TestLSMStoreDelete(t *testing.T) {
+	dir := t.TempDir()
+	st, err := lsm.NewStore(dir, smallOptions())
+	assert.NoError(t, err)
+
+	for i := 0; i < 50; i++ {
+		assert.NoError(t, st.Put(key(i), []byte(key(i))))
+	}
+	assert.NoError(t, st.Flush())
+	// delete the even keys, leaving some tombstones in the memtable
+	// and some in tables, shadowing values in older tables.
+	for i := 0; i < 50; i += 2 {
+		assert.NoError(t, st.Delete(key(i)))
+	}
+	assert.NoError(t, st.Delete("missing"))
+
+	check := func() {
+		for i := 0; i < 50; i++ {
+			val, err := st.Get(key(i))
+			assert.NoError(t, err)
+			if i%2 == 0 {
+				assert.Nil(t, val)
+			} else {
+				assert.Equal(t, key(i), string(val))
+			}
+		}
+		cur, err := st.Scan(key(10), key(20))
+		assert.NoError(t, err)
+		vals, err := cur.ReadAll()
+		assert.NoError(t, err)
+		actual := []string{}
+		for _, v := range vals {
+			actual = append(actual, string(v))
+		}
+		assert.Equal(t, []string{key(11), key(13), key(15), key(17), key(19)}, actual)
+	}
+	check()
+
+	// a put after a delete brings the key back.
+	assert.NoError(t, st.Put(key(0), []byte("back")))
+	val, err := st.Get(key(0))
+	assert.NoError(t, err)
+	assert.Equal(t, "back", string(val))
+	assert.NoError(t, st.Delete(key(0)))
+
+	// tombstones in the log are replayed on reopen.
+	assert.NoError(t, st.Close())
+	st, err = lsm.NewStore(dir, smallOptions())
+	assert.NoError(t, err)
+	defer st.Close()
+	check()
+}
+
+func TestLSMStoreCompactionDropsTombstones(t *testing.T) {
+	dir := t.TempDir()
+	// only flush when asked, so that the values and the tombstones
+	// are compacted together.
+	opts := compactionOptions()
+	opts.MemtableSize = 1 << 20
+	st, err := lsm.NewStore(dir, opts)
+	assert.NoError(t, err)
+	defer st.Close()
+
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, st.Put(key(i), []byte(key(i))))
+	}
+	assert.NoError(t, st.Flush())
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, st.Delete(key(i)))
+	}
+	assert.NoError(t, st.Flush())
+	assert.NoError(t, st.Compact())
+
+	// with nothing below them, the tombstones are dropped along with
+	// the values they deleted, leaving no tables at all.
+	assert.Equal(t, 0, countTables(t, dir))
+	cur, err := st.Scan("", "zzz")
+	assert.NoError(t, err)
+	assert.True(t, cur.IsAtEnd())
+}
+
+func TestLSMStoreWriteBatch(t *testing.T) {
+	dir := t.TempDir()
+	st, err := lsm.NewStore(dir, smallOptions())
+	assert.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, st.Put(key(i), []byte(key(i))))
+	}
+
+	// a batch large enough to fill the memtable is still applied
+	// whole before it's flushed.
+	batch := kv.NewWriteBatch()
+	for i := 0; i < 20; i += 2 {
+		assert.NoError(t, batch.Delete(key(i)))
+	}
+	for i := 20; i < 40; i++ {
+		assert.NoError(t, batch.Put(key(i), []byte(key(i))))
+	}
+	assert.NoError(t, st.Write(batch))
+	assert.NoError(t, st.Write(kv.NewWriteBatch()))
+
+	check := func() {
+		for i := 0; i < 40; i++ {
+			val, err := st.Get(key(i))
+			assert.NoError(t, err)
+			if i < 20 && i%2 == 0 {
+				assert.Nil(t, val)
+			} else {
+				assert.Equal(t, key(i), string(val))
+			}
+		}
+	}
+	check()
+
+	assert.NoError(t, st.Close())
+	st, err = lsm.NewStore(dir, smallOptions())
+	assert.NoError(t, err)
+	defer st.Close()
+	check()
+}
+
+func TestLSMStoreCompactClosesTables(t *testing.T) {
+	dir := t.TempDir()
+	opts := compactionOptions()
+	// only flush by hand, so that the number of tables is known.
+	opts.MemtableSize = 1 << 20
+	opts.L0CompactionTrigger = 3
+	st, err := lsm.NewStore(dir, opts)
+	assert.NoError(t, err)
+	defer st.Close()
+
+	write := func(round int) {
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, st.Put(key(i), []byte(fmt.Sprintf("round%d-%d", round, i))))
+		}
+	}
+	write(0)
+	assert.NoError(t, st.Flush())
+	write(1)
+	assert.NoError(t, st.Flush())
+	write(2)
+	assert.Equal(t, int64(2), st.Stats().OpenTables)
+
+	// one cursor reads to its end, the other stops early and is
+	// closed. The two tables they read stay open until both are done.
+	finished, err := st.Scan("", "zzz")
+	assert.NoError(t, err)
+	stopped, err := st.Scan("", "zzz")
+	assert.NoError(t, err)
+	_, err = stopped.Read(1)
+	assert.NoError(t, err)
+
+	// the third table triggers a compaction, which replaces all three.
+	assert.NoError(t, st.Flush())
+	assert.NoError(t, st.Compact())
+	after := countTables(t, dir)
+	assert.Equal(t, int64(after+2), st.Stats().OpenTables)
+
+	vals, err := finished.ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, 10, len(vals))
+	assert.Equal(t, "round2-0", string(vals[0]))
+	assert.Equal(t, int64(after+2), st.Stats().OpenTables)
+
+	assert.NoError(t, stopped.(*lsm.Cursor).Close())
+	assert.Equal(t, int64(after), st.Stats().OpenTables)
+}
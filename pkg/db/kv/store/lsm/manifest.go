@@ -0,0 +1,61 @@
+package lsm
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const manifestName = "MANIFEST"
+
+// manifest is the record of which sstables make up the store, and
+// the level each of them belongs to. Flushes and compactions change
+// the set of tables by writing a new manifest, which is swapped in
+// with a rename so that the change is atomic.
+type manifest struct {
+	NextTable uint64     `json:"next_table"`
+	Levels    [][]uint64 `json:"levels"`
+}
+
+// readManifest reads the manifest from the directory, returning nil
+// if there isn't one.
+func readManifest(dir string) (*manifest, error) {
+	b, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m *manifest
+	err = json.Unmarshal(b, &m)
+	return m, err
+}
+
+// writeManifest replaces the manifest in the directory.
+func writeManifest(dir string, m *manifest) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, manifestName)
+	f, err := os.OpenFile(path+tmpSuffix, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(path+tmpSuffix, path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
@@ -0,0 +1,451 @@
+package lsm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sort"
+	"sync/atomic"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/buffer"
+)
+
+/*
+An sstable, or sorted string table, is an immutable file holding
+entries sorted by key. The memtable is written out as one when it
+fills up. Its layout is:
+
+	+--------------+-----+--------------+--------------+-------------+--------+
+	| data block 0 | ... | data block n | filter block | index block | footer |
+	+--------------+-----+--------------+--------------+-------------+--------+
+
+Data blocks hold entries back to back, each encoded as:
+
+	kind byte | uvarint key length | key | uvarint value length | value
+
+The filter block is a bloom filter over every key in the table.
+
+The index block starts with the smallest key in the table, then has
+a handle for each data block made up of the block's last key, its
+offset and its size, and ends with the offset and size of the filter
+block. Every block ends in a crc32 checksum.
+
+The footer is a fixed size, and holds the offset and size of the
+index block followed by a magic number identifying the file.
+*/
+
+const (
+	tableMagic  uint64 = 0x706f7073716c7374 // "popsqlst"
+	footerSize         = 24
+	checksumLen        = 4
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var errCorruptTable = errors.New("corrupt sstable")
+
+// kind distinguishes the different types of entries that can be
+// stored in the memtable and sstables.
+type kind byte
+
+const (
+	kindPut kind = iota + 1
+	// kindDelete is a tombstone, marking that the key was deleted.
+	kindDelete
+)
+
+type entry struct {
+	key   string
+	kind  kind
+	value []byte
+}
+
+// visible returns the value of the entry as seen by a reader, which
+// is nil for a tombstone.
+func (e entry) visible() ([]byte, error) {
+	switch e.kind {
+	case kindPut:
+		return e.value, nil
+	case kindDelete:
+		return nil, nil
+	default:
+		return nil, errCorruptTable
+	}
+}
+
+// blockHandle is the index's reference to a data block.
+type blockHandle struct {
+	lastKey string
+	offset  uint64
+	size    uint64
+}
+
+// tableWriter writes a stream of sorted entries out to a new sstable.
+type tableWriter struct {
+	num       uint64
+	f         *os.File
+	w         *bufio.Writer
+	blockSize int
+	offset    uint64
+	block     []byte
+	smallest  string
+	lastKey   string
+	count     int
+	index     []blockHandle
+	filter    filterWriter
+}
+
+func newTableWriter(path string, num uint64, blockSize, bitsPerKey int) (*tableWriter, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &tableWriter{
+		num:       num,
+		f:         f,
+		w:         bufio.NewWriter(f),
+		blockSize: blockSize,
+		filter:    filterWriter{bitsPerKey: bitsPerKey},
+	}, nil
+}
+
+// add appends an entry to the table. Entries must be added in
+// strictly increasing key order.
+func (w *tableWriter) add(e entry) error {
+	if w.count > 0 && e.key <= w.lastKey {
+		return fmt.Errorf("sstable keys out of order, '%s' added after '%s'", e.key, w.lastKey)
+	}
+	if w.count == 0 {
+		w.smallest = e.key
+	}
+	w.block = appendEntry(w.block, e)
+	w.filter.add(e.key)
+	w.lastKey = e.key
+	w.count++
+	if len(w.block) >= w.blockSize {
+		return w.finishBlock()
+	}
+	return nil
+}
+
+// size is the approximate number of bytes written to the table.
+func (w *tableWriter) size() int {
+	return int(w.offset) + len(w.block)
+}
+
+func (w *tableWriter) finishBlock() error {
+	if len(w.block) == 0 {
+		return nil
+	}
+	handle, err := w.writeBlock(w.block)
+	if err != nil {
+		return err
+	}
+	handle.lastKey = w.lastKey
+	w.index = append(w.index, handle)
+	w.block = w.block[:0]
+	return nil
+}
+
+func (w *tableWriter) writeBlock(b []byte) (blockHandle, error) {
+	b = binary.BigEndian.AppendUint32(b, crc32.Checksum(b, crcTable))
+	_, err := w.w.Write(b)
+	if err != nil {
+		return blockHandle{}, err
+	}
+	handle := blockHandle{offset: w.offset, size: uint64(len(b))}
+	w.offset += uint64(len(b))
+	return handle, nil
+}
+
+// finish writes out the remaining data, the filter, the index and
+// the footer, and syncs the file to disk.
+func (w *tableWriter) finish() error {
+	if err := w.finishBlock(); err != nil {
+		return err
+	}
+	filterHandle, err := w.writeBlock(w.filter.build())
+	if err != nil {
+		return err
+	}
+
+	index := appendString(nil, w.smallest)
+	index = binary.AppendUvarint(index, uint64(len(w.index)))
+	for _, h := range w.index {
+		index = appendString(index, h.lastKey)
+		index = binary.AppendUvarint(index, h.offset)
+		index = binary.AppendUvarint(index, h.size)
+	}
+	index = binary.AppendUvarint(index, filterHandle.offset)
+	index = binary.AppendUvarint(index, filterHandle.size)
+	indexHandle, err := w.writeBlock(index)
+	if err != nil {
+		return err
+	}
+
+	footer := make([]byte, 0, footerSize)
+	footer = binary.BigEndian.AppendUint64(footer, indexHandle.offset)
+	footer = binary.BigEndian.AppendUint64(footer, indexHandle.size)
+	footer = binary.BigEndian.AppendUint64(footer, tableMagic)
+	if _, err = w.w.Write(footer); err != nil {
+		return err
+	}
+	if err = w.w.Flush(); err != nil {
+		return err
+	}
+	if err = w.f.Sync(); err != nil {
+		return err
+	}
+	return w.f.Close()
+}
+
+// abort abandons the table, removing the partially written file.
+func (w *tableWriter) abort() {
+	w.f.Close()
+	os.Remove(w.f.Name())
+}
+
+// table is an open, read only sstable.
+type table struct {
+	num      uint64
+	f        *os.File
+	size     int64
+	smallest string
+	largest  string
+	index    []blockHandle
+	filter   filter
+	// data blocks are cached in the pool under the id file.
+	pool *buffer.Pool
+	file uint64
+	// refs counts the references to the table: the store's, while the
+	// table is part of the tree, and one for each cursor reading it.
+	// The table is closed once the last of them is released.
+	refs atomic.Int32
+	// open counts the store's open tables.
+	open *atomic.Int64
+}
+
+// openTable opens the table at path, with a single reference to it
+// held by the caller.
+func openTable(path string, num uint64, pool *buffer.Pool, open *atomic.Int64) (*table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &table{num: num, f: f, pool: pool, file: pool.NewFile(), open: open}
+	if err = t.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to open sstable '%s': %w", path, err)
+	}
+	t.refs.Store(1)
+	open.Add(1)
+	return t, nil
+}
+
+// load reads the footer and index of the table into memory.
+func (t *table) load() error {
+	info, err := t.f.Stat()
+	if err != nil {
+		return err
+	}
+	t.size = info.Size()
+	if t.size < footerSize {
+		return errCorruptTable
+	}
+
+	footer := make([]byte, footerSize)
+	if _, err = t.f.ReadAt(footer, t.size-footerSize); err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint64(footer[16:24]) != tableMagic {
+		return errCorruptTable
+	}
+	index, err := t.readRaw(blockHandle{
+		offset: binary.BigEndian.Uint64(footer[0:8]),
+		size:   binary.BigEndian.Uint64(footer[8:16]),
+	})
+	if err != nil {
+		return err
+	}
+
+	t.smallest, index, err = readString(index)
+	if err != nil {
+		return err
+	}
+	count, n := binary.Uvarint(index)
+	if n <= 0 {
+		return errCorruptTable
+	}
+	index = index[n:]
+	t.index = make([]blockHandle, count)
+	for i := range t.index {
+		var h blockHandle
+		h.lastKey, index, err = readString(index)
+		if err != nil {
+			return err
+		}
+		if h.offset, n = binary.Uvarint(index); n <= 0 {
+			return errCorruptTable
+		}
+		index = index[n:]
+		if h.size, n = binary.Uvarint(index); n <= 0 {
+			return errCorruptTable
+		}
+		index = index[n:]
+		t.index[i] = h
+	}
+	if count > 0 {
+		t.largest = t.index[count-1].lastKey
+	}
+
+	var h blockHandle
+	if h.offset, n = binary.Uvarint(index); n <= 0 {
+		return errCorruptTable
+	}
+	index = index[n:]
+	if h.size, n = binary.Uvarint(index); n <= 0 {
+		return errCorruptTable
+	}
+	t.filter, err = t.readRaw(h)
+	return err
+}
+
+// readRaw reads a block from the file, verifying and stripping off
+// its checksum.
+func (t *table) readRaw(h blockHandle) ([]byte, error) {
+	if h.size < checksumLen || int64(h.offset+h.size) > t.size {
+		return nil, errCorruptTable
+	}
+	b := make([]byte, h.size)
+	if _, err := t.f.ReadAt(b, int64(h.offset)); err != nil {
+		return nil, err
+	}
+	data, sum := b[:len(b)-checksumLen], b[len(b)-checksumLen:]
+	if crc32.Checksum(data, crcTable) != binary.BigEndian.Uint32(sum) {
+		return nil, errCorruptTable
+	}
+	return data, nil
+}
+
+// readBlock reads and decodes the ith data block of the table,
+// through the buffer pool. The entries share the block's memory,
+// which the pool never reuses.
+func (t *table) readBlock(i int) ([]entry, error) {
+	h := t.index[i]
+	frame, err := t.pool.Get(buffer.PageID{File: t.file, Offset: h.offset}, func() ([]byte, error) {
+		return t.readRaw(h)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer t.pool.Unpin(frame)
+	b := frame.Data()
+	entries := []entry{}
+	for len(b) > 0 {
+		var e entry
+		e, b, err = readEntry(b)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// findBlock returns the index of the first block which could hold
+// the key, or len(t.index) if the key is past the end of the table.
+func (t *table) findBlock(key string) int {
+	return sort.Search(len(t.index), func(i int) bool {
+		return t.index[i].lastKey >= key
+	})
+}
+
+// covers returns whether the key falls within the table's range.
+func (t *table) covers(key string) bool {
+	return key >= t.smallest && key <= t.largest
+}
+
+// get looks up a single key in the table.
+func (t *table) get(key string) (entry, bool, error) {
+	if !t.covers(key) {
+		return entry{}, false, nil
+	}
+	i := t.findBlock(key)
+	if i == len(t.index) {
+		return entry{}, false, nil
+	}
+	entries, err := t.readBlock(i)
+	if err != nil {
+		return entry{}, false, err
+	}
+	j := sort.Search(len(entries), func(j int) bool {
+		return entries[j].key >= key
+	})
+	if j < len(entries) && entries[j].key == key {
+		return entries[j], true, nil
+	}
+	return entry{}, false, nil
+}
+
+// evict drops the table's blocks from the buffer pool.
+func (t *table) evict() {
+	t.pool.DropFile(t.file)
+}
+
+func (t *table) ref() {
+	t.refs.Add(1)
+}
+
+// unref releases a reference to the table, closing it if it was the
+// last one.
+func (t *table) unref() error {
+	if t.refs.Add(-1) > 0 {
+		return nil
+	}
+	t.evict()
+	t.open.Add(-1)
+	return t.f.Close()
+}
+
+func appendEntry(b []byte, e entry) []byte {
+	b = append(b, byte(e.kind))
+	b = appendString(b, e.key)
+	b = binary.AppendUvarint(b, uint64(len(e.value)))
+	return append(b, e.value...)
+}
+
+func readEntry(b []byte) (entry, []byte, error) {
+	if len(b) < 1 {
+		return entry{}, nil, errCorruptTable
+	}
+	e := entry{kind: kind(b[0])}
+	var err error
+	e.key, b, err = readString(b[1:])
+	if err != nil {
+		return entry{}, nil, err
+	}
+	l, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < l {
+		return entry{}, nil, errCorruptTable
+	}
+	b = b[n:]
+	e.value = b[:l:l]
+	return e, b[l:], nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func readString(b []byte) (string, []byte, error) {
+	l, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < l {
+		return "", nil, errCorruptTable
+	}
+	b = b[n:]
+	return string(b[:l]), b[l:], nil
+}
@@ -16,7 +16,7 @@ func (m *Memcursor) ReadAll() ([][]byte, error) {
 func (m *Memcursor) Read(num int) ([][]byte, error) {
 	vals := [][]byte{}
 	for i := 0; i < num && !m.IsAtEnd(); i++ {
-		vals = append(vals, m.Node.Val)
+		vals = append(vals, m.Node.Val())
 		m.Node = m.Node.Next()
 
 	}
@@ -27,7 +27,7 @@ func (m *Memcursor) Next() ([]byte, error) {
 	if m.IsAtEnd() {
 		return nil, nil
 	}
-	val := m.Node.Val
+	val := m.Node.Val()
 	m.Node = m.Node.Next()
 	return val, nil
 }
@@ -35,3 +35,17 @@ func (m *Memcursor) Next() ([]byte, error) {
 func (m *Memcursor) IsAtEnd() bool {
 	return m.Node == nil || m.End <= m.Node.Key
 }
+
+// Close moves the cursor to its end. The skiplist holds nothing
+// open for it, so there's nothing to release.
+func (m *Memcursor) Close() error {
+	m.Node = nil
+	return nil
+}
+
+func (m *Memcursor) Key() string {
+	if m.IsAtEnd() {
+		return ""
+	}
+	return m.Node.Key
+}
@@ -1,6 +1,10 @@
 package memtable
 
-import "github.com/angles-n-daemons/popsql/pkg/db/kv"
+import (
+	"sync"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv"
+)
 
 // Memstore is a struct which satisfies the Store interface
 // and works entirely in memory. It's useful for testing the behavior of the system.
@@ -11,8 +15,12 @@ func NewStore() *Memstore {
 }
 
 // Memstore is an in-memory key-value store designed to satisfy the Store interface.
+// It's safe for concurrent use, since its skiplist is.
 type Memstore struct {
 	List *Skiplist[string, []byte]
+	// mu is held by writers, so that a batch isn't interleaved with
+	// other writes. Readers don't need it.
+	mu sync.Mutex
 }
 
 // Get retrieves the value associated with the given key.
@@ -31,7 +39,7 @@ func (m *Memstore) Get(key string) ([]byte, error) {
 	if node == nil {
 		return nil, nil
 	}
-	return node.Val, nil
+	return node.Val(), nil
 }
 
 // GetRange retrieves a range of elements from the Memstore starting from the
@@ -45,20 +53,11 @@ func (m *Memstore) Get(key string) ([]byte, error) {
 // - kv.Cursor: A cursor pointing to the start of the range within the Memstore.
 // - error: An error if the range cannot be retrieved.
 //
-// The function searches for the node corresponding to the 'start' key. If the node
-// is not found, it attempts to use the previous node's next pointer. If still not
-// found, it defaults to the head of the list. The returned cursor will iterate
-// from the found node up to the 'end' key.
+// The function seeks to the first node whose key is at or after the 'start' key.
+// The returned cursor will iterate from the found node up to the 'end' key.
 func (m *Memstore) Scan(start, end string) (kv.Cursor, error) {
-	node, prevs := m.List.Search(start)
-	if node == nil && prevs[0] != nil {
-		node = prevs[0].Next()
-	}
-	if node == nil {
-		node = m.List.Head()
-	}
 	return &Memcursor{
-		Node: node,
+		Node: m.List.Seek(start),
 		End:  end,
 	}, nil
 }
@@ -75,6 +74,59 @@ func (m *Memstore) Scan(start, end string) (kv.Cursor, error) {
 //
 //	error - An error if there is an issue storing the key-value pair, otherwise nil.
 func (m *Memstore) Put(key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.put(key, value)
+}
+
+func (m *Memstore) put(key string, value []byte) error {
 	_, err := m.List.Put(key, value)
 	return err
 }
+
+// Delete removes the given key from the Memstore.
+// Since the Memstore keeps no history, the key is removed from the
+// skiplist outright rather than being marked with a tombstone.
+//
+// Parameters:
+//
+//	key - The key to be removed.
+//
+// Returns:
+//
+//	error - Always nil, deleting a key which doesn't exist does nothing.
+func (m *Memstore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.List.Delete(key)
+	return nil
+}
+
+// Write applies each of the writes in the batch to the Memstore.
+// No other write is applied until the whole batch has been, but
+// since readers take no locks, a concurrent reader may see the batch
+// part way through being applied.
+//
+// Parameters:
+//
+//	batch - The puts and deletes to apply, in order.
+//
+// Returns:
+//
+//	error - An error if any of the writes fail, otherwise nil.
+func (m *Memstore) Write(batch *kv.WriteBatch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, op := range batch.Ops {
+		var err error
+		if op.Delete {
+			m.List.Delete(op.Key)
+		} else {
+			err = m.put(op.Key, op.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/angles-n-daemons/popsql/pkg/db/kv"
 	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/memtable"
 )
 
@@ -132,3 +133,81 @@ func TestMemstoreRanges(t *testing.T) {
 		})
 	}
 }
+
+func TestMemstoreScanPastEnd(t *testing.T) {
+	store := memtable.NewStore()
+	for _, key := range []string{"a", "b"} {
+		if err := store.Put(key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cur, err := store.Scan("c", "z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := cur.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertArraysEqual(t, [][]byte{}, result)
+}
+
+func TestMemstoreDelete(t *testing.T) {
+	store := memtable.NewStore()
+	for i := 0; i < 5; i++ {
+		if err := store.Put(strconv.Itoa(i), []byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Delete("2"); err != nil {
+		t.Fatal(err)
+	}
+	// deleting a missing key does nothing.
+	if err := store.Delete("missing"); err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := store.Get("2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != nil {
+		t.Fatalf(`expected deleted key to be nil but got '%s'`, val)
+	}
+
+	cur, err := store.Scan("0", "9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := cur.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertArraysEqual(t, [][]byte{[]byte("0"), []byte("1"), []byte("3"), []byte("4")}, actual)
+}
+
+func TestMemstoreWrite(t *testing.T) {
+	store := memtable.NewStore()
+	if err := store.Put("0", []byte("0")); err != nil {
+		t.Fatal(err)
+	}
+
+	batch := kv.NewWriteBatch()
+	batch.Delete("0")
+	batch.Put("1", []byte("1"))
+	batch.Put("2", []byte("x"))
+	batch.Put("2", []byte("2"))
+	if err := store.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	cur, err := store.Scan("0", "9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := cur.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertArraysEqual(t, [][]byte{[]byte("1"), []byte("2")}, actual)
+}
@@ -6,20 +6,39 @@ import (
 	"fmt"
 	"math/rand"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const MAX_UINT32 = ^uint32(0)
 const MAX_HEIGHT = 32
 
+// SkiplistNode is an element of the skiplist. Its value and links
+// are read and written atomically, so that readers can walk the list
+// while it's being written.
 type SkiplistNode[K cmp.Ordered, V any] struct {
 	Key  K
-	Val  V
-	next []*SkiplistNode[K, V]
+	val  atomic.Pointer[V]
+	next []atomic.Pointer[SkiplistNode[K, V]]
+}
+
+func newNode[K cmp.Ordered, V any](key K, val V, height int) *SkiplistNode[K, V] {
+	node := &SkiplistNode[K, V]{
+		Key:  key,
+		next: make([]atomic.Pointer[SkiplistNode[K, V]], height),
+	}
+	node.val.Store(&val)
+	return node
+}
+
+// Val returns the node's value.
+func (node *SkiplistNode[K, V]) Val() V {
+	return *node.val.Load()
 }
 
 func (node *SkiplistNode[K, V]) Next() *SkiplistNode[K, V] {
-	return node.next[0]
+	return node.next[0].Load()
 }
 
 /*
@@ -35,33 +54,40 @@ func (node *SkiplistNode[K, V]) Next() *SkiplistNode[K, V] {
 //     then set a node to update at i - 1
 //   - If a head is nil at level i, the update value at i will also
 //     be nil
+//
+// The skiplist is safe for concurrent use. Writers take turns by
+// holding mu, while readers take no locks at all. Every link is an
+// atomic pointer, and a writer only links a node in once it's fully
+// built, from the bottom level up, so a reader either sees the whole
+// node or doesn't see it yet. A deleted node keeps its links, so a
+// reader stood on it can carry on walking the list from it.
 type Skiplist[K cmp.Ordered, V any] struct {
-	Size   uint32
+	mu     sync.Mutex
+	size   atomic.Uint32
 	height int8
-	heads  []*SkiplistNode[K, V]
+	heads  []atomic.Pointer[SkiplistNode[K, V]]
 	rng    *rand.Rand
 }
 
 func NewSkiplist[K cmp.Ordered, V any]() *Skiplist[K, V] {
-	return &Skiplist[K, V]{
-		Size:   0,
-		height: MAX_HEIGHT,
-		heads:  make([]*SkiplistNode[K, V], MAX_HEIGHT),
-		rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
-	}
+	return NewSkiplistWithRandSource[K, V](rand.NewSource(time.Now().UnixNano()))
 }
 
 func NewSkiplistWithRandSource[K cmp.Ordered, V any](source rand.Source) *Skiplist[K, V] {
 	return &Skiplist[K, V]{
-		Size:   0,
 		height: MAX_HEIGHT,
-		heads:  make([]*SkiplistNode[K, V], MAX_HEIGHT),
+		heads:  make([]atomic.Pointer[SkiplistNode[K, V]], MAX_HEIGHT),
 		rng:    rand.New(source),
 	}
 }
 
+// Size returns the number of elements in the list.
+func (list *Skiplist[K, V]) Size() uint32 {
+	return list.size.Load()
+}
+
 func (list *Skiplist[K, V]) Head() *SkiplistNode[K, V] {
-	return list.heads[0]
+	return list.heads[0].Load()
 }
 
 /* Put takes a value and tries to insert it into the skiplist.
@@ -69,44 +95,36 @@ func (list *Skiplist[K, V]) Head() *SkiplistNode[K, V] {
  * It can error if the skiplist is full.
  */
 func (list *Skiplist[K, V]) Put(key K, val V) (bool, error) {
-	if list.Size >= MAX_UINT32 {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	if list.Size() >= MAX_UINT32 {
 		return false, errors.New("cannot put element in skiplist, at maximum size.")
 	}
 
 	node, prevs := list.Search(key)
 	if node != nil {
 		// if the node already exists, we change its value
-		node.Val = val
+		node.val.Store(&val)
 		return false, nil
 	}
 
 	// create the new node with a randomized height
 	height := list.genHeight(MAX_HEIGHT)
-	node = &SkiplistNode[K, V]{
-		Key:  key,
-		Val:  val,
-		next: make([]*SkiplistNode[K, V], height),
-	}
+	node = newNode(key, val, height)
 
-	// for each level in the nodes height, insert the node
-	// into that level's list
+	// point the node at its successors before linking it in, so
+	// that it's complete by the time a reader can reach it.
 	for i := range height {
-		if list.heads[i] == nil {
-			// if the head is nil at this level, the level is empty
-			list.heads[i] = node
-		} else if prevs[i] == nil {
-			// if the update value is nil, we never found a value
-			// < val so we insert the node before the head
-			node.next[i] = list.heads[i]
-			list.heads[i] = node
-		} else {
-			// otherwise, we insert the node after update
-			node.next[i] = prevs[i].next[i]
-			prevs[i].next[i] = node
-		}
+		node.next[i].Store(list.link(prevs[i], i).Load())
+	}
+	// then, for each level in the nodes height, insert the node
+	// into that level's list, after update or before the head if
+	// nothing at that level precedes it.
+	for i := range height {
+		list.link(prevs[i], i).Store(node)
 	}
 
-	list.Size++
+	list.size.Add(1)
 	return true, nil
 }
 
@@ -116,28 +134,50 @@ func (list *Skiplist[K, V]) Get(key K) *SkiplistNode[K, V] {
 	return node
 }
 
+// Seek returns the first element in the list whose key is greater
+// than or equal to the key passed in, or nil if there is none.
+func (list *Skiplist[K, V]) Seek(key K) *SkiplistNode[K, V] {
+	node, prevs := list.Search(key)
+	if node != nil {
+		return node
+	}
+	if prevs[0] != nil {
+		return prevs[0].Next()
+	}
+	// nothing in the list precedes the key, so it's the head.
+	return list.Head()
+}
+
 // Delete removes the element with the specified key from the list if it exists
 func (list *Skiplist[K, V]) Delete(key K) *SkiplistNode[K, V] {
+	list.mu.Lock()
+	defer list.mu.Unlock()
 	node, prevs := list.Search(key)
 	// If we didn't find the node, return nil
 	if node == nil {
 		return nil
 	}
 
-	// set the next pointer for the previous nodes
-	// to the node's next pointer (where applicable)
-	for i := 0; i < len(node.next); i++ {
-		if prevs[i] == nil {
-			list.heads[i] = node.next[i]
-		} else {
-			prevs[i].next[i] = node.next[i]
-		}
+	// set the next pointer for the previous nodes to the node's next
+	// pointer, from the top level down, so that a reader which finds
+	// the node on a lower level can still reach it until it's gone.
+	for i := len(node.next) - 1; i >= 0; i-- {
+		list.link(prevs[i], i).Store(node.next[i].Load())
 	}
 
-	list.Size--
+	list.size.Add(^uint32(0))
 	return node
 }
 
+// link returns the link at a level which points past prev, which is
+// the head of the level when prev is nil.
+func (list *Skiplist[K, V]) link(prev *SkiplistNode[K, V], level int) *atomic.Pointer[SkiplistNode[K, V]] {
+	if prev == nil {
+		return &list.heads[level]
+	}
+	return &prev.next[level]
+}
+
 // Search is an internal function, leveraged by Put, Get and Delete
 // it searches through the list for a value, returning a Search array
 // of nodes preceeding or equal to the node value.
@@ -150,14 +190,14 @@ func (list *Skiplist[K, V]) Search(key K) (*SkiplistNode[K, V], []*SkiplistNode[
 	prevs := make([]*SkiplistNode[K, V], list.height)
 
 	// Special case for when the head is the node we're looking for
-	if list.heads[0] != nil && list.heads[0].Key == key {
-		return list.heads[0], prevs
+	if head := list.Head(); head != nil && head.Key == key {
+		return head, prevs
 	}
 
 	// Start the search at the first head whose key is less than
 	// the one we are looking for
 	for level >= 0 {
-		cand := list.heads[level]
+		cand := list.heads[level].Load()
 		if cand != nil && cand.Key < key {
 			search = cand
 			break
@@ -172,7 +212,7 @@ func (list *Skiplist[K, V]) Search(key K) (*SkiplistNode[K, V], []*SkiplistNode[
 	// On these conditions, drop to the next level down and continue
 	// If the level is 0, exit the loop
 	for search != nil {
-		next := search.next[level]
+		next := search.next[level].Load()
 		// if the next value is greater at this level, or it is nil
 		// we can continue the search one level down
 		if next == nil || next.Key >= key {
@@ -210,10 +250,10 @@ func (list *Skiplist[K, V]) DebugGetRow(level int) ([]K, error) {
 		return nil, fmt.Errorf("cannot get level %d of skiplist with height %d", level, len(list.heads))
 	}
 	keys := []K{}
-	node := list.heads[level]
+	node := list.heads[level].Load()
 	for node != nil {
 		keys = append(keys, node.Key)
-		node = node.next[level]
+		node = node.next[level].Load()
 	}
 	return keys, nil
 }
@@ -231,7 +271,7 @@ func DebugPrintList[K cmp.Ordered, V any](list *Skiplist[K, V], levels int) {
 		lists[i] = []string{}
 	}
 
-	node := list.heads[0]
+	node := list.Head()
 	for node != nil {
 		height := len(node.next)
 		str := fmt.Sprintf("%v", node.Key)
@@ -242,7 +282,7 @@ func DebugPrintList[K cmp.Ordered, V any](list *Skiplist[K, V], levels int) {
 				lists[i] = append(lists[i], strings.Repeat("-", len(str)))
 			}
 		}
-		node = node.next[0]
+		node = node.Next()
 	}
 
 	for i := levels - 1; i >= 0; i-- {
@@ -0,0 +1,183 @@
+package memtable_test
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/memtable"
+)
+
+// These tests are most useful when run with the race detector:
+//
+//	go test -race ./pkg/db/kv/store/memtable
+
+const (
+	stressWorkers = 8
+	stressKeys    = 2000
+)
+
+// assertSorted walks the bottom level of the list, checking that its
+// keys are in order, and returns how many it found.
+func assertSorted(t *testing.T, list *memtable.Skiplist[int, int]) int {
+	count := 0
+	prev := -1
+	for node := list.Head(); node != nil; node = node.Next() {
+		if node.Key <= prev {
+			t.Errorf("expected key %d to follow %d in order", node.Key, prev)
+			return count
+		}
+		prev = node.Key
+		count++
+	}
+	return count
+}
+
+func TestSkiplistConcurrentPut(t *testing.T) {
+	list := memtable.NewSkiplist[int, int]()
+	var wg sync.WaitGroup
+	for w := range stressWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// each worker puts every key, so most puts race with
+			// another worker putting the same key.
+			rng := rand.New(rand.NewSource(int64(w)))
+			for _, k := range rng.Perm(stressKeys) {
+				if _, err := list.Put(k, k*10); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if list.Size() != stressKeys {
+		t.Fatalf("expected size %d, got %d", stressKeys, list.Size())
+	}
+	if count := assertSorted(t, list); count != stressKeys {
+		t.Fatalf("expected %d keys in the list, found %d", stressKeys, count)
+	}
+	for k := range stressKeys {
+		node := list.Get(k)
+		if node == nil || node.Val() != k*10 {
+			t.Fatalf("expected to find key %d with value %d", k, k*10)
+		}
+	}
+}
+
+func TestSkiplistConcurrentReadWrite(t *testing.T) {
+	list := memtable.NewSkiplist[int, int]()
+	// the even keys are never deleted, so readers can always expect
+	// to find them.
+	for k := 0; k < stressKeys; k += 2 {
+		list.Put(k, k)
+	}
+
+	var writers, readers sync.WaitGroup
+	done := make(chan struct{})
+	for w := range stressWorkers / 2 {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			rng := rand.New(rand.NewSource(int64(w)))
+			for range stressKeys * 2 {
+				k := rng.Intn(stressKeys)
+				switch {
+				case k%2 == 0:
+					// overwrite a value which readers are reading.
+					list.Put(k, k)
+				case rng.Intn(2) == 0:
+					list.Put(k, k)
+				default:
+					list.Delete(k)
+				}
+			}
+		}()
+	}
+	for r := range stressWorkers / 2 {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			rng := rand.New(rand.NewSource(int64(r)))
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				k := rng.Intn(stressKeys/2) * 2
+				node := list.Get(k)
+				if node == nil || node.Val() != k {
+					t.Errorf("expected to find key %d with value %d", k, k)
+					return
+				}
+				if seek := list.Seek(k + 1); seek != nil && seek.Key <= k {
+					t.Errorf("expected seek past %d to land after it, got %d", k, seek.Key)
+					return
+				}
+				if count := assertSorted(t, list); count < stressKeys/2 {
+					t.Errorf("expected at least %d keys in the list, found %d", stressKeys/2, count)
+					return
+				}
+			}
+		}()
+	}
+	writers.Wait()
+	close(done)
+	readers.Wait()
+
+	if count := assertSorted(t, list); count != int(list.Size()) {
+		t.Fatalf("expected %d keys in the list, found %d", list.Size(), count)
+	}
+}
+
+func TestMemstoreConcurrent(t *testing.T) {
+	m := memtable.NewStore()
+	key := func(i int) string {
+		return fmt.Sprintf("key%05d", i)
+	}
+
+	var wg sync.WaitGroup
+	for w := range stressWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < stressKeys; i += stressWorkers {
+				if err := m.Put(key(i), []byte(key(i))); err != nil {
+					t.Error(err)
+					return
+				}
+				// scan whatever has been written so far.
+				cur, err := m.Scan(key(0), key(stressKeys))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				for !cur.IsAtEnd() {
+					k := cur.Key()
+					val, err := cur.Next()
+					if err != nil || string(val) != k {
+						t.Errorf("expected value %s for key %s, got %s (%v)", k, k, val, err)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	cur, err := m.Scan(key(0), key(stressKeys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vals, err := cur.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vals) != stressKeys {
+		t.Fatalf("expected %d values, got %d", stressKeys, len(vals))
+	}
+}
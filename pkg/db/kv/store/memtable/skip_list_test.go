@@ -80,10 +80,10 @@ func assertListsEquivalent(t *testing.T, elems [][]int, list *memtable.Skiplist[
 		if node == nil {
 			t.Fatalf("expected Get to find key %d in list", elem[0])
 		}
-		if node.Val != elem[1] {
+		if node.Val() != elem[1] {
 			t.Fatalf(
 				"expected val %d for key %d on Get, but got %d",
-				elem[1], elem[0], node.Val,
+				elem[1], elem[0], node.Val(),
 			)
 		}
 	}
@@ -117,18 +117,18 @@ func assertPutGetDelete(t *testing.T, elems [][]int) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(elems) != int(list.Size) {
+	if len(elems) != int(list.Size()) {
 		t.Fatalf(
 			"expected list length to match elems %d but got length %d",
-			len(elems), list.Size,
+			len(elems), list.Size(),
 		)
 	}
 	assertListsEquivalent(t, elems, list)
 	assertDeleteFromList(t, elems, list)
-	if list.Size != 0 {
+	if list.Size() != 0 {
 		t.Fatalf(
 			"expected list to be empty after deleting elements, but got size %d",
-			list.Size,
+			list.Size(),
 		)
 	}
 }
@@ -258,11 +258,11 @@ func TestPutDifferentPositions(t *testing.T) {
 	expected := append(append(elems[0:1], elems[5:7]...), elems[8:]...)
 	assertListsEquivalent(t, expected, list)
 	// expect deduplication on count
-	if list.Size != 8 {
+	if list.Size() != 8 {
 		t.Fatalf(
 			"expected list size to be %d after Puts, got %d",
 			8,
-			list.Size,
+			list.Size(),
 		)
 	}
 }
@@ -310,15 +310,15 @@ func TestSkiplistGetPoints(t *testing.T) {
 		if node.Key != test.key {
 			t.Fatalf("Get return incorrect key %d for key %d", node.Key, test.key)
 		}
-		if node.Val != test.val {
-			t.Fatalf("Get return incorrect val %d, expected %d", node.Val, test.val)
+		if node.Val() != test.val {
+			t.Fatalf("Get return incorrect val %d, expected %d", node.Val(), test.val)
 		}
 	}
-	if list.Size != 5 {
+	if list.Size() != 5 {
 		t.Fatalf(
 			"expected list size to be %d after Gets, got %d",
 			5,
-			list.Size,
+			list.Size(),
 		)
 	}
 }
@@ -369,16 +369,16 @@ func TestSkiplistDelete(t *testing.T) {
 		if node.Key != test.key {
 			t.Fatalf("Get return incorrect key %d for key %d", node.Key, test.key)
 		}
-		if node.Val != test.val {
+		if node.Val() != test.val {
 			fmt.Println(node.Key, test.key)
-			t.Fatalf("Get return incorrect val %d, expected %d", node.Val, test.val)
+			t.Fatalf("Get return incorrect val %d, expected %d", node.Val(), test.val)
 		}
 	}
-	if list.Size != 3 {
+	if list.Size() != 3 {
 		t.Fatalf(
 			"expected list size to be %d after Deletes, got %d",
 			3,
-			list.Size,
+			list.Size(),
 		)
 	}
 }
@@ -1,9 +1,16 @@
 package store
 
 import (
+	"os"
+	"path/filepath"
+
 	"github.com/angles-n-daemons/popsql/pkg/db/kv"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/btree"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/buffer"
 	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/debug"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/lsm"
 	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/memtable"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/wal"
 )
 
 func NewDebugStore(store kv.Store) *debug.DebugStore {
@@ -13,3 +20,31 @@ func NewDebugStore(store kv.Store) *debug.DebugStore {
 func NewMemStore() *memtable.Memstore {
 	return memtable.NewStore()
 }
+
+// NewWALStore opens a durable store rooted at dir, restoring any
+// data previously written there.
+func NewWALStore(dir string) (*wal.WALStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return wal.NewStoreFromBackup(filepath.Join(dir, "wal.log"))
+}
+
+// NewLSMStore opens a log structured merge tree rooted at dir,
+// restoring any data previously written there. Blocks read from
+// disk are cached in the pool.
+func NewLSMStore(dir string, pool *buffer.Pool) (*lsm.LSMStore, error) {
+	opts := lsm.DefaultOptions()
+	opts.Pool = pool
+	return lsm.NewStore(dir, opts)
+}
+
+// NewBTreeStore opens a B+tree rooted at dir, restoring any data
+// previously written there. Pages read from disk are cached in the
+// pool.
+func NewBTreeStore(dir string, pool *buffer.Pool) (*btree.BTreeStore, error) {
+	opts := btree.DefaultOptions()
+	opts.Pool = pool
+	return btree.NewStore(dir, opts)
+}
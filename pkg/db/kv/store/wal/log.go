@@ -0,0 +1,138 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// headerSize is the size of the header in front of every record,
+// a 4 byte length followed by a 4 byte checksum of the payload.
+const headerSize = 8
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Log is an append only file of records. Each record is written
+// as a length prefixed, checksummed payload so that a torn write
+// at the tail of the file can be detected when it's replayed.
+//
+// The layout of a single record is:
+//
+//	+------------+--------------+-----------------+
+//	| len uint32 | crc32 uint32 | payload [len]   |
+//	+------------+--------------+-----------------+
+type Log struct {
+	f    *os.File
+	path string
+	size int64
+}
+
+// OpenLog opens the log at the given path, creating it if it
+// doesn't exist. New records are appended to the end of the file.
+func OpenLog(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Log{f: f, path: path, size: info.Size()}, nil
+}
+
+// Path returns the location of the log on disk.
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Size returns the number of bytes currently in the log.
+func (l *Log) Size() int64 {
+	return l.size
+}
+
+// Append writes a record to the end of the log, and syncs it to
+// disk before returning so that the record survives a crash.
+func (l *Log) Append(payload []byte) error {
+	record := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(payload, crcTable))
+	copy(record[headerSize:], payload)
+
+	n, err := l.f.WriteAt(record, l.size)
+	if err != nil {
+		// drop whatever part of the record made it into the file.
+		l.f.Truncate(l.size)
+		return err
+	}
+	if err = l.f.Sync(); err != nil {
+		return err
+	}
+	l.size += int64(n)
+	return nil
+}
+
+// Replay reads every record in the log from the beginning, calling
+// fn with each payload in the order they were written.
+//
+// If the tail of the log holds an incomplete or corrupted record,
+// which is what a crash in the middle of Append looks like, the
+// log is truncated at the last good record and replay ends there.
+func (l *Log) Replay(fn func([]byte) error) error {
+	var offset int64
+	header := make([]byte, headerSize)
+	for {
+		_, err := l.f.ReadAt(header, offset)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		length := binary.BigEndian.Uint32(header[0:4])
+		checksum := binary.BigEndian.Uint32(header[4:8])
+		if offset+headerSize+int64(length) > l.size {
+			break
+		}
+		payload := make([]byte, length)
+		_, err = l.f.ReadAt(payload, offset+headerSize)
+		if err != nil {
+			return err
+		}
+		if crc32.Checksum(payload, crcTable) != checksum {
+			break
+		}
+
+		if err = fn(payload); err != nil {
+			return fmt.Errorf("failed replaying record at offset %d: %w", offset, err)
+		}
+		offset += headerSize + int64(length)
+	}
+
+	if offset < l.size {
+		if err := l.f.Truncate(offset); err != nil {
+			return err
+		}
+		l.size = offset
+	}
+	return nil
+}
+
+// Truncate removes every record from the log.
+func (l *Log) Truncate() error {
+	if err := l.f.Truncate(0); err != nil {
+		return err
+	}
+	l.size = 0
+	return l.f.Sync()
+}
+
+// Close closes the underlying file.
+func (l *Log) Close() error {
+	return l.f.Close()
+}
@@ -1,34 +1,224 @@
 package wal
 
 import (
-	"io"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
 
 	"github.com/angles-n-daemons/popsql/pkg/db/kv"
 	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/memtable"
 )
 
-func NewStore() *WALStore {
-	return &WALStore{}
-}
+// Op identifies the kind of write stored in a log record.
+type Op byte
+
+const (
+	OpPut Op = iota + 1
+	// OpDelete records a deleted key, its value is always empty.
+	OpDelete
+)
 
-func NewStoreFromBackup() {
+// NewStore creates a WALStore with an empty log at the given path.
+// Any log which already exists at that path is discarded.
+func NewStore(path string) (*WALStore, error) {
+	log, err := OpenLog(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = log.Truncate(); err != nil {
+		log.Close()
+		return nil, err
+	}
+	return &WALStore{
+		log: log,
+		m:   memtable.NewStore(),
+	}, nil
+}
 
+// NewStoreFromBackup opens the log at the given path and replays
+// every write in it into a fresh memtable, restoring the state of
+// the store from before the process last exited. If there is no
+// log at the path, the store starts out empty.
+func NewStoreFromBackup(path string) (*WALStore, error) {
+	log, err := OpenLog(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &WALStore{
+		log: log,
+		m:   memtable.NewStore(),
+	}
+	err = log.Replay(w.apply)
+	if err != nil {
+		log.Close()
+		return nil, err
+	}
+	return w, nil
 }
 
+// WALStore is a Store which keeps its data in a memtable, but
+// appends every write to a log on disk before applying it. This
+// allows the memtable to be rebuilt after a restart.
 type WALStore struct {
-	f *io.ReadWriter
-	m *memtable.Memstore
+	mu  sync.RWMutex
+	log *Log
+	m   *memtable.Memstore
 }
 
 func (w *WALStore) Put(k string, v []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	record := EncodeEntry(OpPut, k, v)
+	if err := w.log.Append(record); err != nil {
+		return err
+	}
 	return w.m.Put(k, v)
 }
 
+func (w *WALStore) Delete(k string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	record := EncodeEntry(OpDelete, k, nil)
+	if err := w.log.Append(record); err != nil {
+		return err
+	}
+	return w.m.Delete(k)
+}
+
+// Write appends the whole batch to the log as a single record, so
+// that after a crash either all of it is replayed or none of it is.
+func (w *WALStore) Write(batch *kv.WriteBatch) error {
+	if batch.Len() == 0 {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.log.Append(EncodeBatch(batch)); err != nil {
+		return err
+	}
+	return w.m.Write(batch)
+}
+
 func (w *WALStore) Get(k string) ([]byte, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
 	return w.m.Get(k)
 }
 
 func (w *WALStore) Scan(start, end string) (kv.Cursor, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
 	return w.m.Scan(start, end)
+}
+
+// Close closes the underlying log file.
+func (w *WALStore) Close() error {
+	return w.log.Close()
+}
+
+// apply decodes a record read from the log and applies each of its
+// entries to the memtable.
+func (w *WALStore) apply(record []byte) error {
+	return DecodeBatch(record, func(o Op, k string, v []byte) error {
+		switch o {
+		case OpPut:
+			return w.m.Put(k, v)
+		case OpDelete:
+			return w.m.Delete(k)
+		default:
+			return fmt.Errorf("unknown log operation %d", o)
+		}
+	})
+}
+
+// EncodeEntry serializes a single write as:
+//
+//	op byte | uvarint key length | key | uvarint value length | value
+func EncodeEntry(o Op, k string, v []byte) []byte {
+	b := make([]byte, 0, 1+2*binary.MaxVarintLen64+len(k)+len(v))
+	return appendEntry(b, o, k, v)
+}
+
+// EncodeBatch serializes every write in a batch into one record,
+// with the entries back to back. A record holding a single entry is
+// the same as one written by EncodeEntry.
+func EncodeBatch(batch *kv.WriteBatch) []byte {
+	size := 0
+	for _, op := range batch.Ops {
+		size += 1 + 2*binary.MaxVarintLen64 + len(op.Key) + len(op.Value)
+	}
+	b := make([]byte, 0, size)
+	for _, op := range batch.Ops {
+		if op.Delete {
+			b = appendEntry(b, OpDelete, op.Key, nil)
+		} else {
+			b = appendEntry(b, OpPut, op.Key, op.Value)
+		}
+	}
+	return b
+}
+
+func appendEntry(b []byte, o Op, k string, v []byte) []byte {
+	b = append(b, byte(o))
+	b = binary.AppendUvarint(b, uint64(len(k)))
+	b = append(b, k...)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+var errMalformedEntry = errors.New("malformed log entry")
+
+// DecodeEntry is the inverse of EncodeEntry.
+func DecodeEntry(b []byte) (Op, string, []byte, error) {
+	o, k, v, _, err := decodeEntry(b)
+	return o, k, v, err
+}
+
+// DecodeBatch is the inverse of EncodeBatch, calling fn for each
+// entry in the record in order.
+func DecodeBatch(b []byte, fn func(o Op, k string, v []byte) error) error {
+	if len(b) == 0 {
+		return errMalformedEntry
+	}
+	for len(b) > 0 {
+		o, k, v, rest, err := decodeEntry(b)
+		if err != nil {
+			return err
+		}
+		if err = fn(o, k, v); err != nil {
+			return err
+		}
+		b = rest
+	}
+	return nil
+}
+
+func decodeEntry(b []byte) (Op, string, []byte, []byte, error) {
+	if len(b) < 1 {
+		return 0, "", nil, nil, errMalformedEntry
+	}
+	o := Op(b[0])
+	b = b[1:]
+
+	k, b, err := readBytes(b)
+	if err != nil {
+		return 0, "", nil, nil, err
+	}
+	v, b, err := readBytes(b)
+	if err != nil {
+		return 0, "", nil, nil, err
+	}
+	return o, string(k), v, b, nil
+}
 
+// readBytes reads a uvarint length prefixed byte slice, returning
+// it along with the remainder of the buffer.
+func readBytes(b []byte) ([]byte, []byte, error) {
+	l, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < l {
+		return nil, nil, errMalformedEntry
+	}
+	b = b[n:]
+	return b[:l:l], b[l:], nil
 }
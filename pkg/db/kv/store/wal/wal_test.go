@@ -0,0 +1,236 @@
+package wal_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/store/wal"
+	"github.com/angles-n-daemons/popsql/pkg/test/assert"
+)
+
+func TestWALStoreRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal.log")
+	st, err := wal.NewStore(path)
+	assert.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		err = st.Put(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("val%d", i)))
+		assert.NoError(t, err)
+	}
+	// overwrite a value so that replay order matters.
+	assert.NoError(t, st.Put("key3", []byte("new")))
+	assert.NoError(t, st.Close())
+
+	restored, err := wal.NewStoreFromBackup(path)
+	assert.NoError(t, err)
+	defer restored.Close()
+
+	for i := 0; i < 10; i++ {
+		expected := fmt.Sprintf("val%d", i)
+		if i == 3 {
+			expected = "new"
+		}
+		val, err := restored.Get(fmt.Sprintf("key%d", i))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(val))
+	}
+
+	cur, err := restored.Scan("key0", "key3")
+	assert.NoError(t, err)
+	vals, err := cur.ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(vals))
+}
+
+func TestWALStoreRestoreDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal.log")
+	st, err := wal.NewStore(path)
+	assert.NoError(t, err)
+	assert.NoError(t, st.Put("key1", []byte("val1")))
+	assert.NoError(t, st.Put("key2", []byte("val2")))
+	assert.NoError(t, st.Delete("key1"))
+	assert.NoError(t, st.Close())
+
+	restored, err := wal.NewStoreFromBackup(path)
+	assert.NoError(t, err)
+	defer restored.Close()
+
+	val, err := restored.Get("key1")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+	val, err = restored.Get("key2")
+	assert.NoError(t, err)
+	assert.Equal(t, "val2", string(val))
+}
+
+func TestWALStoreNewStoreDiscardsLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal.log")
+	st, err := wal.NewStore(path)
+	assert.NoError(t, err)
+	assert.NoError(t, st.Put("key", []byte("val")))
+	assert.NoError(t, st.Close())
+
+	st, err = wal.NewStore(path)
+	assert.NoError(t, err)
+	defer st.Close()
+	val, err := st.Get("key")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+}
+
+func TestWALStoreTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal.log")
+	st, err := wal.NewStore(path)
+	assert.NoError(t, err)
+	assert.NoError(t, st.Put("a", []byte("1")))
+	assert.NoError(t, st.Put("b", []byte("2")))
+	assert.NoError(t, st.Close())
+
+	// chop the last few bytes off the log, simulating a crash
+	// in the middle of the second write.
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Truncate(path, info.Size()-2))
+
+	restored, err := wal.NewStoreFromBackup(path)
+	assert.NoError(t, err)
+	val, err := restored.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", string(val))
+	val, err = restored.Get("b")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+
+	// writes after recovery should land after the last good record.
+	assert.NoError(t, restored.Put("c", []byte("3")))
+	assert.NoError(t, restored.Close())
+
+	restored, err = wal.NewStoreFromBackup(path)
+	assert.NoError(t, err)
+	defer restored.Close()
+	val, err = restored.Get("c")
+	assert.NoError(t, err)
+	assert.Equal(t, "3", string(val))
+}
+
+func TestWALStoreWriteBatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal.log")
+	st, err := wal.NewStore(path)
+	assert.NoError(t, err)
+	assert.NoError(t, st.Put("a", []byte("1")))
+
+	batch := kv.NewWriteBatch()
+	assert.NoError(t, batch.Put("b", []byte("2")))
+	assert.NoError(t, batch.Delete("a"))
+	assert.NoError(t, batch.Put("c", []byte("3")))
+	assert.NoError(t, batch.Put("c", []byte("4")))
+	assert.NoError(t, st.Write(batch))
+
+	check := func(st *wal.WALStore) {
+		val, err := st.Get("a")
+		assert.NoError(t, err)
+		assert.Nil(t, val)
+		val, err = st.Get("b")
+		assert.NoError(t, err)
+		assert.Equal(t, "2", string(val))
+		val, err = st.Get("c")
+		assert.NoError(t, err)
+		assert.Equal(t, "4", string(val))
+	}
+	check(st)
+	assert.NoError(t, st.Close())
+
+	restored, err := wal.NewStoreFromBackup(path)
+	assert.NoError(t, err)
+	defer restored.Close()
+	check(restored)
+}
+
+func TestWALStoreTornBatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal.log")
+	st, err := wal.NewStore(path)
+	assert.NoError(t, err)
+	assert.NoError(t, st.Put("a", []byte("1")))
+	batch := kv.NewWriteBatch()
+	assert.NoError(t, batch.Put("b", []byte("2")))
+	assert.NoError(t, batch.Put("c", []byte("3")))
+	assert.NoError(t, st.Write(batch))
+	assert.NoError(t, st.Close())
+
+	// chop off the end of the batch. The write to "b" is intact on
+	// disk, but the record is incomplete, so none of it is replayed.
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Truncate(path, info.Size()-2))
+
+	restored, err := wal.NewStoreFromBackup(path)
+	assert.NoError(t, err)
+	defer restored.Close()
+	val, err := restored.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", string(val))
+	for _, k := range []string{"b", "c"} {
+		val, err = restored.Get(k)
+		assert.NoError(t, err)
+		assert.Nil(t, val)
+	}
+}
+
+func TestDecodeBatch(t *testing.T) {
+	batch := kv.NewWriteBatch()
+	assert.NoError(t, batch.Put("a", []byte("1")))
+	assert.NoError(t, batch.Delete("b"))
+	record := wal.EncodeBatch(batch)
+
+	decoded := kv.NewWriteBatch()
+	err := wal.DecodeBatch(record, func(o wal.Op, k string, v []byte) error {
+		if o == wal.OpDelete {
+			return decoded.Delete(k)
+		}
+		return decoded.Put(k, v)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, batch.Ops, decoded.Ops)
+
+	// a record written by EncodeEntry is a batch of one.
+	err = wal.DecodeBatch(wal.EncodeEntry(wal.OpPut, "a", []byte("1")), func(o wal.Op, k string, v []byte) error {
+		assert.Equal(t, wal.OpPut, o)
+		assert.Equal(t, "a", k)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// a record cut short is malformed.
+	err = wal.DecodeBatch(record[:len(record)-1], func(wal.Op, string, []byte) error { return nil })
+	assert.IsError(t, err, "malformed log entry")
+}
+
+func TestLogCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal.log")
+	log, err := wal.OpenLog(path)
+	assert.NoError(t, err)
+	assert.NoError(t, log.Append([]byte("first")))
+	assert.NoError(t, log.Append([]byte("second")))
+	assert.NoError(t, log.Close())
+
+	// flip a byte in the payload of the second record.
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	b[len(b)-1] ^= 0xff
+	assert.NoError(t, os.WriteFile(path, b, 0644))
+
+	log, err = wal.OpenLog(path)
+	assert.NoError(t, err)
+	defer log.Close()
+	records := []string{}
+	err = log.Replay(func(p []byte) error {
+		records = append(records, string(p))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first"}, records)
+	assert.Equal(t, int64(8+len("first")), log.Size())
+}
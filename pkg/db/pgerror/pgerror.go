@@ -0,0 +1,48 @@
+// Package pgerror attaches postgres error codes to errors, so that
+// clients can tell what kind of error a statement failed with.
+package pgerror
+
+import "errors"
+
+// Code is a postgres SQLSTATE error code.
+type Code string
+
+const (
+	InvalidTextRepr      Code = "22P02"
+	NotNullViolation     Code = "23502"
+	UniqueViolation      Code = "23505"
+	CheckViolation       Code = "23514"
+	SerializationFailure Code = "40001"
+	DeadlockDetected     Code = "40P01"
+	UndefinedColumn      Code = "42703"
+	DatatypeMismatch     Code = "42804"
+	InternalError        Code = "XX000"
+)
+
+// Error is an error with a postgres error code.
+type Error struct {
+	Code Code
+	Err  error
+}
+
+func New(code Code, err error) error {
+	return &Error{Code: code, Err: err}
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// CodeOf returns the code of the first Error in err's chain, or
+// InternalError if there isn't one.
+func CodeOf(err error) Code {
+	var pgerr *Error
+	if errors.As(err, &pgerr) {
+		return pgerr.Code
+	}
+	return InternalError
+}
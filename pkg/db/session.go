@@ -0,0 +1,258 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/lock"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/mvcc"
+	"github.com/angles-n-daemons/popsql/pkg/db/pgerror"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/execution"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/parser"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/parser/ast"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/parser/scanner"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/plan"
+)
+
+// TxnStatus describes where a session is in a transaction, using
+// the same indicators as the pgwire ReadyForQuery message.
+type TxnStatus byte
+
+const (
+	// TxnIdle is the status outside of a transaction block.
+	TxnIdle TxnStatus = 'I'
+	// TxnInBlock is the status inside a transaction block.
+	TxnInBlock TxnStatus = 'T'
+	// TxnFailed is the status inside a transaction block once one
+	// of its statements has failed. Every statement is rejected
+	// until the block is ended.
+	TxnFailed TxnStatus = 'E'
+)
+
+var errTxnAborted = errors.New("current transaction is aborted, commands ignored until end of transaction block")
+
+/*
+Session is a connection's view of the engine. Outside of a
+transaction block each statement runs in a transaction of its own,
+which is committed once it succeeds. BEGIN starts a block, whose
+statements share one transaction, and whose writes are only applied
+once COMMIT is run. ROLLBACK discards them.
+
+Transactions are serializable. If a transaction conflicts with one
+which committed while it ran, it fails to commit with a
+serialization failure, and has to be retried. SELECT ... FOR UPDATE
+locks the rows it returns until the transaction ends, so transactions
+contending for them wait their turn instead.
+
+Every statement locks the schema until its transaction ends, sharing
+the lock unless it changes the schema, in which case it takes it
+exclusively. So only one transaction changes the schema at a time,
+and not while others are using it. Its changes are made to its own
+copy of the catalog, which replaces the shared one once it commits,
+so other sessions never see them uncommitted.
+
+A session must only be used by one goroutine at a time, and should
+be closed once it's done with.
+*/
+type Session struct {
+	engine *Engine
+	// txn is the transaction of the open block, or nil outside one.
+	txn    *mvcc.Txn
+	failed bool
+	// locked is set once the current transaction has locked the
+	// schema, in mode.
+	locked bool
+	mode   lock.Mode
+	// catalog is the copy of the engine's catalog which the current
+	// transaction has changed the schema in, or nil if it hasn't.
+	catalog *catalog.Manager
+}
+
+func (e *Engine) NewSession() *Session {
+	return &Session{engine: e}
+}
+
+// Status reports whether the session is in a transaction block, and
+// if so whether it has failed.
+func (s *Session) Status() TxnStatus {
+	switch {
+	case s.txn == nil:
+		return TxnIdle
+	case s.failed:
+		return TxnFailed
+	default:
+		return TxnInBlock
+	}
+}
+
+func (s *Session) Query(query string, parameters []any) (*execution.Result, error) {
+	stmt, err := parser.Parse(query)
+	if err != nil {
+		s.fail()
+		return nil, err
+	}
+	if t, ok := stmt.(*ast.Transaction); ok {
+		return s.transaction(t)
+	}
+	if s.failed {
+		return nil, errTxnAborted
+	}
+
+	if s.txn != nil {
+		result, err := s.run(s.txn, stmt)
+		if err != nil {
+			s.fail()
+			return nil, pgError(err)
+		}
+		return result, nil
+	}
+
+	// outside a block, the statement runs in its own transaction.
+	txn := s.engine.Store.Begin()
+	defer s.end()
+	result, err := s.run(txn, stmt)
+	if err == nil {
+		_, err = txn.Commit()
+	}
+	if err != nil {
+		txn.Rollback()
+		return nil, pgError(err)
+	}
+	return result, nil
+}
+
+func (s *Session) run(txn *mvcc.Txn, stmt ast.Stmt) (*execution.Result, error) {
+	cat, err := s.lockCatalog(txn, stmt)
+	if err != nil {
+		return nil, err
+	}
+	p, err := plan.PlanQuery(cat.Schema, stmt)
+	if err != nil {
+		return nil, err
+	}
+	return execution.Run(txn, cat, p)
+}
+
+// lockCatalog locks the schema for the statement, and returns the
+// catalog it runs against. That's the transaction's copy, if it has
+// changed the schema, and otherwise the engine's, unless the
+// statement is about to change it, in which case a copy is made to
+// be published once the transaction commits.
+//
+// Once the schema is locked, the transaction is refreshed, so that it
+// reads the tables as they were left by whoever last changed them.
+func (s *Session) lockCatalog(txn *mvcc.Txn, stmt ast.Stmt) (*catalog.Manager, error) {
+	mode := lock.Shared
+	if changesSchema(stmt) {
+		mode = lock.Exclusive
+	}
+	if !s.locked || mode > s.mode {
+		if err := txn.Lock(catalog.LockKey(), mode); err != nil {
+			return nil, err
+		}
+		if err := txn.Refresh(); err != nil {
+			return nil, err
+		}
+		s.locked, s.mode = true, mode
+	}
+	if s.catalog != nil {
+		return s.catalog, nil
+	}
+	cat := s.engine.Catalog
+	if mode == lock.Shared {
+		return cat, nil
+	}
+	changed := catalog.Copy(cat)
+	txn.OnCommit(func() { catalog.Publish(cat, changed) })
+	s.catalog = changed
+	return changed, nil
+}
+
+// changesSchema returns whether the statement changes the schema,
+// which every statement but SELECT and INSERT does.
+func changesSchema(stmt ast.Stmt) bool {
+	switch stmt.(type) {
+	case *ast.Select, *ast.Insert:
+		return false
+	}
+	return true
+}
+
+// Close rolls back the session's open block, if it has one, so that
+// its locks and snapshot are released. It's called once the session's
+// connection ends, whether or not the client ended the block first.
+func (s *Session) Close() error {
+	if s.txn == nil {
+		return nil
+	}
+	s.txn.Rollback()
+	s.end()
+	return nil
+}
+
+// transaction runs BEGIN, COMMIT and ROLLBACK. Like postgres, it's
+// not an error to BEGIN inside a block, or to end a block when
+// there isn't one.
+func (s *Session) transaction(stmt *ast.Transaction) (*execution.Result, error) {
+	result := &execution.Result{Command: stmt.Command.Lexeme}
+	switch stmt.Command.Type {
+	case scanner.BEGIN:
+		if s.failed {
+			return nil, errTxnAborted
+		}
+		if s.txn == nil {
+			s.txn = s.engine.Store.Begin()
+		}
+	case scanner.COMMIT:
+		if s.txn == nil {
+			break
+		}
+		txn, failed := s.txn, s.failed
+		s.end()
+		if failed {
+			// a failed block can only be rolled back.
+			result.Command = "ROLLBACK"
+			txn.Rollback()
+			break
+		}
+		if _, err := txn.Commit(); err != nil {
+			return nil, pgError(err)
+		}
+	case scanner.ROLLBACK:
+		if s.txn == nil {
+			break
+		}
+		s.txn.Rollback()
+		s.end()
+	default:
+		return nil, fmt.Errorf("unknown transaction command %s", stmt.Command.Lexeme)
+	}
+	return result, nil
+}
+
+// pgError gives errors which tell the client its transaction can be
+// retried their postgres error code.
+func pgError(err error) error {
+	switch {
+	case errors.Is(err, mvcc.ErrConflict):
+		return pgerror.New(pgerror.SerializationFailure, err)
+	case errors.Is(err, lock.ErrDeadlock):
+		return pgerror.New(pgerror.DeadlockDetected, err)
+	}
+	return err
+}
+
+// fail marks the open block as failed, if there is one.
+func (s *Session) fail() {
+	if s.txn != nil {
+		s.failed = true
+	}
+}
+
+// end clears the session's transaction state once its transaction
+// has ended.
+func (s *Session) end() {
+	s.txn, s.failed, s.catalog = nil, false, nil
+	s.locked, s.mode = false, lock.Shared
+}
@@ -0,0 +1,878 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/pgerror"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/desc"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/schema"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/execution"
+	"github.com/angles-n-daemons/popsql/pkg/test/assert"
+)
+
+func query(t *testing.T, s *Session, q string) *execution.Result {
+	t.Helper()
+	result, err := s.Query(q, nil)
+	assert.NoError(t, err)
+	return result
+}
+
+func count(t *testing.T, s *Session, table string) int {
+	t.Helper()
+	return len(query(t, s, "SELECT * FROM "+table).Rows)
+}
+
+func TestSessionAutocommit(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+	query(t, s, "INSERT INTO t (a) VALUES (1), (2)")
+	assert.Equal(t, TxnIdle, s.Status())
+	assert.Equal(t, 2, count(t, e.NewSession(), "t"))
+}
+
+func TestSessionCommit(t *testing.T) {
+	e := newEngine(&Config{})
+	s, other := e.NewSession(), e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+
+	result := query(t, s, "BEGIN")
+	assert.Equal(t, "BEGIN", result.Command)
+	assert.Equal(t, TxnInBlock, s.Status())
+	query(t, s, "INSERT INTO t (a) VALUES (1)")
+	query(t, s, "INSERT INTO t (a) VALUES (2)")
+
+	// the block sees its own writes, but no one else does.
+	assert.Equal(t, 2, count(t, s, "t"))
+	assert.Equal(t, 0, count(t, other, "t"))
+
+	result = query(t, s, "COMMIT")
+	assert.Equal(t, "COMMIT", result.Command)
+	assert.Equal(t, TxnIdle, s.Status())
+	assert.Equal(t, 2, count(t, other, "t"))
+}
+
+func TestSessionRollback(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+
+	query(t, s, "BEGIN")
+	query(t, s, "INSERT INTO t (a) VALUES (1)")
+	query(t, s, "CREATE TABLE u (b NUMBER)")
+	query(t, s, "ROLLBACK")
+	assert.Equal(t, TxnIdle, s.Status())
+
+	assert.Equal(t, 0, count(t, s, "t"))
+	_, err := s.Query("SELECT * FROM u", nil)
+	assert.IsError(t, err, "Could not find table with name u")
+
+	// ending a block when there isn't one does nothing.
+	query(t, s, "COMMIT")
+	query(t, s, "ROLLBACK")
+	assert.Equal(t, TxnIdle, s.Status())
+}
+
+func TestSessionFailedBlock(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+
+	query(t, s, "BEGIN")
+	query(t, s, "INSERT INTO t (a) VALUES (1)")
+	_, err := s.Query("INSERT INTO missing (a) VALUES (1)", nil)
+	assert.IsError(t, err, "Could not find table with name missing")
+	assert.Equal(t, TxnFailed, s.Status())
+
+	// every statement is rejected until the block ends.
+	_, err = s.Query("SELECT * FROM t", nil)
+	assert.IsError(t, err, "current transaction is aborted, commands ignored until end of transaction block")
+	assert.Equal(t, TxnFailed, s.Status())
+
+	// and committing it rolls it back.
+	result := query(t, s, "COMMIT")
+	assert.Equal(t, "ROLLBACK", result.Command)
+	assert.Equal(t, TxnIdle, s.Status())
+	assert.Equal(t, 0, count(t, s, "t"))
+}
+
+func TestSessionFailedStatementOutsideBlock(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+	_, err := s.Query("INSERT INTO t (b) VALUES (1)", nil)
+	assert.IsError(t, err, "Could not find column in table t with name b")
+	assert.Equal(t, TxnIdle, s.Status())
+	query(t, s, "INSERT INTO t (a) VALUES (1)")
+	assert.Equal(t, 1, count(t, s, "t"))
+}
+
+func TestSessionSerializationFailure(t *testing.T) {
+	e := newEngine(&Config{})
+	s, other := e.NewSession(), e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+
+	// both blocks read the table, then add to it.
+	query(t, s, "BEGIN")
+	query(t, other, "BEGIN")
+	assert.Equal(t, 0, count(t, s, "t"))
+	assert.Equal(t, 0, count(t, other, "t"))
+	query(t, s, "INSERT INTO t (a) VALUES (1)")
+	query(t, other, "INSERT INTO t (a) VALUES (2)")
+
+	query(t, s, "COMMIT")
+	_, err := other.Query("COMMIT", nil)
+	assert.IsError(t, err, "could not serialize access due to a concurrent update")
+	assert.Equal(t, pgerror.SerializationFailure, pgerror.CodeOf(err))
+	assert.Equal(t, TxnIdle, other.Status())
+	assert.Equal(t, 1, count(t, other, "t"))
+}
+
+func TestSessionConcurrentInserts(t *testing.T) {
+	e := newEngine(&Config{})
+	s, other := e.NewSession(), e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+
+	// blocks which only insert don't conflict, since the table's
+	// sequence hands each of them different keys.
+	query(t, s, "BEGIN")
+	query(t, other, "BEGIN")
+	query(t, s, "INSERT INTO t (a) VALUES (1)")
+	query(t, other, "INSERT INTO t (a) VALUES (2)")
+	query(t, s, "COMMIT")
+	query(t, other, "COMMIT")
+	assert.Equal(t, 2, count(t, s, "t"))
+
+	// a rolled back insert leaves a gap in the sequence.
+	query(t, s, "BEGIN")
+	query(t, s, "INSERT INTO t (a) VALUES (3)")
+	query(t, s, "ROLLBACK")
+	result := query(t, s, "INSERT INTO t (a) VALUES (4)")
+	assert.True(t, strings.HasSuffix(result.Rows[0][0].(string), "/4"))
+}
+
+func TestSessionSelectForUpdate(t *testing.T) {
+	e := newEngine(&Config{})
+	s, other := e.NewSession(), e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+	query(t, s, "INSERT INTO t (a) VALUES (1)")
+
+	query(t, s, "BEGIN")
+	query(t, other, "BEGIN")
+	assert.Equal(t, 1, count(t, s, "t"))
+	query(t, s, "SELECT * FROM t FOR UPDATE")
+
+	// the other block queues for the locked row.
+	done := make(chan *execution.Result, 1)
+	go func() {
+		done <- query(t, other, "SELECT * FROM t FOR UPDATE")
+	}()
+	query(t, s, "INSERT INTO t (a) VALUES (2)")
+	select {
+	case <-done:
+		t.Fatal("expected the row to be locked")
+	case <-time.After(20 * time.Millisecond):
+	}
+	query(t, s, "COMMIT")
+
+	// once it has the lock, it reads what the first block committed,
+	// and so can commit on top of it rather than conflicting.
+	result := <-done
+	assert.Equal(t, 2, len(result.Rows))
+	query(t, other, "INSERT INTO t (a) VALUES (3)")
+	query(t, other, "COMMIT")
+	assert.Equal(t, 3, count(t, s, "t"))
+}
+
+func TestSessionSelectForUpdateWhere(t *testing.T) {
+	e := newEngine(&Config{})
+	s, other := e.NewSession(), e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+	query(t, s, "INSERT INTO t (a) VALUES (1), (2)")
+
+	// only the rows which pass the filter are locked.
+	query(t, s, "BEGIN")
+	result := query(t, s, "SELECT * FROM t WHERE a == 1 FOR UPDATE")
+	assert.Equal(t, 1, len(result.Rows))
+	result = query(t, other, "SELECT * FROM t WHERE a == 2 FOR UPDATE")
+	assert.Equal(t, []execution.Row{{float64(2)}}, result.Rows)
+
+	done := make(chan *execution.Result, 1)
+	go func() {
+		done <- query(t, other, "SELECT * FROM t WHERE a < 3 FOR UPDATE")
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected the row to be locked")
+	case <-time.After(20 * time.Millisecond):
+	}
+	query(t, s, "INSERT INTO t (a) VALUES (0)")
+	query(t, s, "COMMIT")
+	// the rows are read again once they're locked, so the row
+	// committed meanwhile is seen too.
+	assert.Equal(t, 3, len((<-done).Rows))
+}
+
+func TestSessionCloseReleasesLocks(t *testing.T) {
+	e := newEngine(&Config{})
+	s, other := e.NewSession(), e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+	query(t, s, "INSERT INTO t (a) VALUES (1)")
+
+	query(t, s, "BEGIN")
+	query(t, s, "SELECT * FROM t FOR UPDATE")
+	query(t, s, "INSERT INTO t (a) VALUES (2)")
+	done := make(chan *execution.Result, 1)
+	go func() {
+		done <- query(t, other, "SELECT * FROM t FOR UPDATE")
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected the row to be locked")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// closing the session rolls back its block, as if its client had
+	// gone away, which lets the other session take the lock.
+	assert.NoError(t, s.Close())
+	assert.Equal(t, TxnIdle, s.Status())
+	result := <-done
+	assert.Equal(t, 1, len(result.Rows))
+	assert.NoError(t, s.Close())
+}
+
+func TestSessionDeadlock(t *testing.T) {
+	e := newEngine(&Config{})
+	s, other := e.NewSession(), e.NewSession()
+	query(t, s, "CREATE TABLE a (n NUMBER)")
+	query(t, s, "CREATE TABLE b (n NUMBER)")
+	query(t, s, "INSERT INTO a (n) VALUES (1)")
+	query(t, s, "INSERT INTO b (n) VALUES (1)")
+
+	query(t, s, "BEGIN")
+	query(t, other, "BEGIN")
+	query(t, s, "SELECT * FROM a FOR UPDATE")
+	query(t, other, "SELECT * FROM b FOR UPDATE")
+	done := make(chan *execution.Result, 1)
+	go func() {
+		done <- query(t, s, "SELECT * FROM b FOR UPDATE")
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// the block which began last is chosen to break the deadlock.
+	_, err := other.Query("SELECT * FROM a FOR UPDATE", nil)
+	assert.IsError(t, err, "deadlock detected")
+	assert.Equal(t, pgerror.DeadlockDetected, pgerror.CodeOf(err))
+	assert.Equal(t, TxnFailed, other.Status())
+	query(t, other, "ROLLBACK")
+	<-done
+	query(t, s, "COMMIT")
+}
+
+func TestSessionRowsInKeyOrder(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+	for i := 1; i <= 12; i++ {
+		query(t, s, fmt.Sprintf("INSERT INTO t (a) VALUES (%d)", i))
+	}
+
+	// row 10 sorts after row 9, not between 1 and 2.
+	result := query(t, s, "SELECT * FROM t")
+	assert.Equal(t, 12, len(result.Rows))
+	for i, row := range result.Rows {
+		assert.Equal[any](t, float64(i+1), row[0])
+	}
+}
+
+func TestSessionReadsJSONRows(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER, b STRING)")
+	query(t, s, `INSERT INTO t (a, b) VALUES (2, "binary")`)
+
+	// rows written before the binary format are stored as JSON.
+	table := schema.GetByName[*desc.Table](e.Catalog.Schema, "t")
+	key, err := table.Prefix().WithValues(100)
+	assert.NoError(t, err)
+	assert.NoError(t, e.Store.Put(key.Encode(), []byte(`{"a":1,"b":"json","__key":100}`)))
+
+	result := query(t, s, "SELECT * FROM t")
+	assert.Equal(t, []execution.Row{{2.0, "binary"}, {1.0, "json"}}, result.Rows)
+}
+
+func TestSessionAlterTable(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+	query(t, s, "INSERT INTO t (a) VALUES (1)")
+
+	// rows written before the column was added read its default.
+	query(t, s, `ALTER TABLE t ADD COLUMN b STRING DEFAULT "x"`)
+	query(t, s, "INSERT INTO t (a) VALUES (2)")
+	query(t, s, `INSERT INTO t (a, b) VALUES (3, "y")`)
+	result := query(t, s, "SELECT * FROM t")
+	assert.Equal(t, []string{"a", "b"}, result.Columns)
+	assert.Equal(t, []execution.Row{{1.0, "x"}, {2.0, "x"}, {3.0, "y"}}, result.Rows)
+
+	query(t, s, "ALTER TABLE t RENAME COLUMN b TO c")
+	result = query(t, s, "SELECT * FROM t")
+	assert.Equal(t, []string{"a", "c"}, result.Columns)
+	assert.Equal(t, []execution.Row{{1.0, "x"}, {2.0, "x"}, {3.0, "y"}}, result.Rows)
+
+	// a column added with the name of a dropped one doesn't see its
+	// values.
+	query(t, s, "ALTER TABLE t DROP COLUMN a")
+	query(t, s, "ALTER TABLE t ADD a NUMBER")
+	result = query(t, s, "SELECT * FROM t")
+	assert.Equal(t, []string{"c", "a"}, result.Columns)
+	assert.Equal(t, []execution.Row{{"x", nil}, {"x", nil}, {"y", nil}}, result.Rows)
+
+	_, err := s.Query("ALTER TABLE t ADD COLUMN c NUMBER", nil)
+	assert.IsError(t, err, "column 'c' already exists in table 't'")
+	_, err = s.Query("ALTER TABLE t DROP COLUMN b", nil)
+	assert.IsError(t, err, "column 'b' does not exist in table 't'")
+	_, err = s.Query("ALTER TABLE t RENAME COLUMN c TO a", nil)
+	assert.IsError(t, err, "column 'a' already exists in table 't'")
+}
+
+func TestSessionDefaultTypes(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+
+	// defaults are checked against their columns' types like inserted
+	// values, when the table is created or altered.
+	_, err := s.Query(`CREATE TABLE x (k NUMBER, a NUMBER DEFAULT "abc")`, nil)
+	assert.IsError(t, err, `invalid input for column 'a' of type NUMBER: "abc"`)
+	assert.Equal(t, pgerror.InvalidTextRepr, pgerror.CodeOf(err))
+	_, err = s.Query("CREATE TABLE x (k NUMBER, b BOOLEAN DEFAULT 5)", nil)
+	assert.IsError(t, err, "column 'b' is of type BOOLEAN but expression is of type NUMBER")
+	assert.Equal(t, pgerror.DatatypeMismatch, pgerror.CodeOf(err))
+
+	query(t, s, `CREATE TABLE t (k NUMBER, a NUMBER DEFAULT "1")`)
+	query(t, s, "INSERT INTO t (k) VALUES (1)")
+	_, err = s.Query("ALTER TABLE t ADD COLUMN b BOOLEAN DEFAULT 1 + 1", nil)
+	assert.Equal(t, pgerror.DatatypeMismatch, pgerror.CodeOf(err))
+	query(t, s, "ALTER TABLE t ADD COLUMN s STRING DEFAULT 7")
+	result := query(t, s, "SELECT a + 1, s FROM t")
+	assert.Equal(t, []execution.Row{{2.0, "7"}}, result.Rows)
+}
+
+func TestSessionRenameTable(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+	query(t, s, "INSERT INTO t (a) VALUES (1)")
+	query(t, s, "ALTER TABLE t RENAME TO u")
+
+	_, err := s.Query("SELECT * FROM t", nil)
+	assert.IsError(t, err, "Could not find table with name t")
+	query(t, s, "INSERT INTO u (a) VALUES (2)")
+	assert.Equal(t, 2, count(t, s, "u"))
+
+	// the old name is free to be used again.
+	query(t, s, "CREATE TABLE t (b NUMBER)")
+	query(t, s, "INSERT INTO t (b) VALUES (1)")
+	assert.Equal(t, 1, count(t, s, "t"))
+	assert.Equal(t, 2, count(t, s, "u"))
+
+	_, err = s.Query("ALTER TABLE u RENAME TO t", nil)
+	assert.IsError(t, err, "table 't' already exists")
+}
+
+func TestSessionAlterTableRollback(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+
+	query(t, s, "BEGIN")
+	query(t, s, "ALTER TABLE t ADD COLUMN b NUMBER DEFAULT 5")
+	query(t, s, "ALTER TABLE t RENAME TO u")
+	query(t, s, "ROLLBACK")
+
+	result := query(t, s, "SELECT * FROM t")
+	assert.Equal(t, []string{"a"}, result.Columns)
+	_, err := s.Query("SELECT * FROM u", nil)
+	assert.IsError(t, err, "Could not find table with name u")
+}
+
+func TestSessionDropTable(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+	query(t, s, "INSERT INTO t (a) VALUES (1), (2)")
+	span := schema.GetByName[*desc.Table](e.Catalog.Schema, "t").Span()
+
+	result := query(t, s, "DROP TABLE t")
+	assert.Equal(t, []execution.Row{{"t"}}, result.Rows)
+	_, err := s.Query("SELECT * FROM t", nil)
+	assert.IsError(t, err, "Could not find table with name t")
+	assert.Nil(t, schema.GetByName[*desc.Sequence](e.Catalog.Schema, "t_seq"))
+
+	// the rows are gone from the store too.
+	cur, err := e.Store.Scan(span.Start.Encode(), span.End.Encode())
+	assert.NoError(t, err)
+	assert.True(t, cur.IsAtEnd())
+
+	_, err = s.Query("DROP TABLE t", nil)
+	assert.IsError(t, err, "Could not find table with name t")
+	result = query(t, s, "DROP TABLE IF EXISTS t")
+	assert.Equal(t, 0, len(result.Rows))
+
+	// the table can be created again, starting from scratch.
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+	assert.Equal(t, 0, count(t, s, "t"))
+
+	_, err = s.Query("DROP TABLE __tables__", nil)
+	assert.IsError(t, err, "cannot change system table __tables__")
+}
+
+func TestSessionDropTableRollback(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+	query(t, s, "INSERT INTO t (a) VALUES (1), (2)")
+
+	query(t, s, "BEGIN")
+	query(t, s, "DROP TABLE t")
+	query(t, s, "ROLLBACK")
+	assert.Equal(t, 2, count(t, s, "t"))
+	query(t, s, "INSERT INTO t (a) VALUES (3)")
+	assert.Equal(t, 3, count(t, s, "t"))
+}
+
+func TestSessionSchemaChangeIsolation(t *testing.T) {
+	e := newEngine(&Config{})
+	s, other := e.NewSession(), e.NewSession()
+
+	// a block which changes the schema keeps others from using it
+	// until the change is committed.
+	query(t, s, "BEGIN")
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+	query(t, s, "INSERT INTO t (a) VALUES (1)")
+	done := make(chan *execution.Result, 1)
+	go func() {
+		done <- query(t, other, "SELECT * FROM t")
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected the schema to be locked")
+	case <-time.After(20 * time.Millisecond):
+	}
+	query(t, s, "COMMIT")
+	assert.Equal(t, 1, len((<-done).Rows))
+
+	// and a change waits for the blocks using the schema to end.
+	query(t, other, "BEGIN")
+	assert.Equal(t, 1, count(t, other, "t"))
+	changed := make(chan *execution.Result, 1)
+	go func() {
+		changed <- query(t, s, "ALTER TABLE t ADD COLUMN b NUMBER")
+	}()
+	select {
+	case <-changed:
+		t.Fatal("expected the schema change to wait")
+	case <-time.After(20 * time.Millisecond):
+	}
+	// the block still sees the schema it began with.
+	assert.Equal(t, []string{"a"}, query(t, other, "SELECT * FROM t").Columns)
+	query(t, other, "ROLLBACK")
+	<-changed
+	assert.Equal(t, []string{"a", "b"}, query(t, other, "SELECT * FROM t").Columns)
+}
+
+func TestSessionConcurrentSchemaChanges(t *testing.T) {
+	e := newEngine(&Config{})
+	setup := e.NewSession()
+	query(t, setup, "CREATE TABLE t (a NUMBER)")
+
+	// sessions creating tables while others read, which the race
+	// detector checks never touch the schema at the same time.
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			s := e.NewSession()
+			for j := 0; j < 10; j++ {
+				if i%2 == 0 {
+					query(t, s, fmt.Sprintf("CREATE TABLE t%d_%d (a NUMBER)", i, j))
+				} else {
+					query(t, s, "INSERT INTO t (a) VALUES (1)")
+					count(t, s, "t")
+				}
+			}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+	assert.Equal(t, 20, count(t, setup, "t"))
+	assert.Equal(t, 23, e.Catalog.Schema.Tables.Size())
+}
+
+func TestSessionTruncate(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER)")
+	query(t, s, "INSERT INTO t (a) VALUES (1), (2)")
+
+	query(t, s, "TRUNCATE t")
+	assert.Equal(t, 0, count(t, s, "t"))
+
+	// the key sequence starts again.
+	result := query(t, s, "INSERT INTO t (a) VALUES (3)")
+	assert.True(t, strings.HasSuffix(result.Rows[0][0].(string), "/1"))
+	assert.Equal(t, 1, count(t, s, "t"))
+
+	// rolling back undoes the reset, and the keys handed out after it.
+	query(t, s, "BEGIN")
+	query(t, s, "TRUNCATE t")
+	query(t, s, "ROLLBACK")
+	result = query(t, s, "INSERT INTO t (a) VALUES (4)")
+	assert.True(t, strings.HasSuffix(result.Rows[0][0].(string), "/2"))
+	query(t, s, "BEGIN")
+	query(t, s, "TRUNCATE t")
+	query(t, s, "INSERT INTO t (a) VALUES (5)")
+	query(t, s, "INSERT INTO t (a) VALUES (6)")
+	query(t, s, "INSERT INTO t (a) VALUES (7)")
+	query(t, s, "ROLLBACK")
+	result = query(t, s, "INSERT INTO t (a) VALUES (8)")
+	assert.True(t, strings.HasSuffix(result.Rows[0][0].(string), "/3"))
+	assert.Equal(t, 3, count(t, s, "t"))
+	saved, err := catalog.NewManager(e.Store)
+	assert.NoError(t, err)
+	seq := schema.GetByName[*desc.Sequence](saved.Schema, "t_seq")
+	assert.Equal(t, uint64(3), seq.V)
+
+	_, err = s.Query("TRUNCATE __sequences__", nil)
+	assert.IsError(t, err, "cannot change system table __sequences__")
+}
+
+func TestSessionPrimaryKey(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER PRIMARY KEY, b STRING)")
+	table := schema.GetByName[*desc.Table](e.Catalog.Schema, "t")
+	assert.Equal(t, []string{"a"}, table.PrimaryKey)
+	assert.Nil(t, table.GetColumn(desc.ReservedInternalColumnName))
+	assert.Nil(t, schema.GetByName[*desc.Sequence](e.Catalog.Schema, "t_seq"))
+
+	// rows are kept in primary key order.
+	query(t, s, `INSERT INTO t (a, b) VALUES (3, "c"), (1, "a")`)
+	query(t, s, `INSERT INTO t (a, b) VALUES (2, "b")`)
+	result := query(t, s, "SELECT * FROM t")
+	assert.Equal(t, []execution.Row{{1.0, "a"}, {2.0, "b"}, {3.0, "c"}}, result.Rows)
+
+	_, err := s.Query(`INSERT INTO t (a, b) VALUES (2, "x")`, nil)
+	assert.IsError(t, err, `duplicate key value violates unique constraint "t_pkey": key (a)=(2) already exists`)
+	assert.Equal(t, pgerror.UniqueViolation, pgerror.CodeOf(err))
+
+	// duplicates within a statement are caught too, and none of its
+	// rows are inserted.
+	_, err = s.Query(`INSERT INTO t (a, b) VALUES (4, "d"), (4, "e")`, nil)
+	assert.Equal(t, pgerror.UniqueViolation, pgerror.CodeOf(err))
+	assert.Equal(t, 3, count(t, s, "t"))
+
+	_, err = s.Query(`INSERT INTO t (b) VALUES ("x")`, nil)
+	assert.IsError(t, err, "key column 'a' missing on insert of row '[x]'")
+	assert.Equal(t, pgerror.NotNullViolation, pgerror.CodeOf(err))
+}
+
+func TestSessionCompositePrimaryKey(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a STRING, b NUMBER, c STRING, PRIMARY KEY (a, b))")
+	query(t, s, `INSERT INTO t (a, b, c) VALUES ("y", 1, "3"), ("x", 2, "2"), ("x", 1, "1")`)
+	result := query(t, s, "SELECT * FROM t")
+	assert.Equal(t, []execution.Row{{"x", 1.0, "1"}, {"x", 2.0, "2"}, {"y", 1.0, "3"}}, result.Rows)
+
+	_, err := s.Query(`INSERT INTO t (a, b, c) VALUES ("x", 2, "4")`, nil)
+	assert.IsError(t, err, `duplicate key value violates unique constraint "t_pkey": key (a, b)=(x, 2) already exists`)
+
+	for q, msg := range map[string]string{
+		"CREATE TABLE u (a NUMBER PRIMARY KEY, b NUMBER PRIMARY KEY)":      "multiple primary keys for table 'u' are not allowed",
+		"CREATE TABLE u (a NUMBER PRIMARY KEY, b NUMBER, PRIMARY KEY (b))": "multiple primary keys for table 'u' are not allowed",
+		"CREATE TABLE u (a NUMBER, PRIMARY KEY (a, a))":                    "column 'a' appears twice in primary key of table 'u'",
+		"CREATE TABLE u (a NUMBER, PRIMARY KEY (b))":                       "could not find key column 'b' while creating table 'u'",
+		"ALTER TABLE t ADD COLUMN d NUMBER PRIMARY KEY":                    "cannot add primary key column 'd' to table 't'",
+	} {
+		_, err := s.Query(q, nil)
+		assert.IsError(t, err, msg)
+	}
+}
+
+func TestSessionNotNull(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, `CREATE TABLE t (a NUMBER NOT NULL, b STRING NOT NULL DEFAULT "x")`)
+	query(t, s, "INSERT INTO t (a) VALUES (1)")
+	result := query(t, s, "SELECT * FROM t")
+	assert.Equal(t, []execution.Row{{1.0, "x"}}, result.Rows)
+
+	for _, q := range []string{
+		`INSERT INTO t (b) VALUES ("y")`,
+		`INSERT INTO t (a, b) VALUES (NULL, "y")`,
+		"INSERT INTO t (a, b) VALUES (2, NULL)",
+	} {
+		_, err := s.Query(q, nil)
+		assert.Equal(t, pgerror.NotNullViolation, pgerror.CodeOf(err))
+	}
+	_, err := s.Query(`INSERT INTO t (b) VALUES ("y")`, nil)
+	assert.IsError(t, err, `null value in column "a" of relation "t" violates not-null constraint`)
+
+	// adding a not null column fails if existing rows would be null,
+	// unless it has a default.
+	_, err = s.Query("ALTER TABLE t ADD COLUMN c NUMBER NOT NULL", nil)
+	assert.IsError(t, err, `null value in column "c" of relation "t" violates not-null constraint`)
+	query(t, s, "ALTER TABLE t ADD COLUMN c NUMBER NOT NULL DEFAULT 0")
+	result = query(t, s, "SELECT * FROM t")
+	assert.Equal(t, []execution.Row{{1.0, "x", 0.0}}, result.Rows)
+}
+
+func TestSessionUnique(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER UNIQUE, b STRING)")
+	query(t, s, `INSERT INTO t (a, b) VALUES (1, "x"), (2, "y")`)
+
+	_, err := s.Query(`INSERT INTO t (a, b) VALUES (1, "z")`, nil)
+	assert.IsError(t, err, `duplicate key value violates unique constraint "t_a_key": key (a)=(1) already exists`)
+	assert.Equal(t, pgerror.UniqueViolation, pgerror.CodeOf(err))
+
+	_, err = s.Query(`INSERT INTO t (a, b) VALUES (3, "z"), (3, "w")`, nil)
+	assert.Equal(t, pgerror.UniqueViolation, pgerror.CodeOf(err))
+	assert.Equal(t, 2, count(t, s, "t"))
+
+	// nulls don't conflict.
+	query(t, s, `INSERT INTO t (b) VALUES ("z"), ("w")`)
+	assert.Equal(t, 4, count(t, s, "t"))
+
+	// rows inserted earlier in the transaction are seen.
+	query(t, s, "BEGIN")
+	query(t, s, "INSERT INTO t (a) VALUES (5)")
+	_, err = s.Query("INSERT INTO t (a) VALUES (5)", nil)
+	assert.Equal(t, pgerror.UniqueViolation, pgerror.CodeOf(err))
+	query(t, s, "ROLLBACK")
+
+	// adding a unique column checks the existing rows.
+	query(t, s, "ALTER TABLE t ADD COLUMN c NUMBER UNIQUE")
+	_, err = s.Query("ALTER TABLE t ADD COLUMN d NUMBER UNIQUE DEFAULT 1", nil)
+	assert.Equal(t, pgerror.UniqueViolation, pgerror.CodeOf(err))
+
+	// the values of existing rows are indexed by the column they're
+	// added with, and dropped with it.
+	query(t, s, "CREATE TABLE u (a NUMBER)")
+	query(t, s, "INSERT INTO u (a) VALUES (1)")
+	query(t, s, "ALTER TABLE u ADD COLUMN b NUMBER UNIQUE DEFAULT 1")
+	_, err = s.Query("INSERT INTO u (a, b) VALUES (2, 1)", nil)
+	assert.Equal(t, pgerror.UniqueViolation, pgerror.CodeOf(err))
+	query(t, s, "ALTER TABLE u DROP COLUMN b")
+	query(t, s, "ALTER TABLE u ADD COLUMN b NUMBER UNIQUE")
+	query(t, s, "INSERT INTO u (a, b) VALUES (2, 1)")
+
+	// as are the rows' values when the table is truncated.
+	query(t, s, "TRUNCATE t")
+	query(t, s, `INSERT INTO t (a, b) VALUES (1, "x")`)
+}
+
+func TestSessionConcurrentUniqueInserts(t *testing.T) {
+	e := newEngine(&Config{})
+	s, other := e.NewSession(), e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER UNIQUE)")
+	query(t, s, "INSERT INTO t (a) VALUES (1)")
+
+	// each value is looked up by itself, so blocks inserting different
+	// values don't conflict.
+	query(t, s, "BEGIN")
+	query(t, other, "BEGIN")
+	query(t, s, "INSERT INTO t (a) VALUES (2)")
+	query(t, other, "INSERT INTO t (a) VALUES (3)")
+	query(t, s, "COMMIT")
+	query(t, other, "COMMIT")
+	assert.Equal(t, 3, count(t, s, "t"))
+
+	// while those inserting the same value do.
+	query(t, s, "BEGIN")
+	query(t, other, "BEGIN")
+	query(t, s, "INSERT INTO t (a) VALUES (4)")
+	query(t, other, "INSERT INTO t (a) VALUES (4)")
+	query(t, s, "COMMIT")
+	_, err := other.Query("COMMIT", nil)
+	assert.Equal(t, pgerror.SerializationFailure, pgerror.CodeOf(err))
+	assert.Equal(t, 4, count(t, s, "t"))
+}
+
+func TestSessionCheck(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER CHECK (a > 0), b NUMBER CHECK (b > a))")
+	query(t, s, "INSERT INTO t (a, b) VALUES (1, 2)")
+
+	_, err := s.Query("INSERT INTO t (a, b) VALUES (0, 2)", nil)
+	assert.IsError(t, err, `new row for relation "t" violates check constraint "t_a_check"`)
+	assert.Equal(t, pgerror.CheckViolation, pgerror.CodeOf(err))
+	_, err = s.Query("INSERT INTO t (a, b) VALUES (2, 1)", nil)
+	assert.IsError(t, err, `new row for relation "t" violates check constraint "t_b_check"`)
+
+	// a check on null values is satisfied.
+	query(t, s, "INSERT INTO t (a) VALUES (3)")
+	assert.Equal(t, 2, count(t, s, "t"))
+
+	// checks follow their columns when renamed, and keep the columns
+	// they depend on from being dropped.
+	query(t, s, "ALTER TABLE t RENAME COLUMN a TO c")
+	table := schema.GetByName[*desc.Table](e.Catalog.Schema, "t")
+	assert.Equal(t, "b > c", table.GetColumn("b").Check)
+	_, err = s.Query("INSERT INTO t (c, b) VALUES (2, 1)", nil)
+	assert.Equal(t, pgerror.CheckViolation, pgerror.CodeOf(err))
+	_, err = s.Query("ALTER TABLE t DROP COLUMN c", nil)
+	assert.IsError(t, err, "cannot drop column 'c' of table 't', the check constraint of column 'b' depends on it")
+	query(t, s, "ALTER TABLE t DROP COLUMN b")
+	query(t, s, "ALTER TABLE t DROP COLUMN c")
+
+	// checks are type checked against the table's columns when they're
+	// created, rather than failing every insert.
+	_, err = s.Query("CREATE TABLE u (a NUMBER CHECK (a + 1))", nil)
+	assert.IsError(t, err, "argument of CHECK must be type BOOLEAN, not type NUMBER")
+	assert.Equal(t, pgerror.DatatypeMismatch, pgerror.CodeOf(err))
+	_, err = s.Query("CREATE TABLE u (a NUMBER CHECK (zz > 1))", nil)
+	assert.IsError(t, err, "check constraint of column 'a': column 'zz' does not exist")
+	assert.Equal(t, pgerror.UndefinedColumn, pgerror.CodeOf(err))
+	_, err = s.Query("ALTER TABLE t ADD COLUMN d NUMBER CHECK (zz > 1)", nil)
+	assert.Equal(t, pgerror.UndefinedColumn, pgerror.CodeOf(err))
+	_, err = s.Query(`ALTER TABLE t ADD COLUMN d STRING CHECK (d)`, nil)
+	assert.Equal(t, pgerror.DatatypeMismatch, pgerror.CodeOf(err))
+	query(t, s, "ALTER TABLE t ADD COLUMN d NUMBER CHECK (d > 0)")
+}
+
+func TestSessionInsertTypes(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER, b STRING, c BOOLEAN)")
+	query(t, s, `INSERT INTO t (a, b, c) VALUES (1, "x", true), (-2 * 3, "y" + "z", 1 < 2), (NULL, NULL, NULL)`)
+
+	// literals are cast to the column's type where it's safe.
+	query(t, s, `INSERT INTO t (a, b, c) VALUES ("2.5", 3, "false")`)
+	result := query(t, s, "SELECT * FROM t")
+	assert.Equal(t, []execution.Row{
+		{1.0, "x", true}, {-6.0, "yz", true}, {nil, nil, nil}, {2.5, "3", false},
+	}, result.Rows)
+
+	for q, msg := range map[string]string{
+		`INSERT INTO t (a) VALUES ("abc")`:                  `Tuple 0 value 0: invalid input for column 'a' of type NUMBER: "abc"`,
+		`INSERT INTO t (a, c) VALUES (1, 1)`:                "Tuple 0 value 1: column 'c' is of type BOOLEAN but expression is of type NUMBER",
+		`INSERT INTO t (b, a) VALUES ("x", 1), ("y", true)`: "Tuple 1 value 1: column 'a' is of type NUMBER but expression is of type BOOLEAN",
+		`INSERT INTO t (b) VALUES (1 + 2)`:                  "Tuple 0 value 0: column 'b' is of type STRING but expression is of type NUMBER",
+		`INSERT INTO t (a) VALUES (1 + "x")`:                "Tuple 0 value 0: operator + cannot be applied to types NUMBER and STRING",
+	} {
+		_, err := s.Query(q, nil)
+		assert.IsError(t, err, msg)
+	}
+	_, err := s.Query(`INSERT INTO t (a) VALUES ("abc")`, nil)
+	assert.Equal(t, pgerror.InvalidTextRepr, pgerror.CodeOf(err))
+	_, err = s.Query(`INSERT INTO t (c) VALUES (1)`, nil)
+	assert.Equal(t, pgerror.DatatypeMismatch, pgerror.CodeOf(err))
+	assert.Equal(t, 4, count(t, s, "t"))
+}
+
+func TestSessionSelectWhere(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER PRIMARY KEY, b STRING, c BOOLEAN)")
+	query(t, s, `INSERT INTO t (a, b, c) VALUES (1, "x", true), (2, "y", false), (3, "x", NULL), (4, NULL, true)`)
+
+	for q, rows := range map[string][]execution.Row{
+		"SELECT * FROM t WHERE a > 2":           {{3.0, "x", nil}, {4.0, nil, true}},
+		`SELECT * FROM t WHERE b == "x"`:        {{1.0, "x", true}, {3.0, "x", nil}},
+		"SELECT * FROM t WHERE c":               {{1.0, "x", true}, {4.0, nil, true}},
+		"SELECT * FROM t WHERE !c":              {{2.0, "y", false}},
+		`SELECT * FROM t WHERE b + "!" != "x!"`: {{2.0, "y", false}},
+		"SELECT * FROM t WHERE a * 2 == a + 2":  {{2.0, "y", false}},
+		"SELECT * FROM t WHERE a > 10":          {},
+	} {
+		result := query(t, s, q)
+		assert.Equal(t, rows, result.Rows)
+	}
+
+	for q, msg := range map[string]string{
+		"SELECT * FROM t WHERE d > 1":   "column 'd' does not exist",
+		"SELECT * FROM t WHERE a + 1":   "argument of WHERE must be type BOOLEAN, not type NUMBER",
+		`SELECT * FROM t WHERE b > 1`:   "operator > cannot be applied to types STRING and NUMBER",
+		"SELECT * FROM t WHERE a > 1 b": "finished parsing without consuming all input",
+	} {
+		_, err := s.Query(q, nil)
+		assert.IsError(t, err, msg)
+	}
+}
+
+func TestSessionSelectProjection(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER PRIMARY KEY, b STRING)")
+	query(t, s, `INSERT INTO t (a, b) VALUES (1, "x"), (2, "y"), (3, NULL)`)
+
+	result := query(t, s, `SELECT b, a * 10 AS ten, b + "!", a FROM t WHERE a < 3`)
+	assert.Equal(t, []string{"b", "ten", "?column?", "a"}, result.Columns)
+	assert.Equal(t, []execution.Row{{"x", 10.0, "x!", 1.0}, {"y", 20.0, "y!", 2.0}}, result.Rows)
+
+	// the star can be mixed with other terms.
+	result = query(t, s, "SELECT a + 1 AS next, * FROM t WHERE a == 3")
+	assert.Equal(t, []string{"next", "a", "b"}, result.Columns)
+	assert.Equal(t, []execution.Row{{4.0, 3.0, nil}}, result.Rows)
+
+	result = query(t, s, `SELECT 1 + 2 AS three, "a" + "b"`)
+	assert.Equal(t, []string{"three", "?column?"}, result.Columns)
+	assert.Equal(t, []execution.Row{{3.0, "ab"}}, result.Rows)
+
+	for q, msg := range map[string]string{
+		"SELECT c FROM t":     "column 'c' does not exist",
+		"SELECT a + b FROM t": "operator + cannot be applied to types NUMBER and STRING",
+		"SELECT *":            "SELECT * with no tables specified is not valid",
+		"SELECT a":            "column 'a' does not exist",
+	} {
+		_, err := s.Query(q, nil)
+		assert.IsError(t, err, msg)
+	}
+}
+
+func TestSessionLogic(t *testing.T) {
+	e := newEngine(&Config{})
+	s := e.NewSession()
+	query(t, s, "CREATE TABLE t (a NUMBER PRIMARY KEY, b BOOLEAN)")
+	query(t, s, "INSERT INTO t (a, b) VALUES (1, true), (2, false), (3, NULL)")
+
+	for q, rows := range map[string][]execution.Row{
+		"SELECT a FROM t WHERE a > 1 AND NOT b":      {{2.0}},
+		"SELECT a FROM t WHERE a == 1 OR b":          {{1.0}},
+		"SELECT a FROM t WHERE NOT b OR a == 3":      {{2.0}, {3.0}},
+		"SELECT a FROM t WHERE NOT (a > 1 OR b)":     {},
+		"SELECT a FROM t WHERE a < 2 OR a > 2 AND b": {{1.0}},
+	} {
+		result := query(t, s, q)
+		assert.Equal(t, rows, result.Rows)
+	}
+
+	// null is unknown, so it only decides the result if the other
+	// operand doesn't.
+	result := query(t, s, `SELECT
+		b AND true, b AND false, b OR true, b OR false, NOT b
+		FROM t WHERE a == 3`)
+	assert.Equal(t, []execution.Row{{nil, false, true, nil, nil}}, result.Rows)
+	result = query(t, s, "SELECT true AND true, true AND false, false OR false, true OR false, NOT false")
+	assert.Equal(t, []execution.Row{{true, false, false, true, true}}, result.Rows)
+
+	_, err := s.Query("SELECT a FROM t WHERE a AND b", nil)
+	assert.IsError(t, err, "operator AND cannot be applied to types NUMBER and BOOLEAN")
+	_, err = s.Query("SELECT NOT a FROM t", nil)
+	assert.IsError(t, err, "operator NOT cannot be applied to type NUMBER")
+
+	// constraints can use them too.
+	query(t, s, "CREATE TABLE u (a NUMBER CHECK (a > 0 AND a < 10 OR a == 100))")
+	query(t, s, "INSERT INTO u (a) VALUES (5), (100)")
+	_, err = s.Query("INSERT INTO u (a) VALUES (10)", nil)
+	assert.Equal(t, pgerror.CheckViolation, pgerror.CodeOf(err))
+}
@@ -13,24 +13,27 @@ executed otherwise.
 
 Because it depends on the logic required to create system objects
 from the manager, it initalizes a temporary, throwaway manager
-instance to handle the storage of the meta objects.
+instance to handle the storage of the meta objects. The objects are
+written in a single batch, so a crash can't leave the store half
+bootstrapped.
 */
 func Bootstrap(st kv.Store, sc *schema.Schema) error {
 	tmp := &Manager{
 		Schema: sc,
 		Store:  st,
 	}
+	batch := kv.NewWriteBatch()
 	for _, t := range sc.Tables.All() {
-		err := save(tmp, t)
+		err := save(tmp, batch, t)
 		if err != nil {
 			return err
 		}
 	}
 	for _, s := range sc.Sequences.All() {
-		err := save(tmp, s)
+		err := save(tmp, batch, s)
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+	return st.Write(batch)
 }
@@ -155,8 +155,8 @@ func BenchmarkCatalogWrites(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		j := rand.Intn(len(tables))
-		catalog.Create(ct, tables[j])
-		catalog.Create(ct, sequences[j])
+		catalog.Create(ct, store, tables[j])
+		catalog.Create(ct, store, sequences[j])
 
 	}
 }
@@ -3,9 +3,23 @@ package desc
 import "github.com/angles-n-daemons/popsql/pkg/db/sql/parser/scanner"
 
 type Column struct {
+	// ID identifies the column's values in the table's rows. It's
+	// assigned by the table when the column is added, and never
+	// changes or gets reused, even if the column is renamed or
+	// dropped.
+	ID       uint32
 	Name     string
 	DataType DataType
 	Sequence string
+	// Default is the value the column takes when it's left out of an
+	// insert, and the value it has in rows written before it was added
+	// to the table.
+	Default any
+	// NotNull, Unique and Check are the column's constraints. Check is
+	// the text of an expression which no row may make false.
+	NotNull bool
+	Unique  bool
+	Check   string
 }
 
 func NewColumn(name string, dt DataType) *Column {
@@ -44,5 +58,6 @@ func (c *Column) Equal(o *Column) bool {
 	if o == nil {
 		return false
 	}
-	return c.Name == o.Name && c.DataType == o.DataType
+	return c.ID == o.ID && c.Name == o.Name && c.DataType == o.DataType && c.Default == o.Default &&
+		c.NotNull == o.NotNull && c.Unique == o.Unique && c.Check == o.Check
 }
@@ -18,6 +18,9 @@ type Table struct {
 	TName      string    `json:"name"`
 	Columns    []*Column `json:"columns"`
 	PrimaryKey []string  `json:"primary_key"`
+	// NextColumnID is the ID the next column added to the table
+	// will be given.
+	NextColumnID uint32 `json:"next_column_id"`
 }
 
 func NewTable(name string, columns []*Column, pkey []string) (*Table, error) {
@@ -42,12 +45,14 @@ func NewTableWithID(id uint64, name string, columns []*Column, pkey []string) (*
 			return nil, fmt.Errorf("could not find key column '%s' while creating table '%s'", key, name)
 		}
 	}
-	return &Table{
+	t := &Table{
 		TID:        id,
 		TName:      name,
 		Columns:    columns,
 		PrimaryKey: pkey,
-	}, nil
+	}
+	t.assignColumnIDs()
+	return t, nil
 }
 
 func NewTableFromBytes(tableBytes []byte) (*Table, error) {
@@ -56,6 +61,99 @@ func NewTableFromBytes(tableBytes []byte) (*Table, error) {
 	return table, err
 }
 
+// UnmarshalJSON decodes a table, whose columns must all have IDs.
+func (t *Table) UnmarshalJSON(b []byte) error {
+	type table Table
+	if err := json.Unmarshal(b, (*table)(t)); err != nil {
+		return err
+	}
+	for _, col := range t.Columns {
+		if col.ID == 0 || col.ID >= t.NextColumnID {
+			return fmt.Errorf("column '%s' of table '%s' has an invalid ID %d", col.Name, t.TName, col.ID)
+		}
+	}
+	return nil
+}
+
+// AddColumn adds a column to the end of the table, giving it the
+// next column ID.
+func (t *Table) AddColumn(col *Column) {
+	col.ID = t.nextColumnID()
+	t.Columns = append(t.Columns, col)
+}
+
+// assignColumnIDs gives the next IDs to any of the table's columns
+// which don't have one yet, in order, making sure first that the
+// counter is past the IDs the columns already have.
+func (t *Table) assignColumnIDs() {
+	for _, col := range t.Columns {
+		if col.ID >= t.NextColumnID {
+			t.NextColumnID = col.ID + 1
+		}
+	}
+	for _, col := range t.Columns {
+		if col.ID == 0 {
+			col.ID = t.nextColumnID()
+		}
+	}
+}
+
+func (t *Table) nextColumnID() uint32 {
+	if t.NextColumnID == 0 {
+		// IDs start from one, so that zero means none.
+		t.NextColumnID = 1
+	}
+	id := t.NextColumnID
+	t.NextColumnID++
+	return id
+}
+
+// DropColumn removes a column from the table. Its ID isn't reused, so
+// the values rows hold for it are ignored from then on.
+func (t *Table) DropColumn(name string) error {
+	i := slices.IndexFunc(t.Columns, func(c *Column) bool { return c.Name == name })
+	if i < 0 || name == ReservedInternalColumnName {
+		return fmt.Errorf("column '%s' does not exist in table '%s'", name, t.TName)
+	}
+	if slices.Contains(t.PrimaryKey, name) {
+		return fmt.Errorf("cannot drop column '%s' of table '%s', it is part of the primary key", name, t.TName)
+	}
+	t.Columns = slices.Delete(t.Columns, i, i+1)
+	return nil
+}
+
+// RenameColumn renames one of the table's columns. Rows refer to the
+// column by its ID, so they don't need rewriting.
+func (t *Table) RenameColumn(name, newName string) error {
+	col := t.GetColumn(name)
+	if col == nil || name == ReservedInternalColumnName {
+		return fmt.Errorf("column '%s' does not exist in table '%s'", name, t.TName)
+	}
+	if t.GetColumn(newName) != nil || newName == ReservedInternalColumnName {
+		return fmt.Errorf("column '%s' already exists in table '%s'", newName, t.TName)
+	}
+	col.Name = newName
+	for i, key := range t.PrimaryKey {
+		if key == name {
+			t.PrimaryKey[i] = newName
+		}
+	}
+	return nil
+}
+
+// Copy returns a copy of the table, which can be altered without
+// changing the original.
+func (t *Table) Copy() *Table {
+	c := *t
+	c.Columns = make([]*Column, len(t.Columns))
+	for i, col := range t.Columns {
+		colCopy := *col
+		c.Columns[i] = &colCopy
+	}
+	c.PrimaryKey = slices.Clone(t.PrimaryKey)
+	return &c
+}
+
 func (t *Table) WithID(id uint64) {
 	t.TID = id
 }
@@ -101,7 +199,7 @@ func (t *Table) Equal(o *Table) bool {
 	if !slices.Equal(t.PrimaryKey, o.PrimaryKey) {
 		return false
 	}
-	return true
+	return t.NextColumnID == o.NextColumnID
 }
 
 func (t *Table) Prefix() *keys.Key {
@@ -119,6 +217,22 @@ func (t *Table) Span() *keys.Span {
 	}
 }
 
+// IndexPrefix returns the prefix of the index on a unique column,
+// which maps each of the column's values to the key of the row holding
+// it. It sorts just before the table's span, so scans of the table
+// don't see it.
+func (t *Table) IndexPrefix(col *Column) *keys.Key {
+	return keys.New(t.Prefix().Table + "." + strconv.FormatUint(uint64(col.ID), 10))
+}
+
+func (t *Table) IndexSpan(col *Column) *keys.Span {
+	p := t.IndexPrefix(col)
+	return &keys.Span{
+		Start: p,
+		End:   p.Next(),
+	}
+}
+
 func (t *Table) Name() string {
 	return t.TName
 }
@@ -139,3 +253,13 @@ func (t *Table) Value() ([]byte, error) {
 func (t *Table) DefaultSequenceName() string {
 	return t.TName + "_seq"
 }
+
+// KeySequenceName returns the name of the sequence the table's
+// internal key is drawn from. It's named after the table when the
+// table is created, but keeps its name if the table is renamed.
+func (t *Table) KeySequenceName() string {
+	if col := t.GetColumn(ReservedInternalColumnName); col != nil && col.Sequence != "" {
+		return col.Sequence
+	}
+	return t.DefaultSequenceName()
+}
@@ -32,6 +32,7 @@ func TestTableGetColumn(t *testing.T) {
 		table := catalogT.Table()
 		column := table.GetColumn("a")
 		expected := desc.NewColumn("a", desc.NUMBER)
+		expected.ID = 1
 		assert.Equal(t, expected, column)
 	})
 	t.Run("column doesn't exist", func(t *testing.T) {
@@ -113,6 +114,81 @@ func TestTableSerialization(t *testing.T) {
 	assert.Equal(t, original, table)
 }
 
+func TestTableColumnIDs(t *testing.T) {
+	t.Run("assigned in order", func(t *testing.T) {
+		a := desc.NewColumn("a", desc.NUMBER)
+		b := desc.NewColumn("b", desc.STRING)
+		table, err := desc.NewTable("ids", []*desc.Column{a, b}, []string{"a"})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, a.ID)
+		assert.Equal(t, 2, b.ID)
+		assert.Equal(t, 3, table.NextColumnID)
+	})
+
+	t.Run("add column", func(t *testing.T) {
+		table := catalogT.Table()
+		c := desc.NewColumn("c", desc.NUMBER)
+		table.AddColumn(c)
+		assert.Equal(t, 3, c.ID)
+		assert.Equal(t, 4, table.NextColumnID)
+	})
+
+	t.Run("not reused", func(t *testing.T) {
+		table := catalogT.Table()
+		table.Columns = table.Columns[:1]
+		c := desc.NewColumn("c", desc.NUMBER)
+		table.AddColumn(c)
+		assert.Equal(t, 3, c.ID)
+	})
+
+	t.Run("missing from descriptor", func(t *testing.T) {
+		noIDs := `{"id":1,"name":"old","columns":[{"Name":"a","DataType":1},{"Name":"b","DataType":2}],"primary_key":["a"]}`
+		_, err := desc.NewTableFromBytes([]byte(noIDs))
+		assert.IsError(t, err, "column 'a' of table 'old' has an invalid ID 0")
+	})
+}
+
+func TestTableDropColumn(t *testing.T) {
+	table := catalogT.Table()
+	table.PrimaryKey = []string{"a"}
+	err := table.DropColumn("b")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(table.Columns))
+	assert.Nil(t, table.GetColumn("b"))
+
+	err = table.DropColumn("b")
+	assert.IsError(t, err, "column 'b' does not exist in table '%s'", table.Name())
+	err = table.DropColumn("a")
+	assert.IsError(t, err, "cannot drop column 'a' of table '%s', it is part of the primary key", table.Name())
+}
+
+func TestTableRenameColumn(t *testing.T) {
+	table := catalogT.Table()
+	err := table.RenameColumn("a", "c")
+	assert.NoError(t, err)
+	assert.Equal(t, table.Columns[0].Name, "c")
+	assert.Equal(t, table.Columns[0].ID, 1)
+	assert.Equal(t, table.PrimaryKey, []string{"c"})
+
+	err = table.RenameColumn("a", "d")
+	assert.IsError(t, err, "column 'a' does not exist in table '%s'", table.Name())
+	err = table.RenameColumn("c", "b")
+	assert.IsError(t, err, "column 'b' already exists in table '%s'", table.Name())
+}
+
+func TestTableCopy(t *testing.T) {
+	table := catalogT.Table()
+	c := table.Copy()
+	assert.Equal(t, table, c)
+
+	c.AddColumn(desc.NewColumn("c", desc.NUMBER))
+	assert.NoError(t, c.RenameColumn("a", "d"))
+	assert.Equal(t, 2, len(table.Columns))
+	assert.Equal(t, table.Columns[0].Name, "a")
+	assert.Equal(t, table.PrimaryKey, []string{"a"})
+	assert.Equal(t, table.NextColumnID, 3)
+}
+
 func TestTablePrefix(t *testing.T) {
 	for _, test := range []struct {
 		id       uint64
@@ -129,6 +205,17 @@ func TestTablePrefix(t *testing.T) {
 	}
 }
 
+func TestTableIndexSpan(t *testing.T) {
+	table := catalogT.TableWithID(1)
+	span := table.IndexSpan(&desc.Column{ID: 3})
+	assert.Equal(t, "1.3/", span.Start.Encode())
+	assert.Equal(t, "1.30", span.End.Encode())
+
+	// the index sorts outside of the table's span.
+	ts := table.Span()
+	assert.True(t, span.End.Encode() < ts.Start.Encode())
+}
+
 func TestTableKey(t *testing.T) {
 	table := &desc.Table{
 		TID: 123,
@@ -3,16 +3,32 @@ package catalog
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
 
 	"github.com/angles-n-daemons/popsql/pkg/db/kv"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/keys"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/desc"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/schema"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/sys"
 )
 
+// Manager keeps the schema, and saves the changes made to it to the
+// store.
+//
+// The schema is shared by every transaction, so it's never changed in
+// place. A transaction which changes it does so in a Copy of the
+// manager, whose schema replaces the shared one with Publish once the
+// transaction commits.
 type Manager struct {
 	Schema *schema.Schema
 	Store  kv.Store
+	// seqMu is held while advancing a sequence, so that its values
+	// are handed out and saved in order. It's shared with copies of
+	// the manager, whose sequences are the same.
+	seqMu *sync.Mutex
+	// reset holds the ids of the sequences reset by the transaction
+	// changing this copy of the manager.
+	reset map[uint64]struct{}
 }
 
 var (
@@ -20,68 +36,148 @@ var (
 	tSequence = &desc.Sequence{}
 )
 
+// Copy returns a manager over a copy of the schema, for a transaction
+// to change without the changes being seen by others.
+func Copy(m *Manager) *Manager {
+	return &Manager{
+		Schema: m.Schema.Copy(),
+		Store:  m.Store,
+		seqMu:  m.seqMu,
+		reset:  map[uint64]struct{}{},
+	}
+}
+
+// Publish replaces the schema with the one changed in c, a copy of
+// the manager. It's called once the transaction which changed it has
+// committed.
+func Publish(m *Manager, c *Manager) {
+	m.Schema = c.Schema
+}
+
+// LockKey returns the key transactions lock the schema under, which
+// is the prefix of the table of table descriptors. It's found without
+// reading the schema, which may only be read once it's locked.
+func LockKey() *keys.Key {
+	t, _ := sys.InitSystemTable(sys.TablesID, sys.Tables, sys.TablesSequence)
+	return t.Prefix()
+}
+
 // Create is a manager function for adding new system objects to
-// the catalog.
-func Create[V desc.Any[V]](m *Manager, v V) error {
+// the catalog. The object is written to w, which may be a batch
+// holding the rest of the statement's writes.
+func Create[V desc.Any[V]](m *Manager, w kv.Writer, v V) error {
 	// add it to the underlying schema.
 	err := schema.Add(m.Schema, v)
 	if err != nil {
 		return err
 	}
 	// save it to the storage engine.
-	err = save(m, v)
+	return save(m, w, v)
+}
+
+// Update is a manager function for changing a system object in the
+// catalog, by replacing the object with the same id with v. Like
+// Create, the object is written to w.
+func Update[V desc.Any[V]](m *Manager, w kv.Writer, v V) error {
+	err := schema.Replace(m.Schema, v)
 	if err != nil {
-		return nil
+		return err
 	}
+	return save(m, w, v)
+}
 
-	return nil
+// Delete is a manager function for removing a system object from the
+// catalog. Like Create, its descriptor is deleted through w.
+func Delete[V desc.Any[V]](m *Manager, w kv.Writer, v V) error {
+	err := schema.Remove[V](m.Schema, v.ID())
+	if err != nil {
+		return err
+	}
+	return w.Delete(descriptorKey(m, v))
 }
 
 // NextDescriptorID is a utility function for getting the next
 // available id for a type of descriptor in the system.
-func NextDescriptorID[V desc.Any[V]](m *Manager, v V) (uint64, error) {
+func NextDescriptorID[V desc.Any[V]](m *Manager, w kv.Writer, v V) (uint64, error) {
 	// get the sequence fot this type.
 	s := getSystemSequence[V](m.Schema)
 
-	return SequenceNext(m, s)
+	return SequenceNext(m, w, s)
 }
 
-// SequenceNext is used to get the next value in a sequence. It
-// also writes the value of the sequence to disk, ignoring any
-// transaction semantics.
-func SequenceNext(m *Manager, s *desc.Sequence) (uint64, error) {
+// SequenceNext is used to get the next value in a sequence. Like
+// postgres, the new value is saved straight to the store rather than
+// to w, ignoring any transaction semantics. Concurrent transactions
+// never see the same value, nor conflict over the sequence, at the
+// cost of a gap in the sequence when a transaction rolls back.
+//
+// A sequence which hasn't been committed yet, or which the transaction
+// has reset, is saved to w, along with the rest of the transaction's
+// writes.
+func SequenceNext(m *Manager, w kv.Writer, s *desc.Sequence) (uint64, error) {
+	m.seqMu.Lock()
+	defer m.seqMu.Unlock()
+
+	if _, ok := m.reset[s.ID()]; !ok {
+		committed, err := m.Store.Get(descriptorKey(m, s))
+		if err != nil {
+			return 0, err
+		}
+		if committed != nil {
+			w = m.Store
+		}
+	}
+
 	// Get the next value in the sequence.
 	next := s.Next()
 
 	// Update the sequence in the store.
-	err := save(m, s)
+	err := save(m, w, s)
 	if err != nil {
 		return 0, err
 	}
 	return next, nil
 }
 
-// TableSequenceNext call SequenceNext on the default sequence for a table.
-func TableSequenceNext(m *Manager, t *desc.Table) (uint64, error) {
-	seq := schema.GetByName[*desc.Sequence](m.Schema, t.DefaultSequenceName())
+// SequenceReset restarts a sequence, so that the next value it hands
+// out is one. The reset is saved to w, so it's undone if the
+// transaction rolls back, as are the values handed out after it. The
+// sequence is replaced in the schema by a reset copy, rather than
+// being changed in place, so m must be the transaction's Copy of the
+// manager.
+func SequenceReset(m *Manager, w kv.Writer, s *desc.Sequence) error {
+	reset := desc.NewSequenceFromArgs(s.ID(), s.Name(), 0)
+	if err := Update(m, w, reset); err != nil {
+		return err
+	}
+	m.reset[s.ID()] = struct{}{}
+	return nil
+}
+
+// TableSequenceNext call SequenceNext on the key sequence for a table.
+func TableSequenceNext(m *Manager, w kv.Writer, t *desc.Table) (uint64, error) {
+	seq := schema.GetByName[*desc.Sequence](m.Schema, t.KeySequenceName())
 	if seq == nil {
 		return 0, fmt.Errorf("could not find key column for table %s", t.Name())
 	}
 
-	return SequenceNext(m, seq)
+	return SequenceNext(m, w, seq)
 }
 
 // save exists to store a collectible in the underlying store.
 // It's used both by Add for new objects, and on its own to save
 // changes to existing objects.
-func save[V desc.Any[V]](m *Manager, v V) error {
-	// Get the system table so that we can save the object.
-	sysTable := getSystemTable[V](m.Schema)
+func save[V desc.Any[V]](m *Manager, w kv.Writer, v V) error {
 	b, err := json.Marshal(v)
 	if err != nil {
 		return err
 	}
-	return m.Store.Put(sysTable.Prefix().WithID(v.Key()).Encode(), b)
+	return w.Put(descriptorKey(m, v), b)
+}
+
+// descriptorKey returns the key an object is saved under.
+func descriptorKey[V desc.Any[V]](m *Manager, v V) string {
+	return getSystemTable[V](m.Schema).Prefix().WithID(v.Key()).Encode()
 }
 
 func getSystemTable[V desc.Any[V]](sc *schema.Schema) *desc.Table {
@@ -2,6 +2,7 @@ package catalog
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/angles-n-daemons/popsql/pkg/db/kv"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/desc"
@@ -45,6 +46,7 @@ func NewManager(st kv.Store) (*Manager, error) {
 	return &Manager{
 		Schema: sc,
 		Store:  st,
+		seqMu:  &sync.Mutex{},
 	}, nil
 }
 
@@ -68,6 +70,7 @@ func LoadCollection[V desc.Any[V]](sc *schema.Schema, st kv.Store) (*schema.Coll
 	if err != nil {
 		return nil, err
 	}
+	defer cur.Close()
 
 	bytesArr, err := cur.ReadAll()
 	if err != nil {
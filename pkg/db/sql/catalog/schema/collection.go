@@ -51,6 +51,36 @@ func (c *Collection[V]) Add(v V) error {
 	return nil
 }
 
+// Replace swaps the object with the same id as v for v, which may
+// have a new name.
+func (c *Collection[V]) Replace(v V) error {
+	id := v.ID()
+	name := v.Name()
+	old, ok := c.byID[id]
+	if !ok {
+		return fmt.Errorf("could not replace %T with id '%d'", *new(V), id)
+	}
+	if other, ok := c.byName[name]; ok && other.ID() != id {
+		return fmt.Errorf("%T with name '%s' already exists", *new(V), name)
+	}
+	delete(c.byName, old.Name())
+	c.byName[name] = v
+	c.byID[id] = v
+	return nil
+}
+
+// Copy returns a copy of the collection, holding the same objects.
+func (c *Collection[V]) Copy() *Collection[V] {
+	cp := NewCollection[V]()
+	for id, v := range c.byID {
+		cp.byID[id] = v
+	}
+	for name, v := range c.byName {
+		cp.byName[name] = v
+	}
+	return cp
+}
+
 func (c *Collection[V]) All() []V {
 	results := []V{}
 	for _, v := range c.byID {
@@ -139,6 +139,52 @@ func TestCollectionRemove(t *testing.T) {
 	assert.IsError(t, err, "could not delete %T with id '%d'", mc, 0)
 }
 
+func TestCollectionReplace(t *testing.T) {
+	c := schema.NewCollection[*MockCollectible]()
+	mc := NewMockCollectible(1, "one")
+	other := NewMockCollectible(2, "two")
+	assert.NoError(t, c.Add(mc))
+	assert.NoError(t, c.Add(other))
+
+	// happy path, with a rename
+	renamed := NewMockCollectible(1, "uno")
+	err := c.Replace(renamed)
+	assert.NoError(t, err)
+	assert.Equal(t, renamed, c.Get(1))
+	assert.Equal(t, renamed, c.GetByName("uno"))
+	assert.Nil(t, c.GetByName("one"))
+
+	// collision on name
+	err = c.Replace(NewMockCollectible(1, "two"))
+	assert.IsError(t, err, "%T with name '%s' already exists", mc, "two")
+	assert.Equal(t, renamed, c.Get(1))
+
+	// missing id
+	err = c.Replace(NewMockCollectible(3, "three"))
+	assert.IsError(t, err, "could not replace %T with id '%d'", mc, 3)
+}
+
+func TestCollectionCopy(t *testing.T) {
+	c := schema.NewCollection[*MockCollectible]()
+	one, two := NewMockCollectible(1, "one"), NewMockCollectible(2, "two")
+	assert.NoError(t, c.Add(one))
+	assert.NoError(t, c.Add(two))
+
+	cp := c.Copy()
+	assert.True(t, c.Equal(cp))
+
+	// changes to the copy leave the original as it was.
+	assert.NoError(t, cp.Remove(1))
+	assert.NoError(t, cp.Replace(NewMockCollectible(2, "dos")))
+	assert.NoError(t, cp.Add(NewMockCollectible(3, "three")))
+	assert.Equal(t, 2, c.Size())
+	assert.Equal(t, one, c.Get(1))
+	assert.Equal(t, two, c.GetByName("two"))
+	assert.Nil(t, c.Get(3))
+	assert.Nil(t, cp.Get(1))
+	assert.Nil(t, cp.GetByName("two"))
+}
+
 func TestCollectionEmpty(t *testing.T) {
 	// start empty
 	c := schema.NewCollection[*MockCollectible]()
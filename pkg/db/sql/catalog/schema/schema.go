@@ -26,6 +26,16 @@ func SchemaFromCollections(
 	}
 }
 
+// Copy returns a copy of the schema, which can be added to and
+// removed from without changing s. The descriptors themselves are
+// shared.
+func (s *Schema) Copy() *Schema {
+	return &Schema{
+		Tables:    s.Tables.Copy(),
+		Sequences: s.Sequences.Copy(),
+	}
+}
+
 func Add[V desc.Any[V]](s *Schema, v V) error {
 	return getCollection[V](s).Add(v)
 }
@@ -38,6 +48,10 @@ func GetByName[V desc.Any[V]](s *Schema, name string) V {
 	return getCollection[V](s).GetByName(name)
 }
 
+func Replace[V desc.Any[V]](s *Schema, v V) error {
+	return getCollection[V](s).Replace(v)
+}
+
 func Remove[V desc.Any[V]](s *Schema, id uint64) error {
 	return getCollection[V](s).Remove(id)
 }
@@ -28,7 +28,7 @@ func InitSchema() (*schema.Schema, error) {
 
 	// setup the sequence table with the value column.
 	sequenceTable, sequenceTableSeq := InitSystemTable(SequencesID, Sequences, SequencesSequence)
-	sequenceTable.Columns = append(sequenceTable.Columns, desc.NewColumn("value", desc.STRING))
+	sequenceTable.AddColumn(desc.NewColumn("value", desc.STRING))
 	for _, tab := range []*desc.Table{metaTable, sequenceTable} {
 		err := schema.Add(sc, tab)
 		if err != nil {
@@ -48,14 +48,12 @@ func InitSchema() (*schema.Schema, error) {
 
 func InitSystemTable(id uint64, name, seqName string) (*desc.Table, *desc.Sequence) {
 	tab := &desc.Table{
-		TID:   id,
-		TName: name,
-		Columns: []*desc.Column{
-			desc.NewSequenceColumn(idCol, seqName),
-			desc.NewColumn(nameCol, desc.STRING),
-		},
+		TID:        id,
+		TName:      name,
 		PrimaryKey: []string{idCol},
 	}
+	tab.AddColumn(desc.NewSequenceColumn(idCol, seqName))
+	tab.AddColumn(desc.NewColumn(nameCol, desc.STRING))
 	seq := desc.NewSequenceFromArgs(id, tab.DefaultSequenceName(), 2)
 	return tab, seq
 }
@@ -0,0 +1,104 @@
+package execution
+
+import (
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/desc"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/plan"
+)
+
+func (e *Executor) VisitAlterTable(p *plan.AlterTable) (Row, error) {
+	if e.State.done {
+		return nil, nil
+	}
+
+	err := e.evalDefaults(p.Altered, p.Defaults)
+	if err != nil {
+		return nil, err
+	}
+	if p.Validate {
+		err = e.validateRows(p.Table, p.Altered)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// a dropped column's index goes with it.
+	for _, col := range p.Table.Columns {
+		if col.Unique && !hasColumn(p.Altered, col.ID) {
+			err = e.deleteSpan(p.Table.IndexSpan(col))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	err = catalog.Update(e.Catalog, e.Batch, p.Altered)
+
+	// set the state variable to prevent re-altering the table.
+	e.State.done = true
+	return Row{p.Altered.Name()}, err
+}
+
+// validateRows checks the table's existing rows, read in terms of the
+// altered table, against its constraints. The values of columns which
+// were made unique are added to their indexes.
+func (e *Executor) validateRows(t, altered *desc.Table) error {
+	cons, err := newConstraints(altered)
+	if err != nil {
+		return err
+	}
+	indexed := []*desc.Column{}
+	for _, col := range altered.Columns {
+		if col.Unique && !hasColumn(t, col.ID) {
+			indexed = append(indexed, col)
+		}
+	}
+	dec := newRowDecoder(altered.Columns)
+	span := altered.Span()
+	cur, err := e.Txn.Scan(span.Start.Encode(), span.End.Encode())
+	if err != nil {
+		return err
+	}
+	defer cur.Close()
+	for {
+		key := cur.Key()
+		b, err := cur.Next()
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			return nil
+		}
+		row, err := dec.decode(b)
+		if err != nil {
+			return err
+		}
+		data := make(map[string]any, len(altered.Columns))
+		for i, col := range altered.Columns {
+			data[col.Name] = row[i]
+		}
+		if err := cons.check(e, data); err != nil {
+			return err
+		}
+		for _, col := range indexed {
+			v := data[col.Name]
+			if v == nil {
+				continue
+			}
+			k, err := altered.IndexPrefix(col).WithValues(v)
+			if err != nil {
+				return err
+			}
+			if err := e.Batch.Put(k.Encode(), []byte(key)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func hasColumn(t *desc.Table, id uint32) bool {
+	for _, col := range t.Columns {
+		if col.ID == id {
+			return true
+		}
+	}
+	return false
+}
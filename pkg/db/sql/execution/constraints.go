@@ -0,0 +1,140 @@
+package execution
+
+import (
+	"fmt"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/keys"
+	"github.com/angles-n-daemons/popsql/pkg/db/pgerror"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/desc"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/parser"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/parser/ast"
+)
+
+// constraints checks rows against the constraints on a table's
+// columns. Values of the unique columns are checked against those of
+// the rows checked before them, and by index against those already in
+// the table.
+type constraints struct {
+	t *desc.Table
+	// checks holds the parsed check constraints, and unique the values
+	// seen in each unique column, both by column name.
+	checks map[string]ast.Expr
+	unique map[string]map[any]struct{}
+}
+
+func newConstraints(t *desc.Table) (*constraints, error) {
+	c := &constraints{
+		t:      t,
+		checks: map[string]ast.Expr{},
+		unique: map[string]map[any]struct{}{},
+	}
+	for _, col := range t.Columns {
+		if col.Check != "" {
+			expr, err := parser.ParseExpr(col.Check)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse check constraint of column '%s': %w", col.Name, err)
+			}
+			c.checks[col.Name] = expr
+		}
+		if col.Unique {
+			c.unique[col.Name] = map[any]struct{}{}
+		}
+	}
+	return c, nil
+}
+
+// check returns an error if the row, given by column name, violates
+// one of the constraints. Otherwise the values of its unique columns
+// are kept, to check the rows which follow it against.
+func (c *constraints) check(e *Executor, data map[string]any) error {
+	name := c.t.Name()
+	for _, col := range c.t.Columns {
+		if col.NotNull && data[col.Name] == nil {
+			return pgerror.New(pgerror.NotNullViolation, fmt.Errorf(
+				"null value in column \"%s\" of relation \"%s\" violates not-null constraint",
+				col.Name, name,
+			))
+		}
+	}
+
+	// checks see every column of the row, with those it's missing
+	// being null.
+	scope := make(map[string]any, len(c.t.Columns))
+	for _, col := range c.t.Columns {
+		scope[col.Name] = data[col.Name]
+	}
+	for _, col := range c.t.Columns {
+		expr, ok := c.checks[col.Name]
+		if !ok {
+			continue
+		}
+		v, err := e.evalIn(scope, expr)
+		if err != nil {
+			return err
+		}
+		// a check which is null, rather than false, is satisfied.
+		switch v {
+		case false:
+			return pgerror.New(pgerror.CheckViolation, fmt.Errorf(
+				"new row for relation \"%s\" violates check constraint \"%s_%s_check\"",
+				name, name, col.Name,
+			))
+		case true, nil:
+		default:
+			return fmt.Errorf("check constraint of column '%s' must be a boolean, got %T", col.Name, v)
+		}
+	}
+
+	// null values don't conflict with each other.
+	for colName, seen := range c.unique {
+		v := data[colName]
+		if v == nil {
+			continue
+		}
+		if _, ok := seen[v]; ok {
+			return uniqueViolation(c.t, colName, v)
+		}
+	}
+	for colName, seen := range c.unique {
+		if v := data[colName]; v != nil {
+			seen[v] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// index checks the values of the row's unique columns against those
+// already in the table, and adds them to the columns' indexes under
+// the row's key. Each value is looked up by itself, so that inserts of
+// different values don't conflict with one another.
+func (c *constraints) index(e *Executor, key *keys.Key, data map[string]any) error {
+	for _, col := range c.t.Columns {
+		v := data[col.Name]
+		if !col.Unique || v == nil {
+			continue
+		}
+		k, err := c.t.IndexPrefix(col).WithValues(v)
+		if err != nil {
+			return err
+		}
+		existing, err := e.Txn.Get(k.Encode())
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return uniqueViolation(c.t, col.Name, v)
+		}
+		err = e.Batch.Put(k.Encode(), []byte(key.Encode()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func uniqueViolation(t *desc.Table, colName string, v any) error {
+	return pgerror.New(pgerror.UniqueViolation, fmt.Errorf(
+		"duplicate key value violates unique constraint \"%s_%s_key\": key (%s)=(%v) already exists",
+		t.Name(), colName, colName, v,
+	))
+}
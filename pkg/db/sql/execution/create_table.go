@@ -1,49 +1,76 @@
 package execution
 
 import (
+	"fmt"
+
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/desc"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/schema"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/parser/ast"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/plan"
 )
 
 func (e *Executor) VisitCreateTable(p *plan.CreateTable) (Row, error) {
-	if e.State.tableCreated {
+	if e.State.done {
 		return nil, nil
 	}
 
 	dt := p.Table
+	err := e.evalDefaults(dt, p.Defaults)
+	if err != nil {
+		return nil, err
+	}
 	if dt.PrimaryKey == nil || len(dt.PrimaryKey) == 0 {
 		pkeyCol, err := e.createTableSequence(dt)
 		if err != nil {
 			return nil, err
 		}
 
-		dt.Columns = append(dt.Columns, pkeyCol)
+		dt.AddColumn(pkeyCol)
 		dt.PrimaryKey = []string{pkeyCol.Name}
 	}
 
-	id, err := catalog.NextDescriptorID(e.Catalog, dt)
+	id, err := catalog.NextDescriptorID(e.Catalog, e.Batch, dt)
 	if err != nil {
 		return nil, err
 	}
 	dt.TID = id
-	err = catalog.Create(e.Catalog, dt)
+	err = catalog.Create(e.Catalog, e.Batch, dt)
 
 	// set the state variable to prevent re-creating the table.
-	e.State.tableCreated = true
+	e.State.done = true
 	return Row{dt.Name()}, err
 }
 
+// evalDefaults evaluates the default expressions of a table's columns,
+// which are given by column name.
+func (e *Executor) evalDefaults(t *desc.Table, defaults map[string]ast.Expr) error {
+	for name, expr := range defaults {
+		v, err := Eval(e, expr)
+		if err != nil {
+			return fmt.Errorf("could not evaluate the default of column '%s': %w", name, err)
+		}
+		t.GetColumn(name).Default = v
+	}
+	return nil
+}
+
+// createTableSequence creates the sequence a table's internal key is
+// drawn from. It's named after the table, with a number added if a
+// renamed table already has a sequence by that name.
 func (e *Executor) createTableSequence(t *desc.Table) (*desc.Column, error) {
 	seqName := t.DefaultSequenceName()
+	for i := 1; schema.GetByName[*desc.Sequence](e.Catalog.Schema, seqName) != nil; i++ {
+		seqName = fmt.Sprintf("%s%d", t.DefaultSequenceName(), i)
+	}
 	seq := desc.NewSequence(seqName)
-	id, err := catalog.NextDescriptorID(e.Catalog, seq)
-	seq.SID = id
+	id, err := catalog.NextDescriptorID(e.Catalog, e.Batch, seq)
 	if err != nil {
 		return nil, err
 	}
+	seq.SID = id
 
-	err = catalog.Create(e.Catalog, seq)
+	err = catalog.Create(e.Catalog, e.Batch, seq)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,94 @@
+package execution
+
+import (
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/keys"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/desc"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/plan"
+)
+
+func (e *Executor) VisitDropTable(p *plan.DropTable) (Row, error) {
+	if e.State.done || p.Table == nil {
+		return nil, nil
+	}
+	e.State.done = true
+
+	dt := p.Table
+	err := e.deleteRows(dt)
+	if err != nil {
+		return nil, err
+	}
+	if primaryKeyInternal(dt) {
+		seq, err := e.keySequence(dt)
+		if err != nil {
+			return nil, err
+		}
+		err = catalog.Delete(e.Catalog, e.Batch, seq)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = catalog.Delete(e.Catalog, e.Batch, dt)
+	return Row{dt.Name()}, err
+}
+
+func (e *Executor) VisitTruncate(p *plan.Truncate) (Row, error) {
+	if e.State.done {
+		return nil, nil
+	}
+	e.State.done = true
+
+	dt := p.Table
+	err := e.deleteRows(dt)
+	if err != nil {
+		return nil, err
+	}
+	if primaryKeyInternal(dt) {
+		seq, err := e.keySequence(dt)
+		if err != nil {
+			return nil, err
+		}
+		err = catalog.SequenceReset(e.Catalog, e.Batch, seq)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return Row{dt.Name()}, nil
+}
+
+// deleteRows deletes every row in the table's span, along with the
+// indexes of its unique columns. The spans are read through the
+// transaction, so that it conflicts with any transaction which writes
+// a row to the table before it commits.
+func (e *Executor) deleteRows(t *desc.Table) error {
+	err := e.deleteSpan(t.Span())
+	if err != nil {
+		return err
+	}
+	for _, col := range t.Columns {
+		if !col.Unique {
+			continue
+		}
+		if err := e.deleteSpan(t.IndexSpan(col)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Executor) deleteSpan(span *keys.Span) error {
+	cur, err := e.Txn.Scan(span.Start.Encode(), span.End.Encode())
+	if err != nil {
+		return err
+	}
+	defer cur.Close()
+	for !cur.IsAtEnd() {
+		if err := e.Batch.Delete(cur.Key()); err != nil {
+			return err
+		}
+		if _, err := cur.Next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/angles-n-daemons/popsql/pkg/db/kv"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/mvcc"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/plan"
 )
@@ -11,19 +12,31 @@ import (
 type Row []any
 
 type Executor struct {
-	Store   kv.Store
+	Txn     *mvcc.Txn
 	Catalog *catalog.Manager
 	State   *State
+	// Batch collects the statement's writes, which are added to the
+	// transaction together once it has run to completion.
+	Batch *kv.WriteBatch
+	// scope holds the values identifiers in expressions refer to.
+	scope map[string]any
 }
 
 type Result struct {
-	Columns  []string
-	Rows     []Row
+	Columns []string
+	Rows    []Row
+	// Command is the command tag reported to the client, it's empty
+	// for statements run by the executor, which report SELECT.
+	Command  string
 	Duration time.Duration
 	Error    error
 }
 
-func Run(st kv.Store, cat *catalog.Manager, p plan.Plan) (*Result, error) {
+// Run executes the plan within a transaction. Its reads see the
+// transaction's earlier writes, but not its own, which are only
+// added to the transaction once it has run without error. The
+// caller is responsible for committing the transaction.
+func Run(txn *mvcc.Txn, cat *catalog.Manager, p plan.Plan) (*Result, error) {
 	start := time.Now()
 	result := func(cols []string, rows []Row) *Result {
 		return &Result{
@@ -33,14 +46,21 @@ func Run(st kv.Store, cat *catalog.Manager, p plan.Plan) (*Result, error) {
 		}
 	}
 
-	state, err := NewState(st, p)
+	if locksRows(p) {
+		if err := lockRows(txn, cat, p); err != nil {
+			return nil, err
+		}
+	}
+	state, err := NewState(txn, p)
 	if err != nil {
 		return nil, err
 	}
+	defer state.Close()
 	ex := &Executor{
-		Store:   st,
+		Txn:     txn,
 		Catalog: cat,
 		State:   state,
+		Batch:   kv.NewWriteBatch(),
 	}
 
 	columns := p.Columns()
@@ -55,9 +75,62 @@ func Run(st kv.Store, cat *catalog.Manager, p plan.Plan) (*Result, error) {
 		}
 		rows = append(rows, row)
 	}
+	err = txn.Write(ex.Batch)
+	if err != nil {
+		return nil, err
+	}
 	return result(columns, rows), nil
 }
 
+// locksRows returns whether the plan locks the rows it reads.
+func locksRows(p plan.Plan) bool {
+	for {
+		switch n := p.(type) {
+		case *plan.Lock:
+			return true
+		case *plan.Project:
+			p = n.Source
+		case *plan.Filter:
+			p = n.Source
+		default:
+			return false
+		}
+	}
+}
+
+// lockRows runs the plan over the latest commit, rather than the
+// transaction's snapshot, since those are the rows another transaction
+// could be changing, so that its Lock nodes lock the rows which pass
+// its filters. Once they're locked, the transaction is refreshed, so
+// that when the plan is run again it reads them as they were left by
+// whoever held them last. A row which only passes the filters then is
+// locked as it's read.
+func lockRows(txn *mvcc.Txn, cat *catalog.Manager, p plan.Plan) error {
+	// the latest commit is read around the transaction, so that the
+	// rows read aren't validated against when it commits.
+	state, err := newState(txn.Store(), p)
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+	ex := &Executor{
+		Txn:     txn,
+		Catalog: cat,
+		State:   state,
+		Batch:   kv.NewWriteBatch(),
+	}
+	for {
+		row, err := Next(ex, p)
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			break
+		}
+	}
+	return txn.Refresh()
+}
+
 // Next executes the plan until the next resulting row is produced.
 // It can be called on any plan node, and is used for recursively
 // traversing the plan tree.
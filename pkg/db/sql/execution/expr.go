@@ -7,13 +7,21 @@ import (
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/parser/scanner"
 )
 
-// The executor also acts as visitor for expressions.
-// I need to figure out scoping here, but that's for another day.
+// The executor also acts as visitor for expressions. Identifiers
+// refer to the values in the executor's scope, by column name.
 
 func Eval(e *Executor, expr ast.Expr) (any, error) {
 	return ast.VisitExpr(expr, e)
 }
 
+// evalIn evaluates the expression with the given values in scope.
+func (e *Executor) evalIn(scope map[string]any, expr ast.Expr) (any, error) {
+	prev := e.scope
+	e.scope = scope
+	defer func() { e.scope = prev }()
+	return Eval(e, expr)
+}
+
 func (e *Executor) VisitBinaryExpr(expr *ast.Binary) (any, error) {
 	lhs, err := Eval(e, expr.Left)
 	if err != nil {
@@ -27,6 +35,13 @@ func (e *Executor) VisitBinaryExpr(expr *ast.Binary) (any, error) {
 }
 
 func evalBinaryExpr(op *scanner.Token, left, right any) (any, error) {
+	if op.Type == scanner.AND || op.Type == scanner.OR {
+		return logic(op, left, right)
+	}
+	// any other operation on a null value gives null.
+	if left == nil || right == nil {
+		return nil, nil
+	}
 	switch op.Type {
 	case scanner.PLUS:
 		switch left.(type) {
@@ -100,6 +115,27 @@ func equality(op *scanner.Token, left, right any) (any, error) {
 	return nil, fmt.Errorf("unsupported equality operator: %s", op)
 }
 
+// logic combines two booleans with AND or OR, using three-valued
+// logic where null is an unknown value. The result is only null when
+// the unknown value could change it.
+func logic(op *scanner.Token, left, right any) (any, error) {
+	a, aok := left.(bool)
+	b, bok := right.(bool)
+	if (!aok && left != nil) || (!bok && right != nil) {
+		return nil, fmt.Errorf("cannot do logic on values of type %T and %T", left, right)
+	}
+	// decisive is the value which decides the result by itself, true
+	// for OR and false for AND.
+	decisive := op.Type == scanner.OR
+	if (aok && a == decisive) || (bok && b == decisive) {
+		return decisive, nil
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	return !decisive, nil
+}
+
 func (e *Executor) VisitLiteralExpr(expr *ast.Literal) (any, error) {
 	return expr.Value.Literal, nil
 }
@@ -108,9 +144,12 @@ func (e *Executor) VisitUnaryExpr(expr *ast.Unary) (any, error) {
 	if err != nil {
 		return nil, err
 	}
+	if right == nil {
+		return nil, nil
+	}
 
 	switch expr.Operator.Type {
-	case scanner.BANG:
+	case scanner.BANG, scanner.NOT:
 		if boolVal, ok := right.(bool); ok {
 			return !boolVal, nil
 		}
@@ -122,8 +161,15 @@ func (e *Executor) VisitUnaryExpr(expr *ast.Unary) (any, error) {
 	}
 	return nil, fmt.Errorf("cannot perform operaion %s on value of type %T", expr.Operator.Type, right)
 }
-func (e *Executor) VisitIdentifierExpr(*ast.Identifier) (any, error) {
-	return nil, fmt.Errorf("not implemented")
+func (e *Executor) VisitIdentifierExpr(expr *ast.Identifier) (any, error) {
+	v, ok := e.scope[expr.Name.Lexeme]
+	if !ok {
+		return nil, fmt.Errorf("column '%s' does not exist", expr.Name.Lexeme)
+	}
+	return v, nil
+}
+func (e *Executor) VisitAliasExpr(expr *ast.Alias) (any, error) {
+	return Eval(e, expr.Expr)
 }
 func (e *Executor) VisitColumnSpecExpr(spec *ast.ColumnSpec) (any, error) {
 	return nil, fmt.Errorf("the executor should not see a column spec: name '%s', type '%s'", spec.Name.Name.Lexeme, spec.DataType.Lexeme)
@@ -1,11 +1,11 @@
 package execution
 
 import (
-	"encoding/json"
 	"fmt"
-	"strconv"
+	"strings"
 
 	"github.com/angles-n-daemons/popsql/pkg/db/kv/keys"
+	"github.com/angles-n-daemons/popsql/pkg/db/pgerror"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/desc"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/schema"
@@ -25,21 +25,39 @@ func (e *Executor) VisitInsert(p *plan.Insert) (Row, error) {
 	data := map[string]any{}
 	for i, val := range tup {
 		data[p.Cols[i].Name] = val
-
+	}
+	for _, col := range p.Table.Columns {
+		if _, ok := data[col.Name]; !ok && col.Default != nil {
+			data[col.Name] = col.Default
+		}
+	}
+	err = e.State.constraints.check(e, data)
+	if err != nil {
+		return nil, err
 	}
 
 	key, err := e.getAndValidateKey(p.Table, data, tup)
 	if err != nil {
 		return nil, err
 	}
+	err = e.checkUnique(p.Table, key, data)
+	if err != nil {
+		return nil, err
+	}
+	err = e.State.constraints.index(e, key, data)
+	if err != nil {
+		return nil, err
+	}
 
-	b, err := json.Marshal(data)
+	b, err := encodeRow(p.Table, data)
+	if err != nil {
+		return nil, err
+	}
+	err = e.Batch.Put(key.Encode(), b)
 	if err != nil {
 		return nil, err
 	}
-	keyStr := key.Encode()
-	e.Store.Put(keyStr, b)
-	return Row{keyStr}, nil
+	return Row{key.String()}, nil
 }
 
 // getAndValidate key has a few responsibilities, ultimately
@@ -49,7 +67,10 @@ func (e *Executor) VisitInsert(p *plan.Insert) (Row, error) {
 //
 // 1. If the primary key for this table is ineternal, create it.
 // 2. If the primary key fully exists within the data map, return it.
-// 3. Otherwise, return an error.
+// 3. Otherwise, return a not-null violation.
+//
+// The key's values are encoded so that rows sort in the order of
+// their primary key values, see keys.AppendValue.
 func (e *Executor) getAndValidateKey(
 	t *desc.Table, data map[string]any, tup Row,
 ) (*keys.Key, error) {
@@ -61,20 +82,47 @@ func (e *Executor) getAndValidateKey(
 		}
 		// add the internal column to the data map
 		data[desc.ReservedInternalColumnName] = id
-
-		sid := strconv.FormatUint(id, 10)
-		key = key.WithID(sid)
-		return key, nil
+		return key.WithValues(id)
 	}
 
-	for _, col := range t.PrimaryKey {
+	vals := make([]any, len(t.PrimaryKey))
+	for i, col := range t.PrimaryKey {
 		v, ok := data[col]
-		if !ok {
-			return nil, fmt.Errorf("key column '%s' missing on insert of row '%v'", col, tup)
+		if !ok || v == nil {
+			return nil, pgerror.New(pgerror.NotNullViolation, fmt.Errorf(
+				"key column '%s' missing on insert of row '%v'", col, tup,
+			))
+		}
+		vals[i] = v
+	}
+	return key.WithValues(vals...)
+}
+
+// checkUnique returns an error if a row with the key already exists,
+// either in the table or earlier in the statement, rather than let
+// the insert overwrite it.
+func (e *Executor) checkUnique(t *desc.Table, key *keys.Key, data map[string]any) error {
+	k := key.Encode()
+	_, inserted := e.State.inserted[k]
+	if !inserted {
+		existing, err := e.Txn.Get(k)
+		if err != nil {
+			return err
 		}
-		key = key.WithIDAddition(fmt.Sprintf("%v", v))
+		inserted = existing != nil
 	}
-	return key, nil
+	if inserted {
+		vals := make([]string, len(t.PrimaryKey))
+		for i, col := range t.PrimaryKey {
+			vals[i] = fmt.Sprint(data[col])
+		}
+		return pgerror.New(pgerror.UniqueViolation, fmt.Errorf(
+			"duplicate key value violates unique constraint \"%s_pkey\": key (%s)=(%s) already exists",
+			t.Name(), strings.Join(t.PrimaryKey, ", "), strings.Join(vals, ", "),
+		))
+	}
+	e.State.inserted[k] = struct{}{}
+	return nil
 }
 
 func primaryKeyInternal(t *desc.Table) bool {
@@ -82,10 +130,19 @@ func primaryKeyInternal(t *desc.Table) bool {
 }
 
 func (e *Executor) tableSequenceNext(t *desc.Table) (uint64, error) {
-	seq := schema.GetByName[*desc.Sequence](e.Catalog.Schema, t.DefaultSequenceName())
-	if seq == nil {
-		return 0, fmt.Errorf("could not find key column for table %s", t.Name())
+	seq, err := e.keySequence(t)
+	if err != nil {
+		return 0, err
 	}
+	return catalog.SequenceNext(e.Catalog, e.Batch, seq)
+}
 
-	return catalog.SequenceNext(e.Catalog, seq)
+// keySequence returns the sequence a table's internal key is drawn
+// from.
+func (e *Executor) keySequence(t *desc.Table) (*desc.Sequence, error) {
+	seq := schema.GetByName[*desc.Sequence](e.Catalog.Schema, t.KeySequenceName())
+	if seq == nil {
+		return nil, fmt.Errorf("could not find key column for table %s", t.Name())
+	}
+	return seq, nil
 }
@@ -0,0 +1,30 @@
+package execution
+
+import "github.com/angles-n-daemons/popsql/pkg/db/sql/plan"
+
+// VisitProject evaluates the projected expressions over the next row
+// of its source.
+func (e *Executor) VisitProject(p *plan.Project) (Row, error) {
+	row, err := Next(e, p.Source)
+	if err != nil || row == nil {
+		return nil, err
+	}
+	scope := rowScope(p.Source.Columns(), row)
+	out := make(Row, len(p.Exprs))
+	for i, expr := range p.Exprs {
+		out[i], err = e.evalIn(scope, expr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// rowScope puts a row's values in scope under the names of its columns.
+func rowScope(cols []string, row Row) map[string]any {
+	scope := make(map[string]any, len(cols))
+	for i, col := range cols {
+		scope[col] = row[i]
+	}
+	return scope
+}
@@ -0,0 +1,67 @@
+package execution
+
+import (
+	"encoding/json"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/desc"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/rowenc"
+)
+
+// encodeRow encodes the values of every column of the table, taken
+// from data by column name, under the columns' IDs. Columns missing
+// from data are null.
+func encodeRow(t *desc.Table, data map[string]any) ([]byte, error) {
+	ids := columnIDs(t.Columns)
+	vals := make([]any, len(t.Columns))
+	for i, col := range t.Columns {
+		vals[i] = data[col.Name]
+	}
+	return rowenc.Encode(ids, vals)
+}
+
+func columnIDs(cols []*desc.Column) []uint32 {
+	ids := make([]uint32, len(cols))
+	for i, col := range cols {
+		ids[i] = col.ID
+	}
+	return ids
+}
+
+// rowDecoder decodes the values of a set of a table's columns from
+// its stored rows. Rows written before a column was added to the
+// table don't have it, and read its default instead.
+type rowDecoder struct {
+	cols     []*desc.Column
+	ids      []uint32
+	defaults []any
+}
+
+func newRowDecoder(cols []*desc.Column) *rowDecoder {
+	defaults := make([]any, len(cols))
+	for i, col := range cols {
+		defaults[i] = col.Default
+	}
+	return &rowDecoder{cols: cols, ids: columnIDs(cols), defaults: defaults}
+}
+
+// decode decodes a stored row, which may be in the old JSON format.
+// JSON rows are keyed by column name rather than ID, so they're read
+// in terms of the names the columns have now.
+func (d *rowDecoder) decode(b []byte) (Row, error) {
+	if rowenc.IsJSON(b) {
+		rowMap := map[string]any{}
+		if err := json.Unmarshal(b, &rowMap); err != nil {
+			return nil, err
+		}
+		row := make(Row, len(d.cols))
+		for i, col := range d.cols {
+			v, ok := rowMap[col.Name]
+			if !ok {
+				v = col.Default
+			}
+			row[i] = v
+		}
+		return row, nil
+	}
+	return rowenc.Decode(b, d.ids, d.defaults)
+}
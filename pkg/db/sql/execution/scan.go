@@ -1,13 +1,16 @@
 package execution
 
 import (
-	"encoding/json"
+	"fmt"
 
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/keys"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/lock"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/plan"
 )
 
 func (e *Executor) VisitScan(p *plan.Scan) (Row, error) {
 	cur := e.State.cursors[p.ID]
+	e.State.rowKeys[p.ID] = cur.Key()
 	rowBytes, err := cur.Next()
 	if err != nil {
 		return nil, err
@@ -16,17 +19,45 @@ func (e *Executor) VisitScan(p *plan.Scan) (Row, error) {
 		return nil, nil
 	}
 
-	rowMap := map[string]any{}
-	err = json.Unmarshal(rowBytes, &rowMap)
+	return e.State.decoders[p.ID].decode(rowBytes)
+}
+
+// VisitFilter returns the next row of its source which satisfies the
+// predicate, whose identifiers refer to the row's columns.
+func (e *Executor) VisitFilter(p *plan.Filter) (Row, error) {
+	cols := p.Source.Columns()
+	for {
+		row, err := Next(e, p.Source)
+		if err != nil || row == nil {
+			return nil, err
+		}
+		v, err := e.evalIn(rowScope(cols, row), p.Predicate)
+		if err != nil {
+			return nil, err
+		}
+		switch v {
+		case true:
+			return row, nil
+		case false, nil:
+		default:
+			return nil, fmt.Errorf("argument of WHERE must be a boolean, got %T", v)
+		}
+	}
+}
+
+// VisitLock locks each row of its source, finding its key from the
+// scan which read it.
+func (e *Executor) VisitLock(p *plan.Lock) (Row, error) {
+	row, err := Next(e, p.Source)
+	if err != nil || row == nil {
+		return nil, err
+	}
+	key, err := keys.Decode(e.State.rowKeys[p.Scan.ID])
 	if err != nil {
 		return nil, err
 	}
-
-	row := Row{}
-	for _, col := range p.Table.GetColumns() {
-		// condition for missing value?
-		row = append(row, rowMap[col.Name])
+	if err := e.Txn.Lock(key, lock.Exclusive); err != nil {
+		return nil, err
 	}
-
 	return row, nil
 }
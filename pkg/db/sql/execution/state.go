@@ -2,53 +2,111 @@ package execution
 
 import (
 	"github.com/angles-n-daemons/popsql/pkg/db/kv"
+	"github.com/angles-n-daemons/popsql/pkg/db/kv/mvcc"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/plan"
 )
 
 // NewState creates a new cursor struct and walks the plan
 // tree, opening cursors and creating offsets for inlined values.
-func NewState(st kv.Store, p plan.Plan) (*State, error) {
+func NewState(txn *mvcc.Txn, p plan.Plan) (*State, error) {
+	return newState(txn, p)
+}
+
+// newState creates a State whose scans read from r, which is the
+// transaction itself unless the rows are to be read some other way.
+func newState(r kv.Reader, p plan.Plan) (*State, error) {
 	c := &State{
-		store:       st,
+		reader:      r,
 		cursors:     make(map[string]kv.Cursor),
+		decoders:    make(map[string]*rowDecoder),
+		rowKeys:     make(map[string]string),
 		valueOffset: make(map[string]int),
+		inserted:    make(map[string]struct{}),
 	}
 	_, err := plan.VisitPlan(p, c)
 	if err != nil {
+		c.Close()
 		return nil, err
 	}
 	return c, nil
 }
 
+// Close closes the cursors opened for the plan's scans, which may not
+// have been read to their ends.
+func (c *State) Close() {
+	for _, cur := range c.cursors {
+		cur.Close()
+	}
+}
+
 // State is a utility struct which walks a plan, and initializes
 // the cursors which will be used by the scan nodes.
 type State struct {
-	store        kv.Store
-	cursors      map[string]kv.Cursor
-	valueOffset  map[string]int
-	tableCreated bool
+	// reader is what the scans read from.
+	reader   kv.Reader
+	cursors  map[string]kv.Cursor
+	decoders map[string]*rowDecoder
+	// rowKeys holds the key of the row each scan last returned.
+	rowKeys     map[string]string
+	valueOffset map[string]int
+	// inserted holds the keys of the rows inserted by the statement,
+	// which aren't in the transaction until it's finished.
+	inserted map[string]struct{}
+	// constraints checks the rows inserted by the statement.
+	constraints *constraints
+	// done is set once a statement which changes the schema has run,
+	// since they only return the one row.
+	done bool
 }
 
 // While CreateTable cannot have a scan, there's no need to return anything.
 func (c *State) VisitCreateTable(*plan.CreateTable) (any, error) { return nil, nil }
 
-// While Insert cannot have a scan, there's no need to return anything.
-func (c *State) VisitInsert(*plan.Insert) (any, error) { return nil, nil }
+// Nor can AlterTable, DropTable or Truncate.
+func (c *State) VisitAlterTable(*plan.AlterTable) (any, error) { return nil, nil }
+func (c *State) VisitDropTable(*plan.DropTable) (any, error)   { return nil, nil }
+func (c *State) VisitTruncate(*plan.Truncate) (any, error)     { return nil, nil }
+
+// For insert, we set up the checks of the table's constraints.
+func (c *State) VisitInsert(p *plan.Insert) (any, error) {
+	cons, err := newConstraints(p.Table)
+	if err != nil {
+		return nil, err
+	}
+	c.constraints = cons
+	return nil, nil
+}
 
 // For scan, we open a cursor on the specified table (or index),
 // assign it to the scan node, and save the reference in the
 // internal map.
 func (c *State) VisitScan(sc *plan.Scan) (any, error) {
 	span := sc.Table.Span()
-	cursor, err := c.store.Scan(span.Start.Encode(), span.End.Encode())
+	cursor, err := c.reader.Scan(span.Start.Encode(), span.End.Encode())
 	if err != nil {
 		return nil, err
 	}
 
 	c.cursors[sc.ID] = cursor
+	c.decoders[sc.ID] = newRowDecoder(sc.Table.GetColumns())
 	return nil, nil
 }
 
+// For filter, we set up its source.
+func (c *State) VisitFilter(p *plan.Filter) (any, error) {
+	return plan.VisitPlan(p.Source, c)
+}
+
+// For lock, we set up its source.
+func (c *State) VisitLock(p *plan.Lock) (any, error) {
+	return plan.VisitPlan(p.Source, c)
+}
+
+// For project, we set up its source.
+func (c *State) VisitProject(p *plan.Project) (any, error) {
+	return plan.VisitPlan(p.Source, c)
+}
+
 // For values, we initialize an offset to keep track of during
 // execution so that we know which row is being used.
 func (c *State) VisitValues(vals *plan.Values) (any, error) {
@@ -29,6 +29,13 @@ func (t *stmtTreeifier) VisitCreateTableStmt(stmt *CreateTable) (*tree.Node, err
 		for _, col := range stmt.Columns {
 			content = append(content, fmt.Sprintf(" - %s %s", col.Name.Name.Lexeme, col.DataType.Lexeme))
 		}
+		if len(stmt.PrimaryKey) > 0 {
+			keys := []string{}
+			for _, key := range stmt.PrimaryKey {
+				keys = append(keys, key.Name.Lexeme)
+			}
+			content = append(content, " primary key: ("+strings.Join(keys, ", ")+")")
+		}
 	}
 	return tree.NewNode(content), nil
 }
@@ -38,6 +45,9 @@ func (t *stmtTreeifier) VisitSelectStmt(stmt *Select) (*tree.Node, error) {
 	if stmt.From != nil {
 		content[0] += stmt.From.Name.Lexeme
 	}
+	if stmt.ForUpdate {
+		content[0] += " FOR UPDATE"
+	}
 	if t.verbose {
 		terms := " terms: ["
 		termsArr := []string{}
@@ -49,14 +59,14 @@ func (t *stmtTreeifier) VisitSelectStmt(stmt *Select) (*tree.Node, error) {
 			termsArr = append(termsArr, ts)
 		}
 		terms += strings.Join(termsArr, ", ") + "]"
+		content = append(content, terms)
 
 		if stmt.Where != nil {
 			fs, err := VisitExpr(stmt.Where, t.querifier)
 			if err != nil {
 				return nil, err
 			}
-			filters := " filters: " + fs
-			content = append(content, terms, filters)
+			content = append(content, " filters: "+fs)
 		}
 	}
 	return tree.NewNode(content), nil
@@ -94,3 +104,42 @@ func (t *stmtTreeifier) VisitInsertStmt(stmt *Insert) (*tree.Node, error) {
 	}
 	return tree.NewNode(content), nil
 }
+
+func (t *stmtTreeifier) VisitTransactionStmt(stmt *Transaction) (*tree.Node, error) {
+	return tree.NewNode([]string{stmt.Command.Lexeme}), nil
+}
+
+func (t *stmtTreeifier) VisitAddColumnStmt(stmt *AddColumn) (*tree.Node, error) {
+	col, err := VisitExpr(stmt.Column, t.querifier)
+	if err != nil {
+		return nil, err
+	}
+	return tree.NewNode([]string{"ALTER TABLE: " + stmt.Table.Name.Lexeme, " add: " + col}), nil
+}
+
+func (t *stmtTreeifier) VisitDropColumnStmt(stmt *DropColumn) (*tree.Node, error) {
+	return tree.NewNode([]string{"ALTER TABLE: " + stmt.Table.Name.Lexeme, " drop: " + stmt.Column.Name.Lexeme}), nil
+}
+
+func (t *stmtTreeifier) VisitRenameColumnStmt(stmt *RenameColumn) (*tree.Node, error) {
+	return tree.NewNode([]string{
+		"ALTER TABLE: " + stmt.Table.Name.Lexeme,
+		" rename: " + stmt.Column.Name.Lexeme + " to " + stmt.NewName.Name.Lexeme,
+	}), nil
+}
+
+func (t *stmtTreeifier) VisitRenameTableStmt(stmt *RenameTable) (*tree.Node, error) {
+	return tree.NewNode([]string{"ALTER TABLE: " + stmt.Table.Name.Lexeme, " rename to: " + stmt.NewName.Name.Lexeme}), nil
+}
+
+func (t *stmtTreeifier) VisitDropTableStmt(stmt *DropTable) (*tree.Node, error) {
+	content := "DROP TABLE: " + stmt.Table.Name.Lexeme
+	if stmt.IfExists {
+		content += " IF EXISTS"
+	}
+	return tree.NewNode([]string{content}), nil
+}
+
+func (t *stmtTreeifier) VisitTruncateStmt(stmt *Truncate) (*tree.Node, error) {
+	return tree.NewNode([]string{"TRUNCATE: " + stmt.Table.Name.Lexeme}), nil
+}
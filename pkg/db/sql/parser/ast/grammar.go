@@ -20,6 +20,7 @@ type ExprVisitor[T any] interface {
 	VisitLiteralExpr(*Literal) (T, error)
 	VisitUnaryExpr(*Unary) (T, error)
 	VisitColumnSpecExpr(*ColumnSpec) (T, error)
+	VisitAliasExpr(*Alias) (T, error)
 }
 
 func VisitExpr[T any](expr Expr, visitor ExprVisitor[T]) (T, error) {
@@ -34,6 +35,8 @@ func VisitExpr[T any](expr Expr, visitor ExprVisitor[T]) (T, error) {
 		return visitor.VisitUnaryExpr(typedExpr)
 	case *ColumnSpec:
 		return visitor.VisitColumnSpecExpr(typedExpr)
+	case *Alias:
+		return visitor.VisitAliasExpr(typedExpr)
 	default:
 		return *new(T), fmt.Errorf("unable to visit type %T", typedExpr)
 	}
@@ -67,16 +70,35 @@ type Unary struct {
 func (t *Unary) isExpr() {}
 
 type ColumnSpec struct {
-	Name     *Identifier
-	DataType *scanner.Token
+	Name       *Identifier
+	DataType   *scanner.Token
+	Default    Expr
+	PrimaryKey bool
+	NotNull    bool
+	Unique     bool
+	Check      Expr
 }
 
 func (t *ColumnSpec) isExpr() {}
 
+type Alias struct {
+	Expr Expr
+	Name *Identifier
+}
+
+func (t *Alias) isExpr() {}
+
 type StmtVisitor[T any] interface {
 	VisitSelectStmt(*Select) (T, error)
 	VisitInsertStmt(*Insert) (T, error)
 	VisitCreateTableStmt(*CreateTable) (T, error)
+	VisitTransactionStmt(*Transaction) (T, error)
+	VisitAddColumnStmt(*AddColumn) (T, error)
+	VisitDropColumnStmt(*DropColumn) (T, error)
+	VisitRenameColumnStmt(*RenameColumn) (T, error)
+	VisitRenameTableStmt(*RenameTable) (T, error)
+	VisitDropTableStmt(*DropTable) (T, error)
+	VisitTruncateStmt(*Truncate) (T, error)
 }
 
 func VisitStmt[T any](expr Stmt, visitor StmtVisitor[T]) (T, error) {
@@ -87,15 +109,30 @@ func VisitStmt[T any](expr Stmt, visitor StmtVisitor[T]) (T, error) {
 		return visitor.VisitInsertStmt(typedStmt)
 	case *CreateTable:
 		return visitor.VisitCreateTableStmt(typedStmt)
+	case *Transaction:
+		return visitor.VisitTransactionStmt(typedStmt)
+	case *AddColumn:
+		return visitor.VisitAddColumnStmt(typedStmt)
+	case *DropColumn:
+		return visitor.VisitDropColumnStmt(typedStmt)
+	case *RenameColumn:
+		return visitor.VisitRenameColumnStmt(typedStmt)
+	case *RenameTable:
+		return visitor.VisitRenameTableStmt(typedStmt)
+	case *DropTable:
+		return visitor.VisitDropTableStmt(typedStmt)
+	case *Truncate:
+		return visitor.VisitTruncateStmt(typedStmt)
 	default:
 		return *new(T), fmt.Errorf("unable to visit type %T", typedStmt)
 	}
 }
 
 type Select struct {
-	Terms []*Identifier
-	From  *Identifier
-	Where Expr
+	Terms     []Expr
+	From      *Identifier
+	Where     Expr
+	ForUpdate bool
 }
 
 func (t *Select) isStmt() {}
@@ -109,12 +146,61 @@ type Insert struct {
 func (t *Insert) isStmt() {}
 
 type CreateTable struct {
-	Name    *Identifier
-	Columns []*ColumnSpec
+	Name       *Identifier
+	Columns    []*ColumnSpec
+	PrimaryKey []*Identifier
 }
 
 func (t *CreateTable) isStmt() {}
 
+type Transaction struct {
+	Command *scanner.Token
+}
+
+func (t *Transaction) isStmt() {}
+
+type AddColumn struct {
+	Table  *Identifier
+	Column *ColumnSpec
+}
+
+func (t *AddColumn) isStmt() {}
+
+type DropColumn struct {
+	Table  *Identifier
+	Column *Identifier
+}
+
+func (t *DropColumn) isStmt() {}
+
+type RenameColumn struct {
+	Table   *Identifier
+	Column  *Identifier
+	NewName *Identifier
+}
+
+func (t *RenameColumn) isStmt() {}
+
+type RenameTable struct {
+	Table   *Identifier
+	NewName *Identifier
+}
+
+func (t *RenameTable) isStmt() {}
+
+type DropTable struct {
+	Table    *Identifier
+	IfExists bool
+}
+
+func (t *DropTable) isStmt() {}
+
+type Truncate struct {
+	Table *Identifier
+}
+
+func (t *Truncate) isStmt() {}
+
 type Stmt interface {
 	isStmt()
 }
@@ -2,7 +2,10 @@ package ast
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/parser/scanner"
 )
 
 // queryify.go is a utility package for turning AST trees back
@@ -24,6 +27,12 @@ func GenQuery(stmt Stmt) (string, error) {
 	return VisitStmt(stmt, stmtQuerifier)
 }
 
+// GenExpr turns an expression back into SQL, which parses back into
+// the same expression.
+func GenExpr(expr Expr) (string, error) {
+	return exprQuerifier.toQuery(expr)
+}
+
 func (p *StmtQuerifier) toQuery(stmt Stmt) {
 	VisitStmt(stmt, p)
 }
@@ -41,6 +50,13 @@ func (p *StmtQuerifier) VisitCreateTableStmt(stmt *CreateTable) (string, error)
 		}
 		colStrings = append(colStrings, withIndent(p.depth+1)+colStr)
 	}
+	if len(stmt.PrimaryKey) > 0 {
+		keys := []string{}
+		for _, key := range stmt.PrimaryKey {
+			keys = append(keys, key.Name.Lexeme)
+		}
+		colStrings = append(colStrings, withIndent(p.depth+1)+"PRIMARY KEY ("+strings.Join(keys, ", ")+")")
+	}
 	w(strings.Join(colStrings, ",\n"))
 	w(withIndent(p.depth) + ")")
 	s := sb.String()
@@ -68,13 +84,17 @@ func (p *StmtQuerifier) VisitSelectStmt(stmt *Select) (string, error) {
 	}
 
 	if stmt.Where != nil {
-		w(withIndent(p.depth) + " FROM ")
+		w(withIndent(p.depth) + " WHERE ")
 		whereStr, err := exprQuerifier.toQuery(stmt.Where)
 		if err != nil {
 			return "", err
 		}
 		w(whereStr + "\n")
 	}
+
+	if stmt.ForUpdate {
+		w(withIndent(p.depth) + "  FOR UPDATE\n")
+	}
 	s := sb.String()
 	return s, nil
 }
@@ -108,6 +128,43 @@ func (p *StmtQuerifier) VisitInsertStmt(stmt *Insert) (string, error) {
 	return s, nil
 }
 
+func (p *StmtQuerifier) VisitTransactionStmt(stmt *Transaction) (string, error) {
+	return withIndent(p.depth) + stmt.Command.Lexeme, nil
+}
+
+func (p *StmtQuerifier) VisitAddColumnStmt(stmt *AddColumn) (string, error) {
+	colStr, err := exprQuerifier.toQuery(stmt.Column)
+	if err != nil {
+		return "", err
+	}
+	return withIndent(p.depth) + "ALTER TABLE " + stmt.Table.Name.Lexeme + " ADD COLUMN " + colStr, nil
+}
+
+func (p *StmtQuerifier) VisitDropColumnStmt(stmt *DropColumn) (string, error) {
+	return withIndent(p.depth) + "ALTER TABLE " + stmt.Table.Name.Lexeme + " DROP COLUMN " + stmt.Column.Name.Lexeme, nil
+}
+
+func (p *StmtQuerifier) VisitRenameColumnStmt(stmt *RenameColumn) (string, error) {
+	return withIndent(p.depth) + "ALTER TABLE " + stmt.Table.Name.Lexeme +
+		" RENAME COLUMN " + stmt.Column.Name.Lexeme + " TO " + stmt.NewName.Name.Lexeme, nil
+}
+
+func (p *StmtQuerifier) VisitRenameTableStmt(stmt *RenameTable) (string, error) {
+	return withIndent(p.depth) + "ALTER TABLE " + stmt.Table.Name.Lexeme + " RENAME TO " + stmt.NewName.Name.Lexeme, nil
+}
+
+func (p *StmtQuerifier) VisitDropTableStmt(stmt *DropTable) (string, error) {
+	s := withIndent(p.depth) + "DROP TABLE "
+	if stmt.IfExists {
+		s += "IF EXISTS "
+	}
+	return s + stmt.Table.Name.Lexeme, nil
+}
+
+func (p *StmtQuerifier) VisitTruncateStmt(stmt *Truncate) (string, error) {
+	return withIndent(p.depth) + "TRUNCATE " + stmt.Table.Name.Lexeme, nil
+}
+
 type ExprQuerifier struct {
 	depth int
 }
@@ -120,13 +177,41 @@ func (p *ExprQuerifier) VisitIdentifierExpr(expr *Identifier) (string, error) {
 	return expr.Name.Lexeme, nil
 }
 
+func (p *ExprQuerifier) VisitAliasExpr(expr *Alias) (string, error) {
+	s, err := p.toQuery(expr.Expr)
+	if err != nil {
+		return "", err
+	}
+	return s + " AS " + expr.Name.Name.Lexeme, nil
+}
+
+// operand turns the operand of an operator into SQL, wrapping it in
+// parentheses if it's an operation itself, so that it doesn't depend
+// on precedence to parse back the same.
+func (p *ExprQuerifier) operand(expr Expr) (string, error) {
+	s, err := p.toQuery(expr)
+	if err != nil {
+		return "", err
+	}
+	switch e := expr.(type) {
+	case *Binary:
+		s = "(" + s + ")"
+	case *Unary:
+		// NOT binds more loosely than the other operators.
+		if e.Operator.Type == scanner.NOT {
+			s = "(" + s + ")"
+		}
+	}
+	return s, nil
+}
+
 func (p *ExprQuerifier) VisitBinaryExpr(expr *Binary) (string, error) {
-	left, err := p.toQuery(expr.Left)
+	left, err := p.operand(expr.Left)
 	if err != nil {
 		return "", err
 	}
 
-	right, err := p.toQuery(expr.Right)
+	right, err := p.operand(expr.Right)
 	if err != nil {
 		return "", err
 	}
@@ -138,7 +223,11 @@ func (p *ExprQuerifier) VisitBinaryExpr(expr *Binary) (string, error) {
 func (p *ExprQuerifier) VisitLiteralExpr(expr *Literal) (string, error) {
 	var s string
 	switch v := expr.Value.Literal.(type) {
-	case float64, bool:
+	case nil:
+		s = "NULL"
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
 		s = fmt.Sprintf(`%v`, v)
 	case string:
 		s = fmt.Sprintf(`"%s"`, v)
@@ -149,15 +238,41 @@ func (p *ExprQuerifier) VisitLiteralExpr(expr *Literal) (string, error) {
 }
 
 func (p *ExprQuerifier) VisitUnaryExpr(expr *Unary) (string, error) {
-	valueStr, err := p.toQuery(expr.Right)
+	valueStr, err := p.operand(expr.Right)
 	if err != nil {
 		return "", err
 	}
+	if expr.Operator.Type == scanner.NOT {
+		return "NOT " + valueStr, nil
+	}
 	s := expr.Operator.Lexeme + valueStr
 	return s, nil
 }
 
 func (p *ExprQuerifier) VisitColumnSpecExpr(expr *ColumnSpec) (string, error) {
 	s := expr.Name.Name.Lexeme + " " + expr.DataType.Lexeme
+	if expr.Default != nil {
+		def, err := p.toQuery(expr.Default)
+		if err != nil {
+			return "", err
+		}
+		s += " DEFAULT " + def
+	}
+	if expr.PrimaryKey {
+		s += " PRIMARY KEY"
+	}
+	if expr.NotNull {
+		s += " NOT NULL"
+	}
+	if expr.Unique {
+		s += " UNIQUE"
+	}
+	if expr.Check != nil {
+		check, err := p.toQuery(expr.Check)
+		if err != nil {
+			return "", err
+		}
+		s += " CHECK (" + check + ")"
+	}
 	return s, nil
 }
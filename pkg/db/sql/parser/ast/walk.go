@@ -0,0 +1,29 @@
+package ast
+
+// Walk calls fn on expr and every expression beneath it, parents
+// before their children, stopping at the first error.
+func Walk(expr Expr, fn walkFunc) error {
+	if expr == nil {
+		return nil
+	}
+	if err := fn(expr); err != nil {
+		return err
+	}
+	switch e := expr.(type) {
+	case *Binary:
+		if err := Walk(e.Left, fn); err != nil {
+			return err
+		}
+		return Walk(e.Right, fn)
+	case *Unary:
+		return Walk(e.Right, fn)
+	case *Alias:
+		return Walk(e.Expr, fn)
+	case *ColumnSpec:
+		if err := Walk(e.Default, fn); err != nil {
+			return err
+		}
+		return Walk(e.Check, fn)
+	}
+	return nil
+}
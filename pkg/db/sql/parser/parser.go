@@ -38,6 +38,23 @@ func Parse(s string) (ast.Stmt, error) {
 	return stmt, err
 }
 
+// ParseExpr parses a single expression, such as one saved as the
+// text of a check constraint.
+func ParseExpr(s string) (ast.Expr, error) {
+	tokens, err := scanner.Scan(s)
+	if err != nil {
+		return nil, err
+	}
+	expr, i, err := expression(tokens, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !isAtEnd(tokens, i) {
+		return nil, fmt.Errorf("finished parsing expression without consuming all input")
+	}
+	return expr, nil
+}
+
 type expressionSig func([]*scanner.Token, int) (ast.Expr, int, error)
 
 func statement(tokens []*scanner.Token, i int) (ast.Stmt, int, error) {
@@ -51,6 +68,14 @@ func statement(tokens []*scanner.Token, i int) (ast.Stmt, int, error) {
 		return selectStmt(tokens, i+1)
 	case scanner.INSERT:
 		return insertStmt(tokens, i+1)
+	case scanner.ALTER:
+		return alterStmt(tokens, i+1)
+	case scanner.DROP:
+		return dropStmt(tokens, i+1)
+	case scanner.TRUNCATE:
+		return truncateStmt(tokens, i+1)
+	case scanner.BEGIN, scanner.COMMIT, scanner.ROLLBACK:
+		return &ast.Transaction{Command: tokens[i]}, i + 1, nil
 	default:
 		return nil, i, fmt.Errorf("unexpected token %s looking for statement", tokens[i].Type)
 	}
@@ -67,16 +92,33 @@ func createStmt(tokens []*scanner.Token, i int) (ast.Stmt, int, error) {
 	if !match(tokens, i, scanner.LEFT_PAREN) {
 		return nil, i, fmt.Errorf("expected LEFT_PAREN to follow CREATE TABLE <name>")
 	}
-	columns := []*ast.ColumnSpec{}
+	stmt := &ast.CreateTable{Name: name, Columns: []*ast.ColumnSpec{}}
 	i += 1
-	for match(tokens, i, scanner.IDENTIFIER) {
-		var spec *ast.ColumnSpec
-		var err error
-		spec, i, err = columnSpec(tokens, i)
-		if err != nil {
-			return nil, i, err
+	for match(tokens, i, scanner.IDENTIFIER, scanner.PRIMARY) {
+		if match(tokens, i, scanner.PRIMARY) {
+			if stmt.PrimaryKey != nil {
+				return nil, i, fmt.Errorf("multiple primary keys for table '%s' are not allowed", name.Name.Lexeme)
+			}
+			i, err = assertTypes(tokens, i+1, scanner.KEY, scanner.LEFT_PAREN)
+			if err != nil {
+				return nil, i, err
+			}
+			stmt.PrimaryKey, i, err = identifierList(tokens, i)
+			if err != nil {
+				return nil, i, err
+			}
+			i, err = assertTypes(tokens, i, scanner.RIGHT_PAREN)
+			if err != nil {
+				return nil, i, err
+			}
+		} else {
+			var spec *ast.ColumnSpec
+			spec, i, err = columnSpec(tokens, i)
+			if err != nil {
+				return nil, i, err
+			}
+			stmt.Columns = append(stmt.Columns, spec)
 		}
-		columns = append(columns, spec)
 		if match(tokens, i, scanner.COMMA) {
 			i++
 		} else {
@@ -86,11 +128,100 @@ func createStmt(tokens []*scanner.Token, i int) (ast.Stmt, int, error) {
 	if !match(tokens, i, scanner.RIGHT_PAREN) {
 		return nil, i, fmt.Errorf("expected RIGHT_PAREN to close CREATE TABLE statement")
 	}
-	return &ast.CreateTable{Name: name, Columns: columns}, i + 1, nil
+	return stmt, i + 1, nil
+}
+
+func alterStmt(tokens []*scanner.Token, i int) (ast.Stmt, int, error) {
+	i, err := assertTypes(tokens, i, scanner.TABLE)
+	if err != nil {
+		return nil, i, err
+	}
+	table, i, err := identifier(tokens, i)
+	if err != nil {
+		return nil, i, err
+	}
+	if isAtEnd(tokens, i) {
+		return nil, i, fmt.Errorf("reached end of input looking for ALTER TABLE action")
+	}
+
+	switch tokens[i].Type {
+	case scanner.ADD:
+		i = maybeConsume(tokens, i+1, scanner.COLUMN)
+		var spec *ast.ColumnSpec
+		spec, i, err = columnSpec(tokens, i)
+		if err != nil {
+			return nil, i, err
+		}
+		return &ast.AddColumn{Table: table, Column: spec}, i, nil
+	case scanner.DROP:
+		i = maybeConsume(tokens, i+1, scanner.COLUMN)
+		var column *ast.Identifier
+		column, i, err = identifier(tokens, i)
+		if err != nil {
+			return nil, i, err
+		}
+		return &ast.DropColumn{Table: table, Column: column}, i, nil
+	case scanner.RENAME:
+		i++
+		if match(tokens, i, scanner.TO) {
+			var name *ast.Identifier
+			name, i, err = identifier(tokens, i+1)
+			if err != nil {
+				return nil, i, err
+			}
+			return &ast.RenameTable{Table: table, NewName: name}, i, nil
+		}
+		i = maybeConsume(tokens, i, scanner.COLUMN)
+		var column, name *ast.Identifier
+		column, i, err = identifier(tokens, i)
+		if err != nil {
+			return nil, i, err
+		}
+		i, err = assertTypes(tokens, i, scanner.TO)
+		if err != nil {
+			return nil, i, err
+		}
+		name, i, err = identifier(tokens, i)
+		if err != nil {
+			return nil, i, err
+		}
+		return &ast.RenameColumn{Table: table, Column: column, NewName: name}, i, nil
+	default:
+		return nil, i, fmt.Errorf("unexpected token %s looking for ALTER TABLE action", tokens[i].Type)
+	}
+}
+
+func dropStmt(tokens []*scanner.Token, i int) (ast.Stmt, int, error) {
+	i, err := assertTypes(tokens, i, scanner.TABLE)
+	if err != nil {
+		return nil, i, err
+	}
+	stmt := &ast.DropTable{}
+	if match(tokens, i, scanner.IF) {
+		i, err = assertTypes(tokens, i+1, scanner.EXISTS)
+		if err != nil {
+			return nil, i, err
+		}
+		stmt.IfExists = true
+	}
+	stmt.Table, i, err = identifier(tokens, i)
+	if err != nil {
+		return nil, i, err
+	}
+	return stmt, i, nil
+}
+
+func truncateStmt(tokens []*scanner.Token, i int) (ast.Stmt, int, error) {
+	i = maybeConsume(tokens, i, scanner.TABLE)
+	table, i, err := identifier(tokens, i)
+	if err != nil {
+		return nil, i, err
+	}
+	return &ast.Truncate{Table: table}, i, nil
 }
 
 func selectStmt(tokens []*scanner.Token, i int) (ast.Stmt, int, error) {
-	terms, i, err := identifierList(tokens, i)
+	terms, i, err := selectTerms(tokens, i)
 	if err != nil {
 		return nil, i, err
 	}
@@ -121,7 +252,40 @@ func selectStmt(tokens []*scanner.Token, i int) (ast.Stmt, int, error) {
 
 		stmt.Where = where
 	}
-	return stmt, i + 1, nil
+	if match(tokens, i, scanner.FOR) {
+		i, err = assertTypes(tokens, i+1, scanner.UPDATE)
+		if err != nil {
+			return nil, i, err
+		}
+		stmt.ForUpdate = true
+	}
+	return stmt, i, nil
+}
+
+// selectTerms parses the expressions a select returns, each of which
+// may be given a name with AS.
+func selectTerms(tokens []*scanner.Token, i int) ([]ast.Expr, int, error) {
+	terms := []ast.Expr{}
+	for {
+		term, next, err := expression(tokens, i)
+		if err != nil {
+			return nil, next, err
+		}
+		i = next
+		if match(tokens, i, scanner.AS) {
+			var name *ast.Identifier
+			name, i, err = identifier(tokens, i+1)
+			if err != nil {
+				return nil, i, err
+			}
+			term = &ast.Alias{Expr: term, Name: name}
+		}
+		terms = append(terms, term)
+		if !match(tokens, i, scanner.COMMA) {
+			return terms, i, nil
+		}
+		i++
+	}
 }
 
 func insertStmt(tokens []*scanner.Token, i int) (ast.Stmt, int, error) {
@@ -163,7 +327,10 @@ func insertStmt(tokens []*scanner.Token, i int) (ast.Stmt, int, error) {
 func columnSpec(tokens []*scanner.Token, i int) (*ast.ColumnSpec, int, error) {
 	name, i, err := identifier(tokens, i)
 	if err != nil {
-		return nil, i, nil
+		return nil, i, err
+	}
+	if isAtEnd(tokens, i) {
+		return nil, i, fmt.Errorf("reached end of input looking for data type in column spec")
 	}
 	if !match(tokens, i, scanner.DATATYPE_BOOLEAN, scanner.DATATYPE_STRING, scanner.DATATYPE_NUMBER) {
 		return nil, i, fmt.Errorf("expected data type '%s' in column spec", tokens[i].Lexeme)
@@ -179,7 +346,48 @@ func columnSpec(tokens []*scanner.Token, i int) (*ast.ColumnSpec, int, error) {
 		}
 	}
 
-	return &ast.ColumnSpec{Name: name, DataType: dt}, i, nil
+	spec := &ast.ColumnSpec{Name: name, DataType: dt}
+	// the column's constraints can come in any order.
+	for {
+		switch {
+		case match(tokens, i, scanner.DEFAULT):
+			spec.Default, i, err = expression(tokens, i+1)
+		case match(tokens, i, scanner.PRIMARY):
+			i, err = assertTypes(tokens, i+1, scanner.KEY)
+			spec.PrimaryKey = true
+		case match(tokens, i, scanner.NOT):
+			i, err = assertTypes(tokens, i+1, scanner.NULL)
+			spec.NotNull = true
+		case match(tokens, i, scanner.UNIQUE):
+			i++
+			spec.Unique = true
+		case match(tokens, i, scanner.CHECK):
+			spec.Check, i, err = parenthesized(tokens, i+1)
+		default:
+			return spec, i, nil
+		}
+		if err != nil {
+			return nil, i, err
+		}
+	}
+}
+
+// parenthesized parses an expression which has to be wrapped in
+// parentheses, rather than just may be.
+func parenthesized(tokens []*scanner.Token, i int) (ast.Expr, int, error) {
+	i, err := assertTypes(tokens, i, scanner.LEFT_PAREN)
+	if err != nil {
+		return nil, i, err
+	}
+	expr, i, err := expression(tokens, i)
+	if err != nil {
+		return nil, i, err
+	}
+	i, err = assertTypes(tokens, i, scanner.RIGHT_PAREN)
+	if err != nil {
+		return nil, i, err
+	}
+	return expr, i, nil
 }
 
 func tupleList(tokens []*scanner.Token, i int) ([][]ast.Expr, int, error) {
@@ -257,7 +465,29 @@ func expression(tokens []*scanner.Token, i int) (ast.Expr, int, error) {
 	if isAtEnd(tokens, i) {
 		return nil, i, fmt.Errorf("reached end of input parsing expression")
 	}
-	return equality(tokens, i)
+	return logicOr(tokens, i)
+}
+
+func logicOr(tokens []*scanner.Token, i int) (ast.Expr, int, error) {
+	return binary(tokens, i, logicAnd, scanner.OR)
+}
+
+func logicAnd(tokens []*scanner.Token, i int) (ast.Expr, int, error) {
+	return binary(tokens, i, logicNot, scanner.AND)
+}
+
+// logicNot binds more loosely than the comparisons, so that NOT a > 1
+// negates the comparison.
+func logicNot(tokens []*scanner.Token, i int) (ast.Expr, int, error) {
+	if !match(tokens, i, scanner.NOT) {
+		return equality(tokens, i)
+	}
+	operator := tokens[i]
+	expr, i, err := logicNot(tokens, i+1)
+	if err != nil {
+		return nil, i, err
+	}
+	return &ast.Unary{Operator: operator, Right: expr}, i, nil
 }
 
 func equality(tokens []*scanner.Token, i int) (ast.Expr, int, error) {
@@ -353,7 +583,7 @@ func primary(tokens []*scanner.Token, i int) (ast.Expr, int, error) {
 		return nil, i, fmt.Errorf("reached end of input parsing expression")
 	}
 	switch tokens[i].Type {
-	case scanner.NUMBER, scanner.STRING:
+	case scanner.NUMBER, scanner.STRING, scanner.NULL, scanner.TRUE, scanner.FALSE:
 		return &ast.Literal{Value: tokens[i]}, i + 1, nil
 	case scanner.IDENTIFIER, scanner.STAR:
 		return identifier(tokens, i)
@@ -365,7 +595,7 @@ func primary(tokens []*scanner.Token, i int) (ast.Expr, int, error) {
 		if !match(tokens, i, scanner.RIGHT_PAREN) {
 			return nil, i, fmt.Errorf("expected ')' after expression")
 		}
-		return expr, i, nil
+		return expr, i + 1, nil
 	default:
 		return nil, i, fmt.Errorf("unexpected token %s found while parsing primary", tokens[i].Type)
 	}
@@ -379,7 +609,12 @@ func identifier(tokens []*scanner.Token, i int) (*ast.Identifier, int, error) {
 }
 
 func maybeConsumeSemicolon(tokens []*scanner.Token, i int) int {
-	if match(tokens, i, scanner.SEMICOLON) {
+	return maybeConsume(tokens, i, scanner.SEMICOLON)
+}
+
+// maybeConsume skips over an optional token.
+func maybeConsume(tokens []*scanner.Token, i int, ttype scanner.TokenType) int {
+	if match(tokens, i, ttype) {
 		return i + 1
 	}
 	return i
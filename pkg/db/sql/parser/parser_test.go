@@ -17,6 +17,31 @@ func TestParserBasic(t *testing.T) {
 	ast.Print(stmt)
 }
 
+func TestParseSelectTerms(t *testing.T) {
+	stmt, err := parser.Parse(`SELECT a, b * 2 AS c, * FROM t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sel, ok := stmt.(*ast.Select)
+	if !ok {
+		t.Fatalf("expected a select, got %T", stmt)
+	}
+	terms := []string{}
+	for _, term := range sel.Terms {
+		s, err := ast.GenExpr(term)
+		if err != nil {
+			t.Fatal(err)
+		}
+		terms = append(terms, s)
+	}
+	if got := strings.Join(terms, ", "); got != "a, b * 2 AS c, *" {
+		t.Fatalf("unexpected terms: %s", got)
+	}
+	if alias, ok := sel.Terms[1].(*ast.Alias); !ok || alias.Name.Name.Lexeme != "c" {
+		t.Fatalf("expected the second term to be aliased as c, got %#v", sel.Terms[1])
+	}
+}
+
 // features
 // - insert statements
 // - update statements
@@ -33,6 +58,8 @@ func TestParseValidPrograms(t *testing.T) {
 		`SELECT jane, jane, jeffrey`,
 		`SELECT * FROM users;`,
 		`SELECT x, y FROM thing WHERE x==8`,
+		`SELECT x + 1 AS y, *, z FROM thing WHERE x > 1`,
+		`SELECT 1 + 2 AS three`,
 		`INSERT INTO a VALUES (1, 2)`,
 		`INSERT INTO a (x, y) VALUES (1, 2)`,
 		`INSERT INTO a (x, y) VALUES (1, 2), (3, 4)`,
@@ -41,12 +68,37 @@ func TestParseValidPrograms(t *testing.T) {
 		`CREATE TABLE derp(i string, cal number)`,
 		`INSERT INTO JERP VALUES (1, 2)`,
 		`INSERT INTO JERP (i, cal) VALUES (1, 2)`,
+		`BEGIN`,
+		`commit;`,
+		`ROLLBACK`,
+		`SELECT * FROM users FOR UPDATE`,
+		`select * from users for update;`,
+		`ALTER TABLE a ADD COLUMN b number`,
+		`ALTER TABLE a ADD b string DEFAULT "x"`,
+		`ALTER TABLE a ADD COLUMN b number DEFAULT -1`,
+		`ALTER TABLE a DROP COLUMN b`,
+		`alter table a drop b;`,
+		`ALTER TABLE a RENAME COLUMN b TO c`,
+		`ALTER TABLE a RENAME b TO c`,
+		`ALTER TABLE a RENAME TO b`,
+		`CREATE TABLE derp (cal number DEFAULT 4, i string)`,
+		`CREATE TABLE derp (cal number PRIMARY KEY, i string)`,
+		`CREATE TABLE derp (cal number, i string, PRIMARY KEY (i, cal))`,
+		`CREATE TABLE derp (PRIMARY KEY (i), i string DEFAULT "x")`,
+		`CREATE TABLE derp (cal number DEFAULT 1 PRIMARY KEY)`,
+		`CREATE TABLE derp (cal number NOT NULL UNIQUE, i string CHECK (i != "x"))`,
+		`CREATE TABLE derp (cal number CHECK ((cal + 1) * 2 > 0) DEFAULT 1 NOT NULL)`,
+		`INSERT INTO a VALUES ((1 + 2) * 3, NULL)`,
+		`INSERT INTO a VALUES (true, !false)`,
+		`DROP TABLE derp`,
+		`drop table if exists derp;`,
+		`TRUNCATE derp`,
+		`TRUNCATE TABLE derp`,
 		//`UPDATE a SET x = 4`,
 		//`UPDATE a SET x = 4, y = 5`,
 		//`UPDATE a SET x = 4, y = 5 WHERE z = 10`,
 		//`DELETE FROM a`,
 		//`DELETE FROM a WHERE x=3`,
-		// `DROP TABLE derp`,
 		//`SELECT * FROM (SELECT * FROM b)`
 	} {
 		t.Run(`Parse Valid: `+query, func(t *testing.T) {
@@ -73,6 +125,12 @@ func TestParseInvalidPrograms(t *testing.T) {
 		`SELECT * FROM`,
 		`SELECT * FROM z WHERE`,
 		`SELECT * FROM z SELECT *`,
+		`SELECT a AS`,
+		`SELECT a AS 5 FROM z`,
+		`SELECT a, FROM z`,
+		`SELECT a b FROM z`,
+		`SELECT * FROM z x`,
+		`SELECT * FROM z WHERE x > 1 y`,
 		`SELECT * FROM "`,
 		`SELECT * FROM 5`,
 		`SELECT * WHERE SELECT *`,
@@ -89,7 +147,40 @@ func TestParseInvalidPrograms(t *testing.T) {
 		`INSERT INTO (c.d) a.b VALUES (5)`,
 		`SELECT !`,
 		`SELECT (5 + 4`,
+		`SELECT a AND`,
+		`SELECT NOT`,
+		`SELECT a OR OR b`,
 		`CREATE TABLE x`,
+		`BEGIN SELECT`,
+		`COMMIT ROLLBACK`,
+		`SELECT * FROM z FOR`,
+		`SELECT * FROM z FOR SELECT`,
+		`ALTER a ADD b number`,
+		`ALTER TABLE a`,
+		`ALTER TABLE a ADD COLUMN b`,
+		`ALTER TABLE a ADD COLUMN b number DEFAULT`,
+		`ALTER TABLE a DROP`,
+		`ALTER TABLE a RENAME b`,
+		`ALTER TABLE a RENAME b TO`,
+		`ALTER TABLE a RENAME TO`,
+		`ALTER TABLE a SELECT`,
+		`ALTER TABLE a ADD 5 number`,
+		`CREATE TABLE derp (cal number PRIMARY)`,
+		`CREATE TABLE derp (cal number, PRIMARY KEY)`,
+		`CREATE TABLE derp (cal number, PRIMARY KEY ())`,
+		`CREATE TABLE derp (cal number, PRIMARY KEY (cal)`,
+		`CREATE TABLE derp (cal number, PRIMARY KEY (cal), PRIMARY KEY (cal))`,
+		`CREATE TABLE derp (cal number NOT)`,
+		`CREATE TABLE derp (cal number NOT UNIQUE)`,
+		`CREATE TABLE derp (cal number CHECK cal > 0)`,
+		`CREATE TABLE derp (cal number CHECK (cal > 0)`,
+		`CREATE TABLE derp (cal number CHECK ())`,
+		`DROP derp`,
+		`DROP TABLE`,
+		`DROP TABLE IF derp`,
+		`DROP TABLE IF EXISTS`,
+		`TRUNCATE`,
+		`TRUNCATE TABLE`,
 	} {
 		t.Run(`Parse Invalid: `+query, func(t *testing.T) {
 			_, err := parser.Parse(query)
@@ -100,6 +191,57 @@ func TestParseInvalidPrograms(t *testing.T) {
 	}
 }
 
+func TestParseExprRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		expr     string
+		expected string
+	}{
+		{`a > 0`, `a > 0`},
+		{`(a + 1) * 2 >= b`, `((a + 1) * 2) >= b`},
+		{`a - (b - c)`, `a - (b - c)`},
+		{`-(a + 1)`, `-(a + 1)`},
+		{`a != "x"`, `a != "x"`},
+		{`a == NULL`, `a == NULL`},
+		{`0.25 * 1000000`, `0.25 * 1000000`},
+		{`a > 1 AND NOT b`, `(a > 1) AND (NOT b)`},
+		{`a OR b AND c`, `a OR (b AND c)`},
+		{`(a OR b) AND c`, `(a OR b) AND c`},
+		{`NOT a > 1`, `NOT (a > 1)`},
+		{`(NOT a) == b`, `(NOT a) == b`},
+		{`NOT NOT a`, `NOT (NOT a)`},
+	} {
+		t.Run(test.expr, func(t *testing.T) {
+			parsed, err := parser.ParseExpr(test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s, err := ast.GenExpr(parsed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s != test.expected {
+				t.Fatalf("expected %s, but got %s", test.expected, s)
+			}
+			// and it parses back the same.
+			reparsed, err := parser.ParseExpr(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			again, err := ast.GenExpr(reparsed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s != again {
+				t.Fatalf("expected %s to parse back the same, but got %s", s, again)
+			}
+		})
+	}
+
+	if _, err := parser.ParseExpr(`a > 0 b`); err == nil {
+		t.Fatal("expected trailing input to fail to parse")
+	}
+}
+
 // tests to run
 // - ends with string
 // - ends with number
@@ -22,12 +22,17 @@ func Scan(s string) ([]*Token, error) {
 outside:
 	for !isAtEnd(s, i) {
 		// first check if at reserved keyword or symbol
-		minLen := int(math.Min(float64(i+6), float64(len(s))))
+		minLen := int(math.Min(float64(i+maxKeywordLen), float64(len(s))))
 		upper := strings.ToUpper(s[i:minLen])
 		for j := minLen - i; j >= 1; j-- {
 			word := upper[:j]
+			// a keyword made of letters has to end where the word
+			// does, or "format" would scan as FOR and "mat".
+			if isLetter(word[0]) && i+j < len(s) && isIdentifierChar(s[i+j]) {
+				continue
+			}
 			if ttype, ok := keywordLookup[word]; ok {
-				tokens = append(tokens, simpleToken(ttype, word))
+				tokens = append(tokens, newToken(ttype, word, keywordLiterals[ttype]))
 				i += len(word)
 				continue outside
 			}
@@ -88,6 +93,10 @@ func isLetter(b byte) bool {
 	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
 }
 
+func isIdentifierChar(b byte) bool {
+	return isLetter(b) || isNumeric(b)
+}
+
 func isAtEnd(s string, i int) bool {
 	return len(s) <= i
 }
@@ -133,7 +142,7 @@ loop:
 
 func scanIdentifier(s string, start int) (*Token, error) {
 	i := start + 1
-	for !isAtEnd(s, i) && (isLetter(s[i]) || isNumeric(s[i]) || s[i] == '_') {
+	for !isAtEnd(s, i) && isIdentifierChar(s[i]) {
 		i++
 	}
 	return newToken(IDENTIFIER, s[start:i], s[start:i]), nil
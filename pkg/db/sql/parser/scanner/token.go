@@ -58,6 +58,36 @@ const (
 	NOT
 
 	VALUES
+
+	BEGIN
+	COMMIT
+	ROLLBACK
+
+	FOR
+
+	ALTER
+	ADD
+	DROP
+	RENAME
+	COLUMN
+	TO
+	DEFAULT
+
+	IF
+	EXISTS
+	TRUNCATE
+
+	PRIMARY
+	KEY
+
+	NULL
+	UNIQUE
+	CHECK
+
+	TRUE
+	FALSE
+
+	AS
 )
 
 var keywordLookup = map[string]TokenType{
@@ -100,6 +130,36 @@ var keywordLookup = map[string]TokenType{
 
 	"VALUES": VALUES,
 
+	"BEGIN":    BEGIN,
+	"COMMIT":   COMMIT,
+	"ROLLBACK": ROLLBACK,
+
+	"FOR": FOR,
+
+	"ALTER":   ALTER,
+	"ADD":     ADD,
+	"DROP":    DROP,
+	"RENAME":  RENAME,
+	"COLUMN":  COLUMN,
+	"TO":      TO,
+	"DEFAULT": DEFAULT,
+
+	"IF":       IF,
+	"EXISTS":   EXISTS,
+	"TRUNCATE": TRUNCATE,
+
+	"PRIMARY": PRIMARY,
+	"KEY":     KEY,
+
+	"NULL":   NULL,
+	"UNIQUE": UNIQUE,
+	"CHECK":  CHECK,
+
+	"TRUE":  TRUE,
+	"FALSE": FALSE,
+
+	"AS": AS,
+
 	"NUMBER":  DATATYPE_NUMBER,
 	"NUM":     DATATYPE_NUMBER,
 	"INTEGER": DATATYPE_NUMBER,
@@ -111,6 +171,22 @@ var keywordLookup = map[string]TokenType{
 	"BOOL":    DATATYPE_BOOLEAN,
 }
 
+// keywordLiterals holds the values of the keywords which are literals.
+var keywordLiterals = map[TokenType]any{
+	TRUE:  true,
+	FALSE: false,
+}
+
+// maxKeywordLen is the length of the longest keyword, which is as
+// far as the scanner has to look ahead to match one.
+var maxKeywordLen = func() int {
+	n := 0
+	for word := range keywordLookup {
+		n = max(n, len(word))
+	}
+	return n
+}()
+
 type Token struct {
 	Type    TokenType
 	Lexeme  string
@@ -50,11 +50,33 @@ func _() {
 	_ = x[OR-39]
 	_ = x[NOT-40]
 	_ = x[VALUES-41]
+	_ = x[BEGIN-42]
+	_ = x[COMMIT-43]
+	_ = x[ROLLBACK-44]
+	_ = x[FOR-45]
+	_ = x[ALTER-46]
+	_ = x[ADD-47]
+	_ = x[DROP-48]
+	_ = x[RENAME-49]
+	_ = x[COLUMN-50]
+	_ = x[TO-51]
+	_ = x[DEFAULT-52]
+	_ = x[IF-53]
+	_ = x[EXISTS-54]
+	_ = x[TRUNCATE-55]
+	_ = x[PRIMARY-56]
+	_ = x[KEY-57]
+	_ = x[NULL-58]
+	_ = x[UNIQUE-59]
+	_ = x[CHECK-60]
+	_ = x[TRUE-61]
+	_ = x[FALSE-62]
+	_ = x[AS-63]
 }
 
-const _TokenType_name = "NONECOMMALEFT_PARENRIGHT_PARENDOTMINUSPLUSSTARSLASHSEMICOLONBANGBANG_EQUALEQUALEQUAL_EQUALGREATERGREATER_EQUALLESSLESS_EQUALIDENTIFIERSTRINGNUMBERDATATYPE_BOOLEANDATATYPE_STRINGDATATYPE_NUMBERSELECTINSERTINTOUPDATEDELETECREATETABLEFROMWHEREGROUPOFFSETORDERLIMITSETANDORNOTVALUES"
+const _TokenType_name = "NONECOMMALEFT_PARENRIGHT_PARENDOTMINUSPLUSSTARSLASHSEMICOLONBANGBANG_EQUALEQUALEQUAL_EQUALGREATERGREATER_EQUALLESSLESS_EQUALIDENTIFIERSTRINGNUMBERDATATYPE_BOOLEANDATATYPE_STRINGDATATYPE_NUMBERSELECTINSERTINTOUPDATEDELETECREATETABLEFROMWHEREGROUPOFFSETORDERLIMITSETANDORNOTVALUESBEGINCOMMITROLLBACKFORALTERADDDROPRENAMECOLUMNTODEFAULTIFEXISTSTRUNCATEPRIMARYKEYNULLUNIQUECHECKTRUEFALSEAS"
 
-var _TokenType_index = [...]uint16{0, 4, 9, 19, 30, 33, 38, 42, 46, 51, 60, 64, 74, 79, 90, 97, 110, 114, 124, 134, 140, 146, 162, 177, 192, 198, 204, 208, 214, 220, 226, 231, 235, 240, 245, 251, 256, 261, 264, 267, 269, 272, 278}
+var _TokenType_index = [...]uint16{0, 4, 9, 19, 30, 33, 38, 42, 46, 51, 60, 64, 74, 79, 90, 97, 110, 114, 124, 134, 140, 146, 162, 177, 192, 198, 204, 208, 214, 220, 226, 231, 235, 240, 245, 251, 256, 261, 264, 267, 269, 272, 278, 283, 289, 297, 300, 305, 308, 312, 318, 324, 326, 333, 335, 341, 349, 356, 359, 363, 369, 374, 378, 383, 385}
 
 func (i TokenType) String() string {
 	if i < 0 || i >= TokenType(len(_TokenType_index)-1) {
@@ -1,6 +1,11 @@
 package plan
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/parser/ast"
+)
 
 type PlanDebugger struct {
 	verbose bool
@@ -20,6 +25,24 @@ func (p *PlanDebugger) VisitCreateTable(plan *CreateTable) (string, error) {
 	return "CreateTable: " + plan.Table.Name(), nil
 }
 
+func (p *PlanDebugger) VisitAlterTable(plan *AlterTable) (string, error) {
+	if plan.Altered.Name() != plan.Table.Name() {
+		return "AlterTable: " + plan.Table.Name() + " to " + plan.Altered.Name(), nil
+	}
+	return "AlterTable: " + plan.Table.Name(), nil
+}
+
+func (p *PlanDebugger) VisitDropTable(plan *DropTable) (string, error) {
+	if plan.Table == nil {
+		return "DropTable: nothing to drop", nil
+	}
+	return "DropTable: " + plan.Table.Name(), nil
+}
+
+func (p *PlanDebugger) VisitTruncate(plan *Truncate) (string, error) {
+	return "Truncate: " + plan.Table.Name(), nil
+}
+
 func (p *PlanDebugger) VisitInsert(plan *Insert) (string, error) {
 	return "Insert: " + plan.Table.Name(), nil
 }
@@ -28,6 +51,48 @@ func (p *PlanDebugger) VisitScan(plan *Scan) (string, error) {
 	return "Scan: " + plan.Table.Name(), nil
 }
 
+func (p *PlanDebugger) VisitFilter(plan *Filter) (string, error) {
+	pred, err := ast.GenExpr(plan.Predicate)
+	if err != nil {
+		return "", err
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	source, err := VisitPlan(plan.Source, p)
+	if err != nil {
+		return "", err
+	}
+	return "Filter: " + pred + "\n" + strings.Repeat("  ", p.depth) + source, nil
+}
+
+func (p *PlanDebugger) VisitLock(plan *Lock) (string, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	source, err := VisitPlan(plan.Source, p)
+	if err != nil {
+		return "", err
+	}
+	return "Lock: " + plan.Scan.Table.Name() + "\n" + strings.Repeat("  ", p.depth) + source, nil
+}
+
+func (p *PlanDebugger) VisitProject(plan *Project) (string, error) {
+	exprs := make([]string, len(plan.Exprs))
+	for i, expr := range plan.Exprs {
+		s, err := ast.GenExpr(expr)
+		if err != nil {
+			return "", err
+		}
+		exprs[i] = s
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	source, err := VisitPlan(plan.Source, p)
+	if err != nil {
+		return "", err
+	}
+	return "Project: " + strings.Join(exprs, ", ") + "\n" + strings.Repeat("  ", p.depth) + source, nil
+}
+
 func (p *PlanDebugger) VisitValues(plan *Values) (string, error) {
 	return fmt.Sprintf("Values: %d rows", len(plan.Rows)), nil
 }
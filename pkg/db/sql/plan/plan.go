@@ -10,8 +10,14 @@ import (
 
 type PlanVisitor[T any] interface {
 	VisitCreateTable(*CreateTable) (T, error)
+	VisitAlterTable(*AlterTable) (T, error)
+	VisitDropTable(*DropTable) (T, error)
+	VisitTruncate(*Truncate) (T, error)
 	VisitInsert(*Insert) (T, error)
 	VisitScan(*Scan) (T, error)
+	VisitFilter(*Filter) (T, error)
+	VisitLock(*Lock) (T, error)
+	VisitProject(*Project) (T, error)
 	VisitValues(*Values) (T, error)
 }
 
@@ -19,10 +25,22 @@ func VisitPlan[T any](plan Plan, visitor PlanVisitor[T]) (T, error) {
 	switch typedPlan := plan.(type) {
 	case *CreateTable:
 		return visitor.VisitCreateTable(typedPlan)
+	case *AlterTable:
+		return visitor.VisitAlterTable(typedPlan)
+	case *DropTable:
+		return visitor.VisitDropTable(typedPlan)
+	case *Truncate:
+		return visitor.VisitTruncate(typedPlan)
 	case *Insert:
 		return visitor.VisitInsert(typedPlan)
 	case *Scan:
 		return visitor.VisitScan(typedPlan)
+	case *Filter:
+		return visitor.VisitFilter(typedPlan)
+	case *Lock:
+		return visitor.VisitLock(typedPlan)
+	case *Project:
+		return visitor.VisitProject(typedPlan)
 	case *Values:
 		return visitor.VisitValues(typedPlan)
 	default:
@@ -36,10 +54,48 @@ type Plan interface {
 
 type CreateTable struct {
 	Table *desc.Table
+	// Defaults holds the expressions given as the defaults of the
+	// table's columns, by column name. They're evaluated when the
+	// plan is run.
+	Defaults map[string]ast.Expr
 }
 
 func (p *CreateTable) Columns() []string { return []string{"table"} }
 
+// AlterTable replaces the descriptor of a table with Altered, a copy
+// of it with the statement's change made. The table's rows are left
+// as they are, and read in terms of the altered table from then on.
+type AlterTable struct {
+	Table   *desc.Table
+	Altered *desc.Table
+	// Defaults holds the defaults of any columns added to the table,
+	// like CreateTable's.
+	Defaults map[string]ast.Expr
+	// Validate is set if the table's rows have to be checked against
+	// the altered table's constraints, because a column with some was
+	// added.
+	Validate bool
+}
+
+func (p *AlterTable) Columns() []string { return []string{"table"} }
+
+// DropTable removes a table, along with its rows and the sequence its
+// internal key is drawn from. Table is nil if the table doesn't exist
+// but the statement said IF EXISTS, so there's nothing to do.
+type DropTable struct {
+	Table *desc.Table
+}
+
+func (p *DropTable) Columns() []string { return []string{"table"} }
+
+// Truncate deletes every row of a table, and restarts the sequence
+// its internal key is drawn from.
+type Truncate struct {
+	Table *desc.Table
+}
+
+func (p *Truncate) Columns() []string { return []string{"table"} }
+
 type Insert struct {
 	Table  *desc.Table
 	Cols   []*desc.Column
@@ -82,6 +138,36 @@ func (p *Scan) Columns() []string {
 	return cols
 }
 
+// Filter returns the rows of its source for which the predicate is
+// true. Rows for which it's false or null are skipped.
+type Filter struct {
+	Source    Plan
+	Predicate ast.Expr
+}
+
+func (p *Filter) Columns() []string { return p.Source.Columns() }
+
+// Lock locks each row of its source exclusively, for the rest of the
+// transaction. The rows are those read by Scan, which may since have
+// been filtered.
+type Lock struct {
+	Source Plan
+	Scan   *Scan
+}
+
+func (p *Lock) Columns() []string { return p.Source.Columns() }
+
+// Project evaluates its expressions over each row of its source, which
+// they refer to by column name, giving the rows it returns. Names are
+// the names of the resulting columns.
+type Project struct {
+	Source Plan
+	Exprs  []ast.Expr
+	Names  []string
+}
+
+func (p *Project) Columns() []string { return p.Names }
+
 func randomString(length int) string {
 	b := make([]byte, length+2)
 	rand.Read(b)
@@ -3,9 +3,13 @@ package plan
 import (
 	"errors"
 	"fmt"
+	"slices"
 
+	"github.com/angles-n-daemons/popsql/pkg/db/pgerror"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/desc"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/schema"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/sys"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/parser"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/parser/ast"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/parser/scanner"
 )
@@ -37,17 +41,53 @@ func (p *Planner) VisitCreateTableStmt(stmt *ast.CreateTable) (Plan, error) {
 	if err != nil {
 		return nil, err
 	}
+	for _, col := range dt.Columns {
+		if err := typeCheckCheck(dt, col); err != nil {
+			return nil, err
+		}
+	}
 
+	defaults, err := columnDefaults(dt, stmt.Columns...)
+	if err != nil {
+		return nil, err
+	}
 	return &CreateTable{
-		Table: dt,
+		Table:    dt,
+		Defaults: defaults,
 	}, nil
 }
 
+// columnDefaults collects the default expressions of column specs by
+// column name. They're checked against the types of the table's
+// columns, and cast to them where needed, like inserted values.
+func columnDefaults(t *desc.Table, specs ...*ast.ColumnSpec) (map[string]ast.Expr, error) {
+	defaults := map[string]ast.Expr{}
+	for _, spec := range specs {
+		if spec.Default == nil {
+			continue
+		}
+		name := spec.Name.Name.Lexeme
+		expr, err := coerce(t.GetColumn(name), spec.Default)
+		if err != nil {
+			return nil, err
+		}
+		defaults[name] = expr
+	}
+	return defaults, nil
+}
+
 // NewTableFromStmt creates a new table from a create statement.
 // The table will NOT have an ID to start, as it will be assigned
 // by the catalog when the table is created.
+//
+// The primary key can be declared on a column, or for the table as
+// a list of columns, but only once. If it isn't declared at all, the
+// table is left without one, and given an internal key when it's
+// created.
 func NewTableFromStmt(stmt *ast.CreateTable) (*desc.Table, error) {
+	name := stmt.Name.Name.Lexeme
 	columns := make([]*desc.Column, len(stmt.Columns))
+	pkey := []string{}
 
 	for i, colSpec := range stmt.Columns {
 		column, err := NewColumnFromStmt(colSpec)
@@ -55,10 +95,20 @@ func NewTableFromStmt(stmt *ast.CreateTable) (*desc.Table, error) {
 			return nil, err
 		}
 		columns[i] = column
+		if colSpec.PrimaryKey {
+			pkey = append(pkey, column.Name)
+		}
 	}
-	// TODO: primary key parsing
-	// TODO: validate primary key
-	return desc.NewTable(stmt.Name.Name.Lexeme, columns, []string{})
+	if len(pkey) > 1 || len(pkey) > 0 && len(stmt.PrimaryKey) > 0 {
+		return nil, fmt.Errorf("multiple primary keys for table '%s' are not allowed", name)
+	}
+	for _, key := range stmt.PrimaryKey {
+		if slices.Contains(pkey, key.Name.Lexeme) {
+			return nil, fmt.Errorf("column '%s' appears twice in primary key of table '%s'", key.Name.Lexeme, name)
+		}
+		pkey = append(pkey, key.Name.Lexeme)
+	}
+	return desc.NewTable(name, columns, pkey)
 }
 
 // NewColumnFromStmt is a utility function which turns a ColumnSpec into a desc.
@@ -71,15 +121,24 @@ func NewColumnFromStmt(col *ast.ColumnSpec) (*desc.Column, error) {
 	}
 
 	name := col.Name.Name.Lexeme
-	return desc.NewColumn(name, dt), nil
+	column := desc.NewColumn(name, dt)
+	column.NotNull = col.NotNull
+	column.Unique = col.Unique
+	if col.Check != nil {
+		column.Check, err = ast.GenExpr(col.Check)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return column, nil
 }
 
 func (p *Planner) VisitInsertStmt(stmt *ast.Insert) (Plan, error) {
 	tname := stmt.Table.Name.Lexeme
 
-	dt := schema.GetByName[*desc.Table](p.Schema, tname)
-	if dt == nil {
-		return nil, fmt.Errorf("Could not find table with name %s", tname)
+	dt, err := p.getTable(stmt.Table)
+	if err != nil {
+		return nil, err
 	}
 
 	columns := make([]*desc.Column, len(stmt.Columns))
@@ -100,29 +159,310 @@ func (p *Planner) VisitInsertStmt(stmt *ast.Insert) (Plan, error) {
 		return nil, fmt.Errorf("Nothing to insert")
 	}
 
+	// the values are checked against the types of their columns, and
+	// cast to them where needed.
+	rows := make([][]ast.Expr, len(stmt.Values))
 	for i, tuple := range stmt.Values {
 		if len(tuple) != inputLen {
 			return nil, fmt.Errorf("Tuple %d has %d values, but %d columns were specified", i, len(tuple), inputLen)
 		}
+		rows[i] = make([]ast.Expr, inputLen)
+		for j, expr := range tuple {
+			rows[i][j], err = coerce(columns[j], expr)
+			if err != nil {
+				return nil, fmt.Errorf("Tuple %d value %d: %w", i, j, err)
+			}
+		}
 	}
 
-	values := NewValues(stmt.Values)
+	values := NewValues(rows)
 
 	return NewInsert(dt, columns, values), nil
 }
 
-func (p *Planner) VisitSelectStmt(stmt *ast.Select) (Plan, error) {
-	tname := stmt.From.Name.Lexeme
+func (p *Planner) VisitAddColumnStmt(stmt *ast.AddColumn) (Plan, error) {
+	dt, err := p.getUserTable(stmt.Table)
+	if err != nil {
+		return nil, err
+	}
+	col, err := NewColumnFromStmt(stmt.Column)
+	if err != nil {
+		return nil, err
+	}
+	if stmt.Column.PrimaryKey {
+		return nil, fmt.Errorf("cannot add primary key column '%s' to table '%s'", col.Name, dt.Name())
+	}
+	if dt.GetColumn(col.Name) != nil || col.Name == desc.ReservedInternalColumnName {
+		return nil, fmt.Errorf("column '%s' already exists in table '%s'", col.Name, dt.Name())
+	}
+
+	altered := dt.Copy()
+	altered.AddColumn(col)
+	if err := typeCheckCheck(altered, col); err != nil {
+		return nil, err
+	}
+	defaults, err := columnDefaults(altered, stmt.Column)
+	if err != nil {
+		return nil, err
+	}
+	return &AlterTable{
+		Table:    dt,
+		Altered:  altered,
+		Defaults: defaults,
+		Validate: col.NotNull || col.Unique || col.Check != "",
+	}, nil
+}
+
+func (p *Planner) VisitDropColumnStmt(stmt *ast.DropColumn) (Plan, error) {
+	dt, err := p.getUserTable(stmt.Table)
+	if err != nil {
+		return nil, err
+	}
+	name := stmt.Column.Name.Lexeme
+	for _, col := range dt.Columns {
+		if col.Check == "" || col.Name == name {
+			continue
+		}
+		refs, err := checkColumns(col.Check)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(refs, name) {
+			return nil, fmt.Errorf("cannot drop column '%s' of table '%s', the check constraint of column '%s' depends on it", name, dt.Name(), col.Name)
+		}
+	}
+	altered := dt.Copy()
+	err = altered.DropColumn(name)
+	if err != nil {
+		return nil, err
+	}
+	return &AlterTable{Table: dt, Altered: altered}, nil
+}
+
+func (p *Planner) VisitRenameColumnStmt(stmt *ast.RenameColumn) (Plan, error) {
+	dt, err := p.getUserTable(stmt.Table)
+	if err != nil {
+		return nil, err
+	}
+	name, newName := stmt.Column.Name.Lexeme, stmt.NewName.Name.Lexeme
+	altered := dt.Copy()
+	err = altered.RenameColumn(name, newName)
+	if err != nil {
+		return nil, err
+	}
+	// check constraints refer to columns by name, so they're rewritten
+	// to use the new one.
+	for _, col := range altered.Columns {
+		if col.Check == "" {
+			continue
+		}
+		col.Check, err = renameInCheck(col.Check, name, newName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &AlterTable{Table: dt, Altered: altered}, nil
+}
+
+func (p *Planner) VisitRenameTableStmt(stmt *ast.RenameTable) (Plan, error) {
+	dt, err := p.getUserTable(stmt.Table)
+	if err != nil {
+		return nil, err
+	}
+	name := stmt.NewName.Name.Lexeme
+	if schema.GetByName[*desc.Table](p.Schema, name) != nil {
+		return nil, fmt.Errorf("table '%s' already exists", name)
+	}
+	altered := dt.Copy()
+	altered.TName = name
+	return &AlterTable{Table: dt, Altered: altered}, nil
+}
+
+func (p *Planner) VisitDropTableStmt(stmt *ast.DropTable) (Plan, error) {
+	if stmt.IfExists && schema.GetByName[*desc.Table](p.Schema, stmt.Table.Name.Lexeme) == nil {
+		return &DropTable{}, nil
+	}
+	dt, err := p.getUserTable(stmt.Table)
+	if err != nil {
+		return nil, err
+	}
+	return &DropTable{Table: dt}, nil
+}
+
+func (p *Planner) VisitTruncateStmt(stmt *ast.Truncate) (Plan, error) {
+	dt, err := p.getUserTable(stmt.Table)
+	if err != nil {
+		return nil, err
+	}
+	return &Truncate{Table: dt}, nil
+}
+
+// getUserTable looks up a table for a statement which changes it as a
+// whole. The system tables can't be changed that way, since the
+// catalog depends on them.
+func (p *Planner) getUserTable(name *ast.Identifier) (*desc.Table, error) {
+	dt, err := p.getTable(name)
+	if err != nil {
+		return nil, err
+	}
+	if dt.ID() == sys.TablesID || dt.ID() == sys.SequencesID {
+		return nil, fmt.Errorf("cannot change system table %s", dt.Name())
+	}
+	return dt, nil
+}
+
+// typeCheckCheck checks that a column's check constraint refers only
+// to the table's columns, and is a condition, so that a bad one is
+// caught when the table is changed rather than by every insert.
+func typeCheckCheck(t *desc.Table, col *desc.Column) error {
+	if col.Check == "" {
+		return nil
+	}
+	expr, err := parser.ParseExpr(col.Check)
+	if err != nil {
+		return err
+	}
+	dt, err := (&typeChecker{cols: t.GetColumns()}).typeOf(expr)
+	if err != nil {
+		return fmt.Errorf("check constraint of column '%s': %w", col.Name, err)
+	}
+	if dt != desc.BOOLEAN && dt != desc.UNKNOWN {
+		return pgerror.New(pgerror.DatatypeMismatch, fmt.Errorf(
+			"argument of CHECK must be type BOOLEAN, not type %s", dt,
+		))
+	}
+	return nil
+}
+
+// checkColumns returns the names of the columns a check constraint
+// refers to.
+func checkColumns(check string) ([]string, error) {
+	expr, err := parser.ParseExpr(check)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	err = ast.Walk(expr, func(e ast.Expr) error {
+		if id, ok := e.(*ast.Identifier); ok {
+			names = append(names, id.Name.Lexeme)
+		}
+		return nil
+	})
+	return names, err
+}
+
+// renameInCheck rewrites a check constraint to refer to a renamed
+// column by its new name.
+func renameInCheck(check, name, newName string) (string, error) {
+	expr, err := parser.ParseExpr(check)
+	if err != nil {
+		return "", err
+	}
+	err = ast.Walk(expr, func(e ast.Expr) error {
+		if id, ok := e.(*ast.Identifier); ok && id.Name.Lexeme == name {
+			id.Name.Lexeme = newName
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return ast.GenExpr(expr)
+}
 
+func (p *Planner) getTable(name *ast.Identifier) (*desc.Table, error) {
+	tname := name.Name.Lexeme
 	dt := schema.GetByName[*desc.Table](p.Schema, tname)
 	if dt == nil {
 		return nil, fmt.Errorf("Could not find table with name %s", tname)
 	}
+	return dt, nil
+}
 
-	from := NewScan(dt)
+// Transaction statements are run by the session rather than being
+// planned, since they act on the session's transaction rather than
+// on any table.
+func (p *Planner) VisitTransactionStmt(stmt *ast.Transaction) (Plan, error) {
+	return nil, fmt.Errorf("%s cannot be planned", stmt.Command.Lexeme)
+}
+
+func (p *Planner) VisitSelectStmt(stmt *ast.Select) (Plan, error) {
+	// a select without a table is run over a single empty row.
+	var source Plan = NewValues([][]ast.Expr{{}})
+	var cols []*desc.Column
+	var from *Scan
+	if stmt.From != nil {
+		dt, err := p.getTable(stmt.From)
+		if err != nil {
+			return nil, err
+		}
+		from = NewScan(dt)
+		source = from
+		cols = dt.GetColumns()
+	}
+
+	checker := &typeChecker{cols: cols}
+	if stmt.Where != nil {
+		t, err := checker.typeOf(stmt.Where)
+		if err != nil {
+			return nil, err
+		}
+		if t != desc.BOOLEAN && t != desc.UNKNOWN {
+			return nil, pgerror.New(pgerror.DatatypeMismatch, fmt.Errorf(
+				"argument of WHERE must be type BOOLEAN, not type %s", t,
+			))
+		}
+		source = &Filter{Source: source, Predicate: stmt.Where}
+	}
+	// only the rows which pass the filter are locked.
+	if stmt.ForUpdate && from != nil {
+		source = &Lock{Source: source, Scan: from}
+	}
+
+	if stmt.From != nil && len(stmt.Terms) == 1 && isStar(stmt.Terms[0]) {
+		return source, nil
+	}
+
+	project := &Project{Source: source}
+	for _, term := range stmt.Terms {
+		if isStar(term) {
+			if stmt.From == nil {
+				return nil, errors.New("SELECT * with no tables specified is not valid")
+			}
+			// the star stands for each of the table's columns.
+			for _, col := range cols {
+				project.Exprs = append(project.Exprs, &ast.Identifier{
+					Name: &scanner.Token{Type: scanner.IDENTIFIER, Lexeme: col.Name},
+				})
+				project.Names = append(project.Names, col.Name)
+			}
+			continue
+		}
+		if _, err := checker.typeOf(term); err != nil {
+			return nil, err
+		}
+		project.Exprs = append(project.Exprs, term)
+		project.Names = append(project.Names, termName(term))
+	}
+	return project, nil
+}
+
+func isStar(term ast.Expr) bool {
+	id, ok := term.(*ast.Identifier)
+	return ok && id.Name.Type == scanner.STAR
+}
 
-	if len(stmt.Terms) == 1 && stmt.Terms[0].Name.Type == scanner.STAR {
-		return from, nil
+// termName returns the name of the column a select term returns,
+// which is its alias if it has one. Otherwise a column reference is
+// named after the column, and any other expression "?column?", as
+// in postgres.
+func termName(term ast.Expr) string {
+	switch t := term.(type) {
+	case *ast.Alias:
+		return t.Name.Name.Lexeme
+	case *ast.Identifier:
+		return t.Name.Lexeme
+	default:
+		return "?column?"
 	}
-	return from, errors.New("not implemented")
 }
@@ -0,0 +1,174 @@
+package plan
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/pgerror"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/catalog/desc"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/parser/ast"
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/parser/scanner"
+)
+
+// typeChecker infers the data types of expressions, so that they can
+// be checked before the plan is run. Identifiers refer to the columns
+// in cols, and take their types. The type of null isn't known, so it's
+// UNKNOWN, which fits any type.
+type typeChecker struct {
+	cols []*desc.Column
+}
+
+func (c *typeChecker) typeOf(expr ast.Expr) (desc.DataType, error) {
+	return ast.VisitExpr(expr, c)
+}
+
+func literalType(v any) desc.DataType {
+	switch v.(type) {
+	case string:
+		return desc.STRING
+	case float64:
+		return desc.NUMBER
+	case bool:
+		return desc.BOOLEAN
+	default:
+		return desc.UNKNOWN
+	}
+}
+
+func (c *typeChecker) VisitLiteralExpr(expr *ast.Literal) (desc.DataType, error) {
+	return literalType(expr.Value.Literal), nil
+}
+
+func (c *typeChecker) VisitIdentifierExpr(expr *ast.Identifier) (desc.DataType, error) {
+	for _, col := range c.cols {
+		if col.Name == expr.Name.Lexeme {
+			return col.DataType, nil
+		}
+	}
+	return desc.UNKNOWN, pgerror.New(pgerror.UndefinedColumn, fmt.Errorf(
+		"column '%s' does not exist", expr.Name.Lexeme,
+	))
+}
+
+func (c *typeChecker) VisitUnaryExpr(expr *ast.Unary) (desc.DataType, error) {
+	right, err := c.typeOf(expr.Right)
+	if err != nil {
+		return desc.UNKNOWN, err
+	}
+	want := desc.NUMBER
+	if expr.Operator.Type == scanner.BANG || expr.Operator.Type == scanner.NOT {
+		want = desc.BOOLEAN
+	}
+	if right != desc.UNKNOWN && right != want {
+		return desc.UNKNOWN, fmt.Errorf("operator %s cannot be applied to type %s", expr.Operator.Lexeme, right)
+	}
+	return want, nil
+}
+
+func (c *typeChecker) VisitBinaryExpr(expr *ast.Binary) (desc.DataType, error) {
+	left, err := c.typeOf(expr.Left)
+	if err != nil {
+		return desc.UNKNOWN, err
+	}
+	right, err := c.typeOf(expr.Right)
+	if err != nil {
+		return desc.UNKNOWN, err
+	}
+	mismatch := fmt.Errorf("operator %s cannot be applied to types %s and %s", expr.Operator.Lexeme, left, right)
+	// fits reports whether both operands are of the given type, or
+	// could be.
+	fits := func(dt desc.DataType) bool {
+		return (left == desc.UNKNOWN || left == dt) && (right == desc.UNKNOWN || right == dt)
+	}
+
+	switch expr.Operator.Type {
+	case scanner.PLUS:
+		// adds numbers, or joins strings.
+		operand := left
+		if operand == desc.UNKNOWN {
+			operand = right
+		}
+		if operand == desc.BOOLEAN || !fits(operand) {
+			return desc.UNKNOWN, mismatch
+		}
+		return operand, nil
+	case scanner.MINUS, scanner.STAR, scanner.SLASH:
+		if !fits(desc.NUMBER) {
+			return desc.UNKNOWN, mismatch
+		}
+		return desc.NUMBER, nil
+	case scanner.GREATER, scanner.GREATER_EQUAL, scanner.LESS, scanner.LESS_EQUAL:
+		if !fits(desc.NUMBER) {
+			return desc.UNKNOWN, mismatch
+		}
+		return desc.BOOLEAN, nil
+	case scanner.EQUAL_EQUAL, scanner.BANG_EQUAL:
+		return desc.BOOLEAN, nil
+	case scanner.AND, scanner.OR:
+		if !fits(desc.BOOLEAN) {
+			return desc.UNKNOWN, mismatch
+		}
+		return desc.BOOLEAN, nil
+	default:
+		return desc.UNKNOWN, fmt.Errorf("unsupported binary operator: %s", expr.Operator.Lexeme)
+	}
+}
+
+func (c *typeChecker) VisitColumnSpecExpr(spec *ast.ColumnSpec) (desc.DataType, error) {
+	return desc.UNKNOWN, fmt.Errorf("a column spec has no type: name '%s'", spec.Name.Name.Lexeme)
+}
+
+func (c *typeChecker) VisitAliasExpr(expr *ast.Alias) (desc.DataType, error) {
+	return c.typeOf(expr.Expr)
+}
+
+// coerce checks that the value can be written to the column, returning
+// it as the column's type. Literals of another type are cast where
+// that's safe: strings which hold a number or a boolean, and numbers
+// written to string columns.
+func coerce(col *desc.Column, expr ast.Expr) (ast.Expr, error) {
+	// values can't refer to columns.
+	dt, err := (&typeChecker{}).typeOf(expr)
+	if err != nil {
+		return nil, err
+	}
+	if dt == desc.UNKNOWN || dt == col.DataType {
+		return expr, nil
+	}
+	lit, ok := expr.(*ast.Literal)
+	if !ok {
+		return nil, pgerror.New(pgerror.DatatypeMismatch, fmt.Errorf(
+			"column '%s' is of type %s but expression is of type %s", col.Name, col.DataType, dt,
+		))
+	}
+
+	var v any
+	switch val := lit.Value.Literal.(type) {
+	case string:
+		switch col.DataType {
+		case desc.NUMBER:
+			v, err = strconv.ParseFloat(val, 64)
+		case desc.BOOLEAN:
+			v, err = strconv.ParseBool(val)
+		}
+		if err != nil {
+			return nil, pgerror.New(pgerror.InvalidTextRepr, fmt.Errorf(
+				"invalid input for column '%s' of type %s: \"%s\"", col.Name, col.DataType, val,
+			))
+		}
+	case float64:
+		if col.DataType == desc.STRING {
+			v = strconv.FormatFloat(val, 'f', -1, 64)
+		}
+	}
+	if v == nil {
+		return nil, pgerror.New(pgerror.DatatypeMismatch, fmt.Errorf(
+			"column '%s' is of type %s but expression is of type %s", col.Name, col.DataType, dt,
+		))
+	}
+	return &ast.Literal{Value: &scanner.Token{
+		Type:    lit.Value.Type,
+		Lexeme:  lit.Value.Lexeme,
+		Literal: v,
+	}}, nil
+}
@@ -0,0 +1,192 @@
+/*
+Package rowenc encodes the rows of a table into the values stored
+under their keys.
+
+A row is written as a version byte, followed by the number of
+columns in it and a bitmap with a bit set for each of them which is
+null. Then each column follows in turn, as its ID, written as the
+difference from the ID before it, and its value if it isn't null:
+
+	version | uvarint n | null bitmap, (n+7)/8 bytes | (uvarint id delta, value)*
+
+Each value starts with a tag byte naming its type. Whole numbers are
+written as zigzag varints, other numbers as the eight bytes of a
+float64, and strings as their length followed by their bytes.
+
+Rows used to be stored as JSON objects keyed by column name. They
+can't start with a version byte, so they're told apart by IsJSON and
+can still be read.
+*/
+package rowenc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Version is the version of the format rows are written in.
+const Version byte = 1
+
+const (
+	tagFalse byte = iota
+	tagTrue
+	tagInt
+	tagFloat
+	tagString
+)
+
+// maxExactInt is the largest magnitude below which every whole
+// float64 is exactly an integer.
+const maxExactInt = 1 << 53
+
+var errMalformedRow = errors.New("malformed row")
+
+// IsJSON returns whether the row is in the old JSON format.
+func IsJSON(b []byte) bool {
+	return len(b) > 0 && b[0] == '{'
+}
+
+// Encode encodes a row from the IDs of its columns, which must be in
+// ascending order, and their values. A nil value is null.
+func Encode(ids []uint32, vals []any) ([]byte, error) {
+	if len(ids) != len(vals) {
+		return nil, fmt.Errorf("cannot encode %d values for %d columns", len(vals), len(ids))
+	}
+	n := len(ids)
+	b := make([]byte, 0, 1+binary.MaxVarintLen32+(n+7)/8+n*10)
+	b = append(b, Version)
+	b = binary.AppendUvarint(b, uint64(n))
+	bitmap := len(b)
+	b = append(b, make([]byte, (n+7)/8)...)
+
+	var prev uint32
+	for i, id := range ids {
+		if i > 0 && id <= prev {
+			return nil, fmt.Errorf("column ids must be ascending, but %d follows %d", id, prev)
+		}
+		b = binary.AppendUvarint(b, uint64(id-prev))
+		prev = id
+		if vals[i] == nil {
+			b[bitmap+i/8] |= 1 << (i % 8)
+			continue
+		}
+		var err error
+		b, err = appendValue(b, vals[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func appendValue(b []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return append(b, tagTrue), nil
+		}
+		return append(b, tagFalse), nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < maxExactInt {
+			return binary.AppendVarint(append(b, tagInt), int64(v)), nil
+		}
+		b = append(b, tagFloat)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(v)), nil
+	case int:
+		return binary.AppendVarint(append(b, tagInt), int64(v)), nil
+	case int64:
+		return binary.AppendVarint(append(b, tagInt), v), nil
+	case uint64:
+		if v >= maxExactInt {
+			return appendValue(b, float64(v))
+		}
+		return binary.AppendVarint(append(b, tagInt), int64(v)), nil
+	case string:
+		b = binary.AppendUvarint(append(b, tagString), uint64(len(v)))
+		return append(b, v...), nil
+	default:
+		return nil, fmt.Errorf("cannot encode value %v of type %T in a row", v, v)
+	}
+}
+
+// Decode decodes the values of the columns with the given IDs from a
+// row, in the same order. Columns the row doesn't have, such as ones
+// added after it was written, take their values from missing, or are
+// null if it's nil. Numbers are decoded as float64, whichever way
+// they were written.
+func Decode(b []byte, ids []uint32, missing []any) ([]any, error) {
+	if len(b) == 0 {
+		return nil, errMalformedRow
+	}
+	if b[0] != Version {
+		return nil, fmt.Errorf("unknown row format version %d", b[0])
+	}
+	n, size := binary.Uvarint(b[1:])
+	// every column takes at least a byte for its ID.
+	if size <= 0 || n > uint64(len(b)) || uint64(len(b)) < 1+uint64(size)+(n+7)/8 {
+		return nil, errMalformedRow
+	}
+	bitmap := b[1+size : 1+size+int((n+7)/8)]
+	rest := b[1+size+len(bitmap):]
+
+	vals := make([]any, len(ids))
+	copy(vals, missing)
+	var id uint32
+	for i := 0; i < int(n); i++ {
+		delta, size := binary.Uvarint(rest)
+		if size <= 0 {
+			return nil, errMalformedRow
+		}
+		rest = rest[size:]
+		id += uint32(delta)
+		var v any
+		if bitmap[i/8]&(1<<(i%8)) == 0 {
+			var err error
+			v, rest, err = decodeValue(rest)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for j, want := range ids {
+			if want == id {
+				vals[j] = v
+			}
+		}
+	}
+	return vals, nil
+}
+
+func decodeValue(b []byte) (any, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, errMalformedRow
+	}
+	tag, b := b[0], b[1:]
+	switch tag {
+	case tagFalse:
+		return false, b, nil
+	case tagTrue:
+		return true, b, nil
+	case tagInt:
+		v, size := binary.Varint(b)
+		if size <= 0 {
+			return nil, nil, errMalformedRow
+		}
+		return float64(v), b[size:], nil
+	case tagFloat:
+		if len(b) < 8 {
+			return nil, nil, errMalformedRow
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), b[8:], nil
+	case tagString:
+		l, size := binary.Uvarint(b)
+		if size <= 0 || uint64(len(b)-size) < l {
+			return nil, nil, errMalformedRow
+		}
+		b = b[size:]
+		return string(b[:l]), b[l:], nil
+	default:
+		return nil, nil, errMalformedRow
+	}
+}
@@ -0,0 +1,146 @@
+package rowenc_test
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/angles-n-daemons/popsql/pkg/db/sql/rowenc"
+	"github.com/angles-n-daemons/popsql/pkg/test/assert"
+)
+
+func TestRoundTrip(t *testing.T) {
+	ids := []uint32{1, 2, 3, 5, 8, 13, 200, 201}
+	vals := []any{
+		"hello", nil, true, false, 42.0, -1.5, math.MaxFloat64, strings.Repeat("x", 300),
+	}
+	b, err := rowenc.Encode(ids, vals)
+	assert.NoError(t, err)
+	assert.False(t, rowenc.IsJSON(b))
+
+	decoded, err := rowenc.Decode(b, ids, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, vals, decoded)
+
+	// columns can be read in any order, and ones the row doesn't have
+	// are null.
+	decoded, err = rowenc.Decode(b, []uint32{13, 4, 1}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{-1.5, nil, "hello"}, decoded)
+}
+
+func TestMissing(t *testing.T) {
+	b, err := rowenc.Encode([]uint32{1, 2}, []any{"a", nil})
+	assert.NoError(t, err)
+
+	// columns the row doesn't have take their missing values, but ones
+	// it has as null stay null.
+	decoded, err := rowenc.Decode(b, []uint32{1, 2, 3}, []any{"x", "y", "z"})
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"a", nil, "z"}, decoded)
+}
+
+func TestNumbers(t *testing.T) {
+	// whole numbers are stored as integers, but every number is read
+	// back as a float64.
+	vals := []any{0.0, -7.0, 1e15, 1e300, 0.1, 3, int64(-4), uint64(1 << 60)}
+	ids := []uint32{1, 2, 3, 4, 5, 6, 7, 8}
+	b, err := rowenc.Encode(ids, vals)
+	assert.NoError(t, err)
+	decoded, err := rowenc.Decode(b, ids, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{0.0, -7.0, 1e15, 1e300, 0.1, 3.0, -4.0, float64(1 << 60)}, decoded)
+}
+
+func TestNullBitmap(t *testing.T) {
+	// enough columns to need more than one byte of bitmap.
+	ids := make([]uint32, 20)
+	vals := make([]any, 20)
+	for i := range ids {
+		ids[i] = uint32(i + 1)
+		if i%3 == 0 {
+			vals[i] = float64(i)
+		}
+	}
+	b, err := rowenc.Encode(ids, vals)
+	assert.NoError(t, err)
+	decoded, err := rowenc.Decode(b, ids, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, vals, decoded)
+}
+
+func TestEncodeErrors(t *testing.T) {
+	_, err := rowenc.Encode([]uint32{1}, []any{1.0, 2.0})
+	assert.IsError(t, err, "cannot encode 2 values for 1 columns")
+	_, err = rowenc.Encode([]uint32{2, 1}, []any{1.0, 2.0})
+	assert.IsError(t, err, "column ids must be ascending, but 1 follows 2")
+	_, err = rowenc.Encode([]uint32{1}, []any{[]int{1}})
+	assert.IsError(t, err, "cannot encode value [1] of type []int in a row")
+}
+
+func TestDecodeErrors(t *testing.T) {
+	b, err := rowenc.Encode([]uint32{1, 2}, []any{"hello", 1.5})
+	assert.NoError(t, err)
+	for i := 0; i < len(b); i++ {
+		_, err := rowenc.Decode(b[:i], []uint32{1, 2}, nil)
+		assert.IsError(t, err, "malformed row")
+	}
+
+	_, err = rowenc.Decode([]byte{9, 0}, nil, nil)
+	assert.IsError(t, err, "unknown row format version 9")
+}
+
+func TestIsJSON(t *testing.T) {
+	b, err := json.Marshal(map[string]any{"a": 1})
+	assert.NoError(t, err)
+	assert.True(t, rowenc.IsJSON(b))
+}
+
+var (
+	benchNames = []string{"id", "name", "email", "age", "score", "active"}
+	benchIDs   = []uint32{1, 2, 3, 4, 5, 6}
+	benchVals  = []any{12345.0, "ada lovelace", "ada@example.com", 36.0, 98.5, true}
+)
+
+func benchJSONRow(b *testing.B) []byte {
+	row := map[string]any{}
+	for i, name := range benchNames {
+		row[name] = benchVals[i]
+	}
+	enc, err := json.Marshal(row)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return enc
+}
+
+// BenchmarkDecodeJSON      220267      5548 ns/op    96.00 bytes/row    600 B/op    20 allocs/op
+// BenchmarkDecodeBinary   2254560     523.3 ns/op    56.00 bytes/row    184 B/op     8 allocs/op
+func BenchmarkDecodeJSON(b *testing.B) {
+	enc := benchJSONRow(b)
+	b.ReportMetric(float64(len(enc)), "bytes/row")
+	for i := 0; i < b.N; i++ {
+		row := map[string]any{}
+		if err := json.Unmarshal(enc, &row); err != nil {
+			b.Fatal(err)
+		}
+		vals := make([]any, len(benchNames))
+		for j, name := range benchNames {
+			vals[j] = row[name]
+		}
+	}
+}
+
+func BenchmarkDecodeBinary(b *testing.B) {
+	enc, err := rowenc.Encode(benchIDs, benchVals)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(len(enc)), "bytes/row")
+	for i := 0; i < b.N; i++ {
+		if _, err := rowenc.Decode(enc, benchIDs, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
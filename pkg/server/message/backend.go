@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/angles-n-daemons/popsql/pkg/db/pgerror"
 	"github.com/angles-n-daemons/popsql/pkg/db/sql/execution"
 )
 
@@ -55,14 +56,18 @@ Byte1
 Current backend transaction status indicator. Possible values are 'I' if idle (not in a transaction block); 'T' if in a transaction block; or 'E' if in a failed transaction block (queries will be rejected until block is ended).
 */
 
-type ReadyForQuery struct{}
+type ReadyForQuery struct {
+	// Status is the transaction status indicator, which is the
+	// session's db.TxnStatus.
+	Status byte
+}
 
 func (r *ReadyForQuery) Type() Type {
 	return M_ReadyForQuery
 }
 
 func (r *ReadyForQuery) Dump() Buffer {
-	return []byte{'I'}
+	return []byte{r.Status}
 }
 
 /*
@@ -120,15 +125,18 @@ func (r *RowDescription) Dump() Buffer {
 		// skip column offset
 		data.AddInt16(0)
 
-		var dt Oid
-		var tl int
-		switch r.SampleRow[i].(type) {
+		// columns whose type isn't known, because there are no rows
+		// or the value is null, are described as text.
+		dt := T_text
+		tl := -1
+		var sample any
+		if i < len(r.SampleRow) {
+			sample = r.SampleRow[i]
+		}
+		switch sample.(type) {
 		case float64:
 			tl = 8
 			dt = T_float8
-		case string:
-			tl = -1
-			dt = T_text
 		case bool:
 			tl = 1
 			dt = T_bool
@@ -212,7 +220,13 @@ func (c *CommandComplete) Type() Type {
 
 func (c *CommandComplete) Dump() Buffer {
 	data := Buffer{}
-	data.AddString(c.Command + " " + strconv.Itoa(c.Count))
+	switch c.Command {
+	case "BEGIN", "COMMIT", "ROLLBACK":
+		// transaction commands have no row count.
+		data.AddString(c.Command)
+	default:
+		data.AddString(c.Command + " " + strconv.Itoa(c.Count))
+	}
 	return data
 }
 
@@ -245,6 +259,8 @@ func (e *ErrorResponse) Dump() Buffer {
 	data := Buffer{}
 	data.AddByte(E_Severity)
 	data.AddString("ERROR")
+	data.AddByte(E_Code)
+	data.AddString(string(pgerror.CodeOf(e.Error)))
 	data.AddByte(E_Message)
 	data.AddString(e.Error.Error())
 	data.AddNull()
@@ -16,6 +16,7 @@ const (
 
 const (
 	E_Severity = 'S'
+	E_Code     = 'C'
 	E_Message  = 'M'
 )
 
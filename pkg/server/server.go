@@ -65,7 +65,9 @@ func (srv *Server) serve(conn net.Conn) error {
 		return err
 	}
 
-	return srv.loop(conn)
+	session := srv.db.NewSession()
+	defer session.Close()
+	return srv.loop(conn, session)
 }
 
 func connInit(conn net.Conn) error {
@@ -94,14 +96,14 @@ func connInit(conn net.Conn) error {
 		return nil
 	}
 
-	err = writeMessage(conn, &message.ReadyForQuery{})
+	err = writeMessage(conn, &message.ReadyForQuery{Status: byte(db.TxnIdle)})
 	if err != nil {
 		return nil
 	}
 	return nil
 }
 
-func (srv *Server) loop(conn net.Conn) error {
+func (srv *Server) loop(conn net.Conn, session *db.Session) error {
 	for {
 		t, data, err := readMessage(conn)
 		if err != nil {
@@ -110,7 +112,7 @@ func (srv *Server) loop(conn net.Conn) error {
 		switch t {
 		case message.M_Query:
 			q := message.Parse[message.Query](data)
-			result, err := srv.db.Query(q.Query, nil)
+			result, err := session.Query(q.Query, nil)
 			messages := resultToMessages(result, err)
 			for _, msg := range messages {
 				err = writeMessage(conn, msg)
@@ -123,7 +125,7 @@ func (srv *Server) loop(conn net.Conn) error {
 		default:
 			fmt.Println("unknown message type", t)
 		}
-		err = writeMessage(conn, &message.ReadyForQuery{})
+		err = writeMessage(conn, &message.ReadyForQuery{Status: byte(session.Status())})
 		if err != nil {
 			return nil
 		}
@@ -133,12 +135,22 @@ func (srv *Server) loop(conn net.Conn) error {
 func resultToMessages(result *execution.Result, err error) []message.Dumpable {
 	msgs := []message.Dumpable{}
 
-	if err == nil {
-		// No queries should return 0 rows. Assume this and proceed.
-		// Column descriptions
+	if err == nil && result.Command != "" {
+		// statements which return no rows, like BEGIN, just report
+		// their command.
+		msgs = append(msgs, &message.CommandComplete{
+			Command: result.Command,
+		})
+	} else if err == nil {
+		// Column descriptions, whose types are taken from the first
+		// row, if there is one.
+		var sample execution.Row
+		if len(result.Rows) > 0 {
+			sample = result.Rows[0]
+		}
 		msgs = append(msgs, &message.RowDescription{
 			Columns:   result.Columns,
-			SampleRow: result.Rows[0],
+			SampleRow: sample,
 		})
 		// Rows
 		for _, row := range result.Rows {
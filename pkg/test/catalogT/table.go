@@ -49,6 +49,16 @@ func NewTable(t *desc.Table) *desc.Table {
 		t.Columns = []*desc.Column{a, b}
 		t.PrimaryKey = []string{"a"}
 	}
+
+	if t.NextColumnID == 0 {
+		t.NextColumnID = 1
+	}
+	for _, col := range t.Columns {
+		if col.ID == 0 {
+			col.ID = t.NextColumnID
+			t.NextColumnID++
+		}
+	}
 	return t
 }
 
@@ -57,6 +67,7 @@ func CopyTable(t *desc.Table) *desc.Table {
 	if err != nil {
 		panic(err)
 	}
+	tn.NextColumnID = t.NextColumnID
 	return tn
 }
 
@@ -20,13 +20,21 @@ Identifier = *scanner.Token Name
 Binary     = Expr Left, *scanner.Token Operator, Expr Right
 Literal    = *scanner.Token Value
 Unary      = *scanner.Token Operator, Expr Right
-ColumnSpec = *Identifier Name, *scanner.Token DataType
+ColumnSpec = *Identifier Name, *scanner.Token DataType, Expr Default, bool PrimaryKey, bool NotNull, bool Unique, Expr Check
+Alias      = Expr Expr, *Identifier Name
 `
 
 var stmtAST = `
-Select      = []*Identifier Terms, *Identifier From, Expr Where
+Select      = []Expr Terms, *Identifier From, Expr Where, bool ForUpdate
 Insert      = *Identifier Table, []*Identifier Columns, [][]Expr Values
-CreateTable = *Identifier Name, []*ColumnSpec Columns
+CreateTable = *Identifier Name, []*ColumnSpec Columns, []*Identifier PrimaryKey
+Transaction = *scanner.Token Command
+AddColumn    = *Identifier Table, *ColumnSpec Column
+DropColumn   = *Identifier Table, *Identifier Column
+RenameColumn = *Identifier Table, *Identifier Column, *Identifier NewName
+RenameTable  = *Identifier Table, *Identifier NewName
+DropTable    = *Identifier Table, bool IfExists
+Truncate     = *Identifier Table
 `
 
 var walkFuncSignature = `